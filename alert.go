@@ -0,0 +1,26 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework Cocoa
+#include <stdlib.h>
+#include "alert.h"
+*/
+import "C"
+
+import "unsafe"
+
+// showLaunchError tells the user that urlStr couldn't be opened at t, since
+// a click that silently does nothing looks like the router ignored it.
+func showLaunchError(config Config, t launchTarget, urlStr string, err error) {
+	target := targetLabels([]launchTarget{t}, config)[0]
+	if target == "" {
+		target = t.String()
+	}
+	cURL := C.CString(urlStr)
+	defer C.free(unsafe.Pointer(cURL))
+	cTarget := C.CString(target)
+	defer C.free(unsafe.Pointer(cTarget))
+	cMessage := C.CString(err.Error())
+	defer C.free(unsafe.Pointer(cMessage))
+	C.ShowLaunchError(cURL, cTarget, cMessage)
+}
@@ -0,0 +1,4 @@
+// ShowLaunchError tells the user that url couldn't be opened at target,
+// offering to copy the URL to the clipboard. It returns without waiting for
+// the alert to be dismissed.
+void ShowLaunchError(const char *url, const char *target, const char *message);
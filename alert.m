@@ -0,0 +1,27 @@
+#import <Cocoa/Cocoa.h>
+#include "alert.h"
+
+void ShowLaunchError(const char *url, const char *target, const char *message) {
+  @autoreleasepool {
+    NSString *link = [NSString stringWithUTF8String:url];
+    NSString *info = [NSString stringWithFormat:@"%@\n\nOpening in %@ failed: %@", link,
+                                                [NSString stringWithUTF8String:target],
+                                                [NSString stringWithUTF8String:message]];
+    // The block retains link and info until it has run.
+    dispatch_async(dispatch_get_main_queue(), ^{
+      NSAlert *alert = [[NSAlert alloc] init];
+      alert.alertStyle = NSAlertStyleWarning;
+      alert.messageText = @"Couldn't open link";
+      alert.informativeText = info;
+      [alert addButtonWithTitle:@"OK"];
+      [alert addButtonWithTitle:@"Copy URL"];
+      [NSApp activateIgnoringOtherApps:YES];
+      if ([alert runModal] == NSAlertSecondButtonReturn) {
+        NSPasteboard *pasteboard = [NSPasteboard generalPasteboard];
+        [pasteboard clearContents];
+        [pasteboard setString:link forType:NSPasteboardTypeString];
+      }
+      [alert release];
+    });
+  }
+}
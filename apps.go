@@ -0,0 +1,165 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework AppKit
+#include <stdlib.h>
+#include "apps.h"
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	chromeBundleID       = "com.google.Chrome"
+	defaultChromeAppPath = "/Applications/Google Chrome.app"
+)
+
+// detectedChrome caches where LaunchServices found Chrome, so it is only
+// looked up once rather than on every config reload.
+var detectedChrome struct {
+	mu   sync.Mutex
+	path string
+}
+
+// detectChromeAppPath returns where Chrome is installed, which may be
+// ~/Applications or a renamed bundle on managed Macs, falling back to
+// defaultChromeAppPath when LaunchServices doesn't know of it. A miss isn't
+// cached, so Chrome is found once it has been installed.
+func detectChromeAppPath() string {
+	detectedChrome.mu.Lock()
+	defer detectedChrome.mu.Unlock()
+	if detectedChrome.path == "" {
+		detectedChrome.path = appPathForBundleID(chromeBundleID)
+		if detectedChrome.path == "" {
+			return defaultChromeAppPath
+		}
+		if logger != nil {
+			logger.Debugf("Found Chrome at %s", detectedChrome.path)
+		}
+	}
+	return detectedChrome.path
+}
+
+// appPathForBundleID returns where the app with bundleID is installed, or "".
+func appPathForBundleID(bundleID string) string {
+	cID := C.CString(bundleID)
+	defer C.free(unsafe.Pointer(cID))
+	p := C.AppPathForBundleID(cID)
+	if p == nil {
+		return ""
+	}
+	defer C.free(unsafe.Pointer(p))
+	return C.GoString(p)
+}
+
+// launchApp launches the app at appPath, or the app with bundleID when
+// bundleID is given, with args through NSWorkspace, returning its pid.
+// With newInstance, a new instance is started even when the app is running,
+// as open -n does; Chrome's hands its arguments to the running one. It
+// stops waiting for the launch when ctx is done.
+func launchApp(ctx context.Context, appPath, bundleID string, args []string, newInstance, activate bool) (int, error) {
+	cAppPath, cBundleID := cAppRef(appPath, bundleID)
+	defer C.free(unsafe.Pointer(cAppPath))
+	defer C.free(unsafe.Pointer(cBundleID))
+	cArgs := make([]*C.char, len(args)+1)
+	for i, arg := range args {
+		cArgs[i] = C.CString(arg)
+		defer C.free(unsafe.Pointer(cArgs[i]))
+	}
+	var cErr *C.char
+	pid := C.LaunchApp(cAppPath, cBundleID, &cArgs[0], C.int(len(args)), C.bool(newInstance), C.bool(activate), launchTimeoutSeconds(ctx), &cErr)
+	return launchResult(pid, cErr)
+}
+
+// openURLInApp opens urlStr in the app at appPath, or the app with bundleID
+// when bundleID is given, through NSWorkspace, returning the app's pid. An
+// appPath without a slash names an app in an Applications folder. It stops
+// waiting for the app when ctx is done.
+func openURLInApp(ctx context.Context, appPath, bundleID, urlStr string, activate bool) (int, error) {
+	cAppPath, cBundleID := cAppRef(appPath, bundleID)
+	defer C.free(unsafe.Pointer(cAppPath))
+	defer C.free(unsafe.Pointer(cBundleID))
+	cURL := C.CString(urlStr)
+	defer C.free(unsafe.Pointer(cURL))
+	var cErr *C.char
+	pid := C.OpenURLInApp(cAppPath, cBundleID, cURL, C.bool(activate), launchTimeoutSeconds(ctx), &cErr)
+	return launchResult(pid, cErr)
+}
+
+// cAppRef returns the app path and bundle ID to hand to LaunchApp or
+// OpenURLInApp, which take the bundle ID when it is given. Either may be
+// nil; free both.
+func cAppRef(appPath, bundleID string) (*C.char, *C.char) {
+	if bundleID != "" {
+		return nil, C.CString(bundleID)
+	}
+	return C.CString(appPath), nil
+}
+
+// launchTimeoutSeconds returns how long a launch may take under ctx, or -1
+// for as long as it takes.
+func launchTimeoutSeconds(ctx context.Context) C.double {
+	if deadline, ok := ctx.Deadline(); ok {
+		return C.double(max(time.Until(deadline).Seconds(), 0))
+	}
+	return -1
+}
+
+// launchResult turns what LaunchApp or OpenURLInApp returned into the pid
+// or the error, freeing the message of cErr.
+func launchResult(pid C.int, cErr *C.char) (int, error) {
+	if pid < 0 {
+		return 0, errLaunchTimedOut
+	}
+	if cErr != nil {
+		defer C.free(unsafe.Pointer(cErr))
+		return 0, errors.New(C.GoString(cErr))
+	}
+	return int(pid), nil
+}
+
+// execApp runs the executable of the app at appPath, or of the app with
+// bundleID when bundleID is given, with args, returning its pid. Arguments
+// reach the app as they would on a command line, which open --args doesn't
+// manage for some Chrome flags when Chrome is already running; Chrome then
+// hands them to the running instance and exits.
+func execApp(appPath, bundleID string, args []string) (int, error) {
+	if bundleID != "" {
+		if appPath = appPathForBundleID(bundleID); appPath == "" {
+			return 0, fmt.Errorf("no app with bundle ID %s is installed", bundleID)
+		}
+	}
+	bin := appExecutablePath(appPath)
+	if bin == "" {
+		return 0, fmt.Errorf("%s is not an app", appPath)
+	}
+	cmd := exec.Command(bin, args...)
+	// A Chrome started this way keeps running after the router quits.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	go cmd.Wait()
+	return cmd.Process.Pid, nil
+}
+
+// appExecutablePath returns the executable of the app at appPath, or "".
+func appExecutablePath(appPath string) string {
+	cPath := C.CString(appPath)
+	defer C.free(unsafe.Pointer(cPath))
+	p := C.AppExecutablePath(cPath)
+	if p == nil {
+		return ""
+	}
+	defer C.free(unsafe.Pointer(p))
+	return C.GoString(p)
+}
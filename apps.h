@@ -0,0 +1,22 @@
+#include <stdbool.h>
+
+// AppPathForBundleID asks LaunchServices where the app with the bundle ID is
+// installed, returning its path as a string the caller must free, or NULL if
+// it isn't installed.
+char *AppPathForBundleID(const char *bundleID);
+
+// AppExecutablePath returns the path of the executable in the app bundle at
+// appPath as a string the caller must free, or NULL if it isn't an app.
+char *AppExecutablePath(const char *appPath);
+
+// LaunchApp launches the app at appPath, or the app with bundleID when
+// appPath is NULL, passing it the nargs arguments in args. It waits for the
+// launch to finish, for at most timeoutSeconds unless that is negative, and
+// returns the app's pid, -1 when it timed out, or 0 with *error set to a
+// message the caller must free.
+int LaunchApp(const char *appPath, const char *bundleID, const char **args, int nargs, bool newInstance, bool activate, double timeoutSeconds, char **error);
+
+// OpenURLInApp opens url in the app at appPath, or the app with bundleID
+// when appPath is NULL, and returns like LaunchApp. An appPath without a
+// slash names an app in one of the Applications folders.
+int OpenURLInApp(const char *appPath, const char *bundleID, const char *url, bool activate, double timeoutSeconds, char **error);
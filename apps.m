@@ -0,0 +1,132 @@
+#import <AppKit/AppKit.h>
+#include "apps.h"
+
+char *AppPathForBundleID(const char *bundleID) {
+  @autoreleasepool {
+    NSString *identifier = [NSString stringWithUTF8String:bundleID];
+    if (identifier == nil) {
+      return NULL;
+    }
+    NSURL *url = [[NSWorkspace sharedWorkspace] URLForApplicationWithBundleIdentifier:identifier];
+    if (url == nil) {
+      return NULL;
+    }
+    return strdup([[url path] fileSystemRepresentation]);
+  }
+}
+
+char *AppExecutablePath(const char *appPath) {
+  @autoreleasepool {
+    NSBundle *bundle = [NSBundle bundleWithPath:[NSString stringWithUTF8String:appPath]];
+    NSString *path = [bundle executablePath];
+    if (path == nil) {
+      return NULL;
+    }
+    return strdup([path fileSystemRepresentation]);
+  }
+}
+
+// appURLFor returns the URL of the app at appPath, or of the app with
+// bundleID when appPath is NULL. An appPath without a slash names an app in
+// one of the Applications folders, as open -a accepts. It returns nil with
+// *error set when there is no such app.
+static NSURL *appURLFor(const char *appPath, const char *bundleID, char **error) {
+  NSWorkspace *workspace = [NSWorkspace sharedWorkspace];
+  if (appPath == NULL) {
+    NSURL *url = [workspace URLForApplicationWithBundleIdentifier:[NSString stringWithUTF8String:bundleID]];
+    if (url == nil) {
+      *error = strdup([[NSString stringWithFormat:@"no app with bundle ID %s is installed", bundleID] UTF8String]);
+    }
+    return url;
+  }
+  NSString *path = [NSString stringWithUTF8String:appPath];
+  if ([path containsString:@"/"]) {
+    return [NSURL fileURLWithPath:path];
+  }
+  if (![[path pathExtension] isEqualToString:@"app"]) {
+    path = [path stringByAppendingPathExtension:@"app"];
+  }
+  NSFileManager *files = [NSFileManager defaultManager];
+  for (NSURL *dir in [files URLsForDirectory:NSApplicationDirectory inDomains:NSAllDomainsMask]) {
+    NSURL *url = [dir URLByAppendingPathComponent:path];
+    if ([files fileExistsAtPath:[url path]]) {
+      return url;
+    }
+  }
+  *error = strdup([[NSString stringWithFormat:@"no app named %s is installed", appPath] UTF8String]);
+  return nil;
+}
+
+// waitForApp starts an open with start, which calls the handler it is given
+// when the open finished, and waits for that like LaunchApp does.
+static int waitForApp(void (^start)(void (^)(NSRunningApplication *, NSError *)), double timeoutSeconds, char **error) {
+  dispatch_semaphore_t done = dispatch_semaphore_create(0);
+  __block pid_t pid = 0;
+  __block char *message = NULL;
+  start(^(NSRunningApplication *app, NSError *err) {
+    if (err != nil) {
+      message = strdup([[err localizedDescription] UTF8String]);
+    } else {
+      pid = [app processIdentifier];
+    }
+    dispatch_semaphore_signal(done);
+  });
+  dispatch_time_t deadline = DISPATCH_TIME_FOREVER;
+  if (timeoutSeconds >= 0) {
+    deadline = dispatch_time(DISPATCH_TIME_NOW, (int64_t)(timeoutSeconds * NSEC_PER_SEC));
+  }
+  // The block keeps the semaphore and the __block variables alive when it
+  // runs after a timeout.
+  long timedOut = dispatch_semaphore_wait(done, deadline);
+  dispatch_release(done);
+  if (timedOut != 0) {
+    return -1;
+  }
+  if (message != NULL) {
+    *error = message;
+    return 0;
+  }
+  return pid;
+}
+
+int LaunchApp(const char *appPath, const char *bundleID, const char **args, int nargs, bool newInstance, bool activate, double timeoutSeconds, char **error) {
+  @autoreleasepool {
+    NSURL *appURL = appURLFor(appPath, bundleID, error);
+    if (appURL == nil) {
+      return 0;
+    }
+    NSMutableArray *arguments = [NSMutableArray arrayWithCapacity:nargs];
+    for (int i = 0; i < nargs; i++) {
+      NSString *arg = [NSString stringWithUTF8String:args[i]];
+      if (arg != nil) {
+        [arguments addObject:arg];
+      }
+    }
+    NSWorkspaceOpenConfiguration *configuration = [NSWorkspaceOpenConfiguration configuration];
+    configuration.arguments = arguments;
+    configuration.createsNewApplicationInstance = newInstance;
+    configuration.activates = activate;
+    return waitForApp(^(void (^handler)(NSRunningApplication *, NSError *)) {
+      [[NSWorkspace sharedWorkspace] openApplicationAtURL:appURL configuration:configuration completionHandler:handler];
+    }, timeoutSeconds, error);
+  }
+}
+
+int OpenURLInApp(const char *appPath, const char *bundleID, const char *url, bool activate, double timeoutSeconds, char **error) {
+  @autoreleasepool {
+    NSURL *appURL = appURLFor(appPath, bundleID, error);
+    if (appURL == nil) {
+      return 0;
+    }
+    NSURL *target = [NSURL URLWithString:[NSString stringWithUTF8String:url]];
+    if (target == nil) {
+      *error = strdup([[NSString stringWithFormat:@"%s is not a valid URL", url] UTF8String]);
+      return 0;
+    }
+    NSWorkspaceOpenConfiguration *configuration = [NSWorkspaceOpenConfiguration configuration];
+    configuration.activates = activate;
+    return waitForApp(^(void (^handler)(NSRunningApplication *, NSError *)) {
+      [[NSWorkspace sharedWorkspace] openURLs:@[ target ] withApplicationAtURL:appURL configuration:configuration completionHandler:handler];
+    }, timeoutSeconds, error);
+  }
+}
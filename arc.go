@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// openInArcSpaceScript opens a URL in a new tab of an Arc space, switching
+// the front window to the space first. Arc is brought to the front unless
+// the fourth argument is "background".
+const openInArcSpaceScript = `
+on run argv
+	set appName to item 1 of argv
+	set spaceName to item 2 of argv
+	set theURL to item 3 of argv
+	set inBackground to (item 4 of argv) is "background"
+	tell application appName
+		if (count of windows) is 0 then make new window
+		tell front window
+			tell space spaceName
+				focus
+				make new tab with properties {URL:theURL}
+			end tell
+		end tell
+		if not inBackground then activate
+	end tell
+end run
+`
+
+// Hands a URL to Arc, in the named space if one is given. Spaces belong to
+// Arc profiles, so the space also decides the profile.
+// Uses: NSWorkspace like open [-g] -a "Arc" "URL", or osascript for a space
+func openInArc(ctx context.Context, arcAppPath, space, urlStr string, background bool) error {
+	if space == "" {
+		_, err := openURLInApp(ctx, arcAppPath, "", urlStr, !background)
+		return err
+	}
+	mode := "foreground"
+	if background {
+		mode = "background"
+	}
+	cmd := exec.CommandContext(ctx, "osascript", "-e", openInArcSpaceScript, appName(arcAppPath), space, urlStr, mode)
+	if err := runLauncher(ctx, cmd); err != nil {
+		return fmt.Errorf("open in Arc space %q: %w", space, err)
+	}
+	return nil
+}
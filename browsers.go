@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Browser is a browser rules can open URLs in, in place of the one at
+// chrome_app_path.
+type Browser struct {
+	Type        string `json:"type,omitempty"`
+	AppPath     string `json:"app_path"`
+	UserDataDir string `json:"user_data_dir,omitempty"`
+}
+
+// Browser types. Chromium-based browsers and Safari open URLs in profiles,
+// Firefox in containers, and Arc in spaces.
+const (
+	browserTypeChromium = "chromium"
+	browserTypeFirefox  = "firefox"
+	browserTypeSafari   = "safari"
+	browserTypeArc      = "arc"
+)
+
+// userDataDirs are where common Chromium-based browsers keep their profiles,
+// relative to ~/Library/Application Support and keyed by app name.
+var userDataDirs = map[string]string{
+	"Google Chrome":        "Google/Chrome",
+	"Google Chrome Beta":   "Google/Chrome Beta",
+	"Google Chrome Dev":    "Google/Chrome Dev",
+	"Google Chrome Canary": "Google/Chrome Canary",
+	"Chromium":             "Chromium",
+	"Brave Browser":        "BraveSoftware/Brave-Browser",
+	"Microsoft Edge":       "Microsoft Edge",
+	"Vivaldi":              "Vivaldi",
+	"Arc":                  "Arc/User Data",
+}
+
+// appName returns the name of the app at appPath, e.g. "Brave Browser" for
+// /Applications/Brave Browser.app.
+func appName(appPath string) string {
+	return strings.TrimSuffix(filepath.Base(appPath), ".app")
+}
+
+// knownUserDataDir returns where the browser at appPath keeps its profiles,
+// or "" if it isn't a browser listed in userDataDirs.
+func knownUserDataDir(appPath string) string {
+	dir, ok := userDataDirs[appName(appPath)]
+	if !ok {
+		return ""
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "Library", "Application Support", dir)
+}
+
+// checkBrowsers validates the browsers setting and fills in the user data
+// directories of browsers it knows.
+func checkBrowsers(browsers map[string]Browser) error {
+	for name, b := range browsers {
+		if name == "" {
+			return fmt.Errorf("browsers: name is empty")
+		}
+		if b.AppPath == "" {
+			return fmt.Errorf("browsers %q: app_path is required", name)
+		}
+		switch b.Type {
+		case "":
+			b.Type = browserTypeChromium
+		case browserTypeChromium, browserTypeFirefox, browserTypeSafari, browserTypeArc:
+		default:
+			return fmt.Errorf("browsers %q: unknown type %q", name, b.Type)
+		}
+		browsers[name] = b
+		if b.UserDataDir == "" && b.Type == browserTypeChromium {
+			b.UserDataDir = knownUserDataDir(b.AppPath)
+			browsers[name] = b
+		}
+	}
+	return nil
+}
+
+// checkFallbackBrowsers checks that the fallback_browsers are defined in
+// browsers.
+func checkFallbackBrowsers(names []string, browsers map[string]Browser) error {
+	for _, name := range names {
+		if _, ok := browsers[name]; !ok {
+			return fmt.Errorf("fallback_browsers: browser %q isn't defined in browsers", name)
+		}
+	}
+	return nil
+}
+
+// chromeChannels are the app names of Chrome's prerelease channels.
+var chromeChannels = map[string]string{
+	"beta":   "Google Chrome Beta",
+	"dev":    "Google Chrome Dev",
+	"canary": "Google Chrome Canary",
+}
+
+// channelBrowser returns the browser name a rule's channel stands for, and
+// the browser, found in /Applications or ~/Applications. The stable channel
+// is chrome_app_path, named "". A channel that isn't installed is expected
+// in /Applications, so opening URLs in it fails with a clear error.
+func channelBrowser(channel string) (string, Browser, error) {
+	if channel == "stable" {
+		return "", Browser{}, nil
+	}
+	app, ok := chromeChannels[channel]
+	if !ok {
+		return "", Browser{}, fmt.Errorf("unknown channel %q, want stable, beta, dev, or canary", channel)
+	}
+	appPath := filepath.Join("/Applications", app+".app")
+	if home, err := os.UserHomeDir(); err == nil {
+		if p := filepath.Join(home, "Applications", app+".app"); fileExists(p) && !fileExists(appPath) {
+			appPath = p
+		}
+	}
+	b := Browser{Type: browserTypeChromium, AppPath: appPath, UserDataDir: knownUserDataDir(appPath)}
+	return "chrome-" + channel, b, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// browser looks up the browser named name in browsers, then among the Chrome
+// channels rules use.
+func (config Config) browser(name string) (Browser, bool) {
+	if b, ok := config.Browsers[name]; ok {
+		return b, true
+	}
+	b, ok := config.channels[name]
+	return b, ok
+}
+
+// browserAppPath returns the app of the browser named name, or
+// chrome_app_path for "".
+func (config Config) browserAppPath(name string) string {
+	if b, ok := config.browser(name); ok {
+		return b.AppPath
+	}
+	return config.ChromeAppPath
+}
+
+// browserBundleID returns the bundle ID to launch the browser named name by,
+// which is chrome_bundle_id for "" and "" for browsers launched by path.
+func (config Config) browserBundleID(name string) string {
+	if name == "" {
+		return config.ChromeBundleID
+	}
+	return ""
+}
+
+// browserType returns the type of the browser named name, which is
+// chromium for "".
+func (config Config) browserType(name string) string {
+	if b, ok := config.browser(name); ok {
+		return b.Type
+	}
+	return browserTypeChromium
+}
+
+// browserUserDataDir returns where the browser named name keeps its
+// profiles, or Chrome's user data directory for "". It is "" for browsers
+// whose directory is unknown.
+func (config Config) browserUserDataDir(name string) string {
+	if b, ok := config.browser(name); ok {
+		return b.UserDataDir
+	}
+	return defaultChromeUserDataDir()
+}
@@ -0,0 +1,63 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework EventKit
+#include <stdlib.h>
+#include "calendar.h"
+*/
+import "C"
+
+import (
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// calendarLeadTime is how long before an event starts its calendar counts as
+// busy, since meeting links are usually opened a few minutes early.
+const calendarLeadTime = 10 * time.Minute
+
+// currentEventCalendars returns the titles and account names of the
+// calendars with an event in progress or about to start. All-day events
+// don't count.
+func currentEventCalendars() []string {
+	names := C.CurrentEventCalendars(C.double(calendarLeadTime.Seconds()))
+	if names == nil {
+		return nil
+	}
+	defer C.free(unsafe.Pointer(names))
+	s := C.GoString(names)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// eventCalendars returns the calendars busy when req arrived, looking them
+// up the first time a rule asks for them.
+func (req *routeRequest) eventCalendars() []string {
+	if req.calendars == nil {
+		req.calendars = currentEventCalendars()
+		if req.calendars == nil {
+			req.calendars = []string{}
+		}
+	}
+	return req.calendars
+}
+
+// matchCalendars reports whether one of the calendar titles or account
+// names in want is busy.
+func matchCalendars(want, busy []string) bool {
+	for _, w := range want {
+		for _, b := range busy {
+			if strings.EqualFold(w, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func requestCalendarAccess() {
+	C.RequestCalendarAccess()
+}
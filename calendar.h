@@ -0,0 +1,8 @@
+// CurrentEventCalendars returns the calendars and accounts of the events in
+// progress or starting within leadSeconds, one name per line, as a string the
+// caller must free.
+char *CurrentEventCalendars(double leadSeconds);
+
+// RequestCalendarAccess asks for access to the user's calendars unless it
+// was granted or denied before.
+void RequestCalendarAccess(void);
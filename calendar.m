@@ -0,0 +1,44 @@
+#import <EventKit/EventKit.h>
+#include "calendar.h"
+
+static EKEventStore *sharedEventStore(void) {
+  static EKEventStore *store;
+  static dispatch_once_t once;
+  dispatch_once(&once, ^{
+    store = [[EKEventStore alloc] init];
+  });
+  return store;
+}
+
+char *CurrentEventCalendars(double leadSeconds) {
+  @autoreleasepool {
+    EKEventStore *store = sharedEventStore();
+    NSDate *now = [NSDate date];
+    NSPredicate *predicate = [store predicateForEventsWithStartDate:now
+                                                            endDate:[now dateByAddingTimeInterval:leadSeconds]
+                                                          calendars:nil];
+    NSMutableArray *names = [NSMutableArray array];
+    for (EKEvent *event in [store eventsMatchingPredicate:predicate]) {
+      if (event.allDay) {
+        continue;
+      }
+      [names addObject:event.calendar.title];
+      if (event.calendar.source.title != nil) {
+        [names addObject:event.calendar.source.title];
+      }
+    }
+    return strdup([[names componentsJoinedByString:@"\n"] UTF8String]);
+  }
+}
+
+void RequestCalendarAccess(void) {
+  if ([EKEventStore authorizationStatusForEntityType:EKEntityTypeEvent] != EKAuthorizationStatusNotDetermined) {
+    return;
+  }
+  EKEventStore *store = sharedEventStore();
+  if (@available(macOS 14.0, *)) {
+    [store requestFullAccessToEventsWithCompletion:^(BOOL granted, NSError *error) {}];
+  } else {
+    [store requestAccessToEntityType:EKEntityTypeEvent completion:^(BOOL granted, NSError *error) {}];
+  }
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// canonicalizer rewrites an alternative form of a page, such as its AMP
+// version, to the page itself, returning "" for other URLs.
+type canonicalizer struct {
+	name         string
+	canonicalize func(u *url.URL, host string) string
+}
+
+// canonicalizers are the rewrites understood by the canonicalize setting,
+// all of which are off unless switched on.
+var canonicalizers = []canonicalizer{
+	{"amp", canonicalAMP},
+	{"mobile", canonicalMobile},
+}
+
+// canonicalAMP turns links into Google's and the AMP Project's caches back
+// into links to the publisher, e.g. https://www.google.com/amp/s/example.com/a
+// into https://example.com/a.
+func canonicalAMP(u *url.URL, host string) string {
+	var rest string
+	if site, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil && strings.HasPrefix(site, "google.") {
+		var ok bool
+		if rest, ok = strings.CutPrefix(u.EscapedPath(), "/amp/"); !ok {
+			return ""
+		}
+	} else if strings.HasSuffix(host, ".cdn.ampproject.org") {
+		// /c/ is a page, /v/ a page in the viewer, and /i/ an image.
+		p := u.EscapedPath()
+		if len(p) < 3 || p[0] != '/' || !strings.Contains("cvi", p[1:2]) || p[2] != '/' {
+			return ""
+		}
+		rest = p[3:]
+	} else {
+		return ""
+	}
+	scheme := "http://"
+	if s, ok := strings.CutPrefix(rest, "s/"); ok {
+		scheme, rest = "https://", s
+	}
+	if rest == "" {
+		return ""
+	}
+	canonical := scheme + rest
+	if u.RawQuery != "" {
+		canonical += "?" + u.RawQuery
+	}
+	return canonical
+}
+
+// mobileLabels are host labels sites use for their mobile versions.
+var mobileLabels = map[string]bool{"m": true, "mobile": true, "touch": true, "mbasic": true}
+
+// canonicalMobile drops mobile labels from the host, so m.facebook.com
+// becomes facebook.com and en.m.wikipedia.org becomes en.wikipedia.org.
+// Labels of the registrable domain itself are kept.
+func canonicalMobile(u *url.URL, host string) string {
+	site, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil || site == host {
+		return ""
+	}
+	var labels []string
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."+site), ".") {
+		if !mobileLabels[label] {
+			labels = append(labels, label)
+		}
+	}
+	canonical := strings.Join(append(labels, site), ".")
+	if canonical == host {
+		return ""
+	}
+	c := *u
+	c.Host = canonical
+	if port := u.Port(); port != "" {
+		c.Host += ":" + port
+	}
+	return c.String()
+}
+
+// compileCanonicalizers returns the canonicalizers switched on in settings.
+func compileCanonicalizers(settings map[string]bool) ([]canonicalizer, error) {
+	known := map[string]bool{}
+	for _, c := range canonicalizers {
+		known[c.name] = true
+	}
+	for name := range settings {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown canonicalize key %q", name)
+		}
+	}
+	var enabled []canonicalizer
+	for _, c := range canonicalizers {
+		if settings[c.name] {
+			enabled = append(enabled, c)
+		}
+	}
+	return enabled, nil
+}
+
+// canonicalURL applies the enabled canonicalizers to raw in turn.
+func canonicalURL(raw string, enabled []canonicalizer) string {
+	for _, c := range enabled {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return raw
+		}
+		if canonical := c.canonicalize(u, canonicalHost(u.Hostname())); canonical != "" && isWebURL(canonical) {
+			raw = canonical
+		}
+	}
+	return raw
+}
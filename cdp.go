@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// cdpOrigin is the Origin the router connects to Chrome's DevTools with.
+	// Chrome only accepts origins given in --remote-allow-origins, and no web
+	// page can have this one.
+	cdpOrigin = "http://chrome-profile-router.invalid"
+
+	// cdpLearnTimeout bounds how long to look for the tab of a URL opened the
+	// usual way, to learn its profile's browser context.
+	cdpLearnTimeout = 3 * time.Second
+)
+
+// cdpFlags are the flags that make Chrome listen for the DevTools protocol
+// on a free port, which it writes to DevToolsActivePort in its user data
+// directory.
+var cdpFlags = []string{"--remote-debugging-port=0", "--remote-allow-origins=" + cdpOrigin}
+
+// cdpContexts remembers the browser context of each profile of a running
+// Chrome, keyed by the address of its DevTools endpoint, which changes
+// whenever Chrome restarts. The protocol doesn't say which profile a context
+// belongs to, so it is learned from the tabs the router opens.
+var cdpContexts = struct {
+	mu  sync.Mutex
+	ids map[[2]string]string // endpoint, profile -> browser context ID
+}{ids: map[[2]string]string{}}
+
+// usesCDP reports whether t is opened through the DevTools protocol. Launch
+// options that only exist as command-line flags, and throwaway profiles,
+// need Chrome to be launched.
+func (t launchTarget) usesCDP() bool {
+	return t.launchMode == LaunchModeCDP && !t.incognito && !t.guest && !t.appMode && !t.kiosk && t.profile != ephemeralProfile
+}
+
+// openInChromeCDP opens urlStr as a tab in a window of t's profile in the
+// running Chrome whose user data directory is dataDir, so the windows stay
+// as they are. When Chrome isn't listening for the protocol, or the
+// profile's browser context isn't known yet, Chrome is launched the usual
+// way, with the flags that make the next URL go through the protocol.
+func openInChromeCDP(ctx context.Context, chromeAppPath, bundleID, dataDir, urlStr string, t launchTarget, flags []string) error {
+	existing := map[string]bool{}
+	if conn, endpoint, err := dialCDP(ctx, dataDir); err != nil {
+		if logger != nil {
+			logger.Debugf("No DevTools endpoint for %s, launching Chrome: %v", dataDir, err)
+		}
+	} else {
+		defer conn.close()
+		if id, ok := cdpContextID(endpoint, t.profile); ok {
+			if t.reuseTab != "" {
+				if tab, ok := conn.findTab(id, urlStr, t.reuseTab); ok {
+					if err := conn.activateTarget(tab.TargetID); err == nil {
+						if logger != nil {
+							logger.Debugf("Focused tab %s already showing %s", tab.TargetID, tab.URL)
+						}
+						if t.background {
+							return nil
+						}
+						return focusChrome(ctx, chromeAppPath)
+					}
+				}
+			}
+			targetID, err := conn.createTarget(urlStr, id, t.newWindow)
+			if err == nil {
+				if logger != nil {
+					logger.Debugf("Opened %s in tab %s through DevTools", urlStr, targetID)
+				}
+				if t.tabGroup.Title != "" {
+					conn.joinTabGroup(id, urlStr, t.tabGroup)
+				}
+				if t.background {
+					return nil
+				}
+				return focusChrome(ctx, chromeAppPath)
+			}
+			if logger != nil {
+				logger.Debugf("Failed to open %s through DevTools, launching Chrome: %v", urlStr, err)
+			}
+		}
+		// Tabs open before the launch can't be the one it opens.
+		targets, _ := conn.targets()
+		for _, target := range targets {
+			existing[target.TargetID] = true
+		}
+	}
+	if err := openInChrome(ctx, chromeAppPath, bundleID, urlStr, t, append(flags, cdpFlags...)); err != nil {
+		return err
+	}
+	go learnCDPContext(dataDir, t.profile, urlStr, t.tabGroup, existing)
+	return nil
+}
+
+func cdpContextID(endpoint, profile string) (string, bool) {
+	cdpContexts.mu.Lock()
+	defer cdpContexts.mu.Unlock()
+	id, ok := cdpContexts.ids[[2]string{endpoint, profile}]
+	return id, ok
+}
+
+func setCDPContextID(endpoint, profile, id string) {
+	cdpContexts.mu.Lock()
+	defer cdpContexts.mu.Unlock()
+	cdpContexts.ids[[2]string{endpoint, profile}] = id
+}
+
+// learnCDPContext learns the browser context of profile from the tab urlStr
+// was just opened in by launching Chrome, waiting for a Chrome that only
+// just started to write its DevTools endpoint, and puts the tab in g if it
+// has a title. Tabs in existing are skipped.
+func learnCDPContext(dataDir, profile, urlStr string, g TabGroup, existing map[string]bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), cdpLearnTimeout)
+	defer cancel()
+	for ctx.Err() == nil {
+		if conn, endpoint, err := dialCDP(ctx, dataDir); err == nil {
+			if id := conn.learnContext(ctx, endpoint, profile, urlStr, existing); id != "" && g.Title != "" {
+				conn.joinTabGroup(id, urlStr, g)
+			}
+			conn.close()
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// cdpConn is a connection to the browser endpoint of Chrome's DevTools
+// protocol.
+type cdpConn struct {
+	ws     *websocket.Conn
+	nextID int
+}
+
+// dialCDP connects to the DevTools endpoint of the Chrome using dataDir,
+// returning the connection and the endpoint's address.
+func dialCDP(ctx context.Context, dataDir string) (*cdpConn, string, error) {
+	if dataDir == "" {
+		return nil, "", fmt.Errorf("the browser's user data directory is unknown")
+	}
+	data, err := os.ReadFile(filepath.Join(dataDir, "DevToolsActivePort"))
+	if err != nil {
+		return nil, "", err
+	}
+	port, path, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+	endpoint := "ws://127.0.0.1:" + strings.TrimSpace(port) + strings.TrimSpace(path)
+	config, err := websocket.NewConfig(endpoint, cdpOrigin)
+	if err != nil {
+		return nil, "", err
+	}
+	// A stale DevToolsActivePort from a Chrome that quit points at a closed
+	// port, which fails right away.
+	ws, err := config.DialContext(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		ws.SetDeadline(deadline)
+	}
+	return &cdpConn{ws: ws}, endpoint, nil
+}
+
+func (c *cdpConn) close() {
+	c.ws.Close()
+}
+
+// call sends a protocol command and decodes its result into result,
+// skipping the events Chrome sends in between.
+func (c *cdpConn) call(method string, params, result any) error {
+	c.nextID++
+	id := c.nextID
+	if err := websocket.JSON.Send(c.ws, map[string]any{"id": id, "method": method, "params": params}); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	for {
+		var resp struct {
+			ID     int             `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := websocket.JSON.Receive(c.ws, &resp); err != nil {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+		switch {
+		case resp.ID != id:
+			continue
+		case resp.Error != nil:
+			return fmt.Errorf("%s: %s", method, resp.Error.Message)
+		case result == nil:
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	}
+}
+
+// cdpTarget is a tab or other target of the running Chrome.
+type cdpTarget struct {
+	TargetID         string `json:"targetId"`
+	Type             string `json:"type"`
+	URL              string `json:"url"`
+	BrowserContextID string `json:"browserContextId"`
+}
+
+func (c *cdpConn) targets() ([]cdpTarget, error) {
+	var result struct {
+		TargetInfos []cdpTarget `json:"targetInfos"`
+	}
+	err := c.call("Target.getTargets", map[string]any{}, &result)
+	return result.TargetInfos, err
+}
+
+// createTarget opens urlStr in a new tab of the browser context, in a window
+// of its own with newWindow, and returns the tab's target ID.
+func (c *cdpConn) createTarget(urlStr, contextID string, newWindow bool) (string, error) {
+	var result struct {
+		TargetID string `json:"targetId"`
+	}
+	params := map[string]any{"url": urlStr, "browserContextId": contextID, "newWindow": newWindow}
+	if err := c.call("Target.createTarget", params, &result); err != nil {
+		return "", err
+	}
+	return result.TargetID, c.activateTarget(result.TargetID)
+}
+
+// activateTarget brings a tab to the front of its window.
+func (c *cdpConn) activateTarget(targetID string) error {
+	return c.call("Target.activateTarget", map[string]any{"targetId": targetID}, nil)
+}
+
+// findTab returns a tab of the browser context already showing urlStr, the
+// same one with TabReuseURL or one on the same origin with TabReuseOrigin.
+func (c *cdpConn) findTab(contextID, urlStr string, reuse TabReuse) (cdpTarget, bool) {
+	targets, err := c.targets()
+	if err != nil {
+		return cdpTarget{}, false
+	}
+	for _, t := range targets {
+		if t.Type != "page" || t.BrowserContextID != contextID {
+			continue
+		}
+		if reuse == TabReuseOrigin && sameOrigin(t.URL, urlStr) || sameCDPURL(t.URL, urlStr) {
+			return t, true
+		}
+	}
+	return cdpTarget{}, false
+}
+
+// sameOrigin reports whether two URLs have the same scheme, host, and port.
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Host != "" && strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// learnContext looks for the tab urlStr was just opened in, which is in
+// profile, and remembers and returns its browser context, giving up with ""
+// when ctx is done.
+func (c *cdpConn) learnContext(ctx context.Context, endpoint, profile, urlStr string, existing map[string]bool) string {
+	for ctx.Err() == nil {
+		targets, err := c.targets()
+		if err != nil {
+			return ""
+		}
+		for _, t := range targets {
+			if t.Type == "page" && t.BrowserContextID != "" && !existing[t.TargetID] && sameCDPURL(t.URL, urlStr) {
+				if logger != nil {
+					logger.Debugf("Profile %q is browser context %s of %s", profile, t.BrowserContextID, endpoint)
+				}
+				setCDPContextID(endpoint, profile, t.BrowserContextID)
+				return t.BrowserContextID
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return ""
+}
+
+// sameCDPURL reports whether a tab's URL is urlStr, allowing for the
+// trailing slash Chrome adds to bare hosts.
+func sameCDPURL(tabURL, urlStr string) bool {
+	return strings.TrimSuffix(tabURL, "/") == strings.TrimSuffix(urlStr, "/")
+}
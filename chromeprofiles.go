@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// chromeProfile describes a profile listed in Chrome's Local State file.
+type chromeProfile struct {
+	Directory string // e.g. "Profile 3"
+	Name      string // display name shown in Chrome's profile menu
+	Email     string // signed-in account, if any
+	Picture   string // path of the account's picture, "" if there is none
+	Color     int    // fill color of Chrome's avatar as 0xRRGGBB, -1 if unknown
+}
+
+// Label returns a human friendly description of the profile.
+func (p chromeProfile) Label() string {
+	label := p.DisplayName()
+	if p.Email != "" {
+		label += " <" + p.Email + ">"
+	}
+	return label
+}
+
+// DisplayName returns the profile's name, or its directory if it has none.
+func (p chromeProfile) DisplayName() string {
+	if p.Name == "" {
+		return p.Directory
+	}
+	return p.Name
+}
+
+func defaultChromeUserDataDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "Library", "Application Support", "Google", "Chrome")
+}
+
+// readChromeProfiles lists the profiles of the Chrome user data directory,
+// sorted by directory name with "Default" first.
+func readChromeProfiles(userDataDir string) ([]chromeProfile, error) {
+	data, err := os.ReadFile(filepath.Join(userDataDir, "Local State"))
+	if err != nil {
+		return nil, fmt.Errorf("read Chrome Local State: %w", err)
+	}
+
+	var state struct {
+		Profile struct {
+			InfoCache map[string]struct {
+				Name               string `json:"name"`
+				GaiaName           string `json:"gaia_name"`
+				IsUsingDefaultName bool   `json:"is_using_default_name"`
+				UserName           string `json:"user_name"`
+				PictureFileName    string `json:"gaia_picture_file_name"`
+				AvatarColor        *int64 `json:"default_avatar_fill_color"`
+			} `json:"info_cache"`
+		} `json:"profile"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parse Chrome Local State: %w", err)
+	}
+
+	var profiles []chromeProfile
+	for dir, info := range state.Profile.InfoCache {
+		p := chromeProfile{Directory: dir, Name: info.Name, Email: info.UserName, Color: -1}
+		// Until it is renamed, Chrome shows a signed-in profile by its
+		// account's name rather than "Person 1".
+		if info.IsUsingDefaultName && info.GaiaName != "" {
+			p.Name = info.GaiaName
+		}
+		if info.PictureFileName != "" {
+			if picture := filepath.Join(userDataDir, dir, info.PictureFileName); fileExists(picture) {
+				p.Picture = picture
+			}
+		}
+		if info.AvatarColor != nil {
+			// Chrome stores colors as signed ARGB.
+			p.Color = int(*info.AvatarColor & 0xffffff)
+		}
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		if (profiles[i].Directory == "Default") != (profiles[j].Directory == "Default") {
+			return profiles[i].Directory == "Default"
+		}
+		return profiles[i].Directory < profiles[j].Directory
+	})
+	return profiles, nil
+}
+
+// chromeProfileExists reports whether the profile directory dir exists in
+// userDataDir. When the user data directory itself can't be found, e.g.
+// because Chrome keeps it elsewhere, the profile is assumed to exist.
+func chromeProfileExists(userDataDir, dir string) bool {
+	if _, err := os.Stat(userDataDir); err != nil {
+		return true
+	}
+	info, err := os.Stat(filepath.Join(userDataDir, dir))
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// exitCode is returned by a command that has already reported its failure,
+// and makes the process exit with the code.
+type exitCode int
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(c))
+}
+
+// exitWith turns the exit code of a run function into the command's error.
+func exitWith(code int) error {
+	if code == 0 {
+		return nil
+	}
+	return exitCode(code)
+}
+
+// newRootCommand builds the command line. Without a subcommand the router
+// runs as the app, which is how Launch Services starts it to handle URLs.
+func newRootCommand() *cobra.Command {
+	var configFlag string
+	configPath := func() string { return resolveConfigPath(configFlag) }
+
+	root := &cobra.Command{
+		Use:   "chrome-profile-router",
+		Short: "Open links in the right Chrome profile",
+		Args:  cobra.NoArgs,
+		// Errors from a command's own work are reported by the command;
+		// only wrong usage needs the usage text. Commands log warnings to
+		// standard error, until serve opens the log file.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			cmd.SilenceUsage = true
+			logger = logrus.New()
+			logger.SetOutput(os.Stderr)
+			logger.SetLevel(logrus.WarnLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runServe(configPath()))
+		},
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().StringVar(&configFlag, "config", "", "path to the config file (overrides $"+configPathEnv+")")
+	root.PersistentFlags().BoolVar(&strictConfig, "strict", false, "reject unknown config keys")
+
+	root.AddCommand(&cobra.Command{
+		Use:   "serve",
+		Short: "Run the router, as the app does when it starts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runServe(configPath()))
+		},
+	})
+	root.AddCommand(&cobra.Command{
+		Use:   "route <url>...",
+		Short: "Open URLs through the router, as if they were clicked",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runRoute(args, configPath()))
+		},
+	})
+	root.AddCommand(&cobra.Command{
+		Use:   "test <url>...",
+		Short: "Show where URLs would open and which rule decides, without opening them",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runTest(args, configPath()))
+		},
+	})
+	root.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show whether the router runs and what it routes by",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runStatus(configPath()))
+		},
+	})
+	var lines int
+	var follow bool
+	logs := &cobra.Command{
+		Use:   "logs",
+		Short: "Print the end of the log file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runLogs(lines, follow, configPath()))
+		},
+	}
+	logs.Flags().IntVarP(&lines, "lines", "n", 50, "number of lines to print")
+	logs.Flags().BoolVarP(&follow, "follow", "f", false, "keep printing lines as they are logged")
+	root.AddCommand(logs)
+	root.AddCommand(newConfigCommand(configPath))
+	root.AddCommand(&cobra.Command{
+		Use:   "init",
+		Short: "Write a config by answering a few questions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runInit(configPath()))
+		},
+	})
+
+	var clearRuleSet bool
+	use := &cobra.Command{
+		Use:   "use [<rule set>]",
+		Short: "List the rule sets, or choose the one to route by",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runUse(args, clearRuleSet, configPath()))
+		},
+	}
+	use.Flags().BoolVar(&clearRuleSet, "clear", false, "go back to active_rule_set from the config")
+	root.AddCommand(use)
+	root.AddCommand(&cobra.Command{
+		Use:   "tags [enable <tag>... | disable <tag>... | reset]",
+		Short: "List rule tags, or turn the rules with a tag on and off",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runTags(args, configPath()))
+		},
+	})
+	root.AddCommand(&cobra.Command{
+		Use:   "pause",
+		Short: "Open every link in Chrome's last used profile until resumed",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runPause(args, configPath(), true))
+		},
+	})
+	root.AddCommand(&cobra.Command{
+		Use:   "resume",
+		Short: "Route links by the rules again",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runPause(args, configPath(), false))
+		},
+	})
+	var clearOverride bool
+	override := &cobra.Command{
+		Use:   "override [<profile> <duration>]",
+		Short: "Show the override, or send every link to one profile for a while",
+		Args:  cobra.RangeArgs(0, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runOverride(args, clearOverride, configPath()))
+		},
+	}
+	override.Flags().BoolVar(&clearOverride, "clear", false, "end the override")
+	root.AddCommand(override)
+	root.AddCommand(&cobra.Command{
+		Use:   "reopen [<profile> [<n>]]",
+		Short: "List the recent links, or open one again in another profile",
+		Args:  cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runReopen(args, configPath()))
+		},
+	})
+	root.AddCommand(&cobra.Command{
+		Use:   "open-all <url> [<profile set>]",
+		Short: "Open a URL in every Chrome profile, or in those of a profile set",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runOpenAll(args, configPath()))
+		},
+	})
+	return root
+}
+
+// newConfigCommand builds the config subcommands, which check, convert,
+// and analyze the config file.
+func newConfigCommand(configPath func() string) *cobra.Command {
+	config := &cobra.Command{
+		Use:   "config",
+		Short: "Check, import, and export the config",
+	}
+	config.AddCommand(&cobra.Command{
+		Use:   "validate",
+		Short: "Check the config against its schema",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runConfigValidate(configPath()))
+		},
+	})
+	config.AddCommand(&cobra.Command{
+		Use:   "lint",
+		Short: "Report duplicate and shadowed rules",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runConfigLint(configPath()))
+		},
+	})
+	config.AddCommand(&cobra.Command{
+		Use:   "overlap [<url file>]",
+		Short: "Report rules competing for the URLs in a file, one per line, or standard input",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := ""
+			if len(args) == 1 {
+				path = args[0]
+			}
+			return exitWith(runConfigOverlap(path, configPath()))
+		},
+	})
+	var from string
+	importCmd := &cobra.Command{
+		Use:   "import --from <tool> <file>",
+		Short: "Translate another tool's config into rules",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runConfigImport(from, args[0]))
+		},
+	}
+	importCmd.Flags().StringVar(&from, "from", "", "tool to import from ("+strings.Join(importerNames(), ", ")+")")
+	importCmd.MarkFlagRequired("from")
+	config.AddCommand(importCmd)
+	var to string
+	exportCmd := &cobra.Command{
+		Use:   "export --to <tool>",
+		Short: "Write the rules as another tool's config",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exitWith(runConfigExport(to, configPath()))
+		},
+	}
+	exportCmd.Flags().StringVar(&to, "to", "", "format to export to ("+strings.Join(exporterNames(), ", ")+")")
+	exportCmd.MarkFlagRequired("to")
+	config.AddCommand(exportCmd)
+	return config
+}
+
+// cliArgs drops the arguments Launch Services adds, see filterLaunchArgs,
+// and accepts the single-dash -config and -strict of earlier versions.
+func cliArgs(args []string) []string {
+	args = filterLaunchArgs(args)
+	for i, a := range args {
+		if a == "--" {
+			break
+		}
+		for _, name := range []string{"config", "strict"} {
+			if a == "-"+name || strings.HasPrefix(a, "-"+name+"=") {
+				args[i] = "-" + a
+			}
+		}
+	}
+	return args
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RuleConditions are requirements a rule places on the context a URL
+// arrives in, rather than on the URL itself. All of those set must hold.
+type RuleConditions struct {
+	SourceApps    []string      `json:"source_apps,omitempty"`
+	FrontmostApps []string      `json:"frontmost_apps,omitempty"`
+	Hours         string        `json:"hours,omitempty"`
+	Days          []string      `json:"days,omitempty"`
+	WiFiSSIDs     []string      `json:"wifi_ssids,omitempty"`
+	VPN           *VPNCondition `json:"vpn,omitempty"`
+	FocusModes    []string      `json:"focus_modes,omitempty"`
+	Calendars     []string      `json:"calendars,omitempty"`
+	ResolvesTo    []string      `json:"resolves_to,omitempty"`
+	PAC           *PACCondition `json:"pac,omitempty"`
+}
+
+// ConditionExpr combines conditions with all, any, and not. Besides the
+// combinators it takes the rule conditions and the URL conditions pattern,
+// host, site, and cidr; everything set on one expression must hold.
+type ConditionExpr struct {
+	All     []ConditionExpr `json:"all,omitempty"`
+	Any     []ConditionExpr `json:"any,omitempty"`
+	Not     *ConditionExpr  `json:"not,omitempty"`
+	Pattern string          `json:"pattern,omitempty"`
+	Host    string          `json:"host,omitempty"`
+	Site    string          `json:"site,omitempty"`
+	CIDR    string          `json:"cidr,omitempty"`
+	RuleConditions
+}
+
+// ruleCondition is a compiled condition.
+type ruleCondition func(req *routeRequest) bool
+
+// allOf returns a condition holding when all of conds hold.
+func allOf(conds []ruleCondition) ruleCondition {
+	return func(req *routeRequest) bool {
+		for _, cond := range conds {
+			if !cond(req) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// conditionalMatcher matches URLs its rule's matcher matches, as long as
+// every condition holds.
+type conditionalMatcher struct {
+	urlMatcher
+	conditions []ruleCondition
+}
+
+func (m conditionalMatcher) match(req *routeRequest) bool {
+	return m.urlMatcher.match(req) && allOf(m.conditions)(req)
+}
+
+// everyURL matches all URLs, for rules that only have conditions.
+type everyURL struct{}
+
+func (everyURL) match(*routeRequest) bool { return true }
+
+// compileConditions returns the conditions of r, including its conditions
+// expression. fold makes the expression's patterns case-insensitive.
+func compileConditions(r Rule, fold bool) ([]ruleCondition, error) {
+	conds, err := r.RuleConditions.compile()
+	if err != nil {
+		return nil, err
+	}
+	if r.Conditions != nil {
+		cond, err := r.Conditions.compile(fold)
+		if err != nil {
+			return nil, fmt.Errorf("conditions: %w", err)
+		}
+		conds = append(conds, cond)
+	}
+	return conds, nil
+}
+
+func (e ConditionExpr) compile(fold bool) (ruleCondition, error) {
+	conds, err := e.RuleConditions.compile()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range []Rule{
+		{MatchType: MatchTypeRegex, Pattern: e.Pattern},
+		{MatchType: MatchTypeHost, Host: e.Host},
+		{MatchType: MatchTypeSite, Site: e.Site},
+		{MatchType: MatchTypeCIDR, CIDR: e.CIDR},
+	} {
+		if len(r.matchValues()) == 0 {
+			continue
+		}
+		m, err := compileMatcher(r, fold)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, m.match)
+	}
+	for i, sub := range e.All {
+		cond, err := sub.compile(fold)
+		if err != nil {
+			return nil, fmt.Errorf("all %d: %w", i, err)
+		}
+		conds = append(conds, cond)
+	}
+	if len(e.Any) > 0 {
+		var alternatives []ruleCondition
+		for i, sub := range e.Any {
+			cond, err := sub.compile(fold)
+			if err != nil {
+				return nil, fmt.Errorf("any %d: %w", i, err)
+			}
+			alternatives = append(alternatives, cond)
+		}
+		conds = append(conds, func(req *routeRequest) bool {
+			return slices.ContainsFunc(alternatives, func(cond ruleCondition) bool { return cond(req) })
+		})
+	}
+	if e.Not != nil {
+		cond, err := e.Not.compile(fold)
+		if err != nil {
+			return nil, fmt.Errorf("not: %w", err)
+		}
+		conds = append(conds, func(req *routeRequest) bool { return !cond(req) })
+	}
+	return allOf(conds), nil
+}
+
+// conditionSets returns the rule conditions of r and of every expression
+// nested in its conditions.
+func (r Rule) conditionSets() []RuleConditions {
+	sets := []RuleConditions{r.RuleConditions}
+	var walk func(e *ConditionExpr)
+	walk = func(e *ConditionExpr) {
+		if e == nil {
+			return
+		}
+		sets = append(sets, e.RuleConditions)
+		for i := range e.All {
+			walk(&e.All[i])
+		}
+		for i := range e.Any {
+			walk(&e.Any[i])
+		}
+		walk(e.Not)
+	}
+	walk(r.Conditions)
+	return sets
+}
+
+func (c RuleConditions) compile() ([]ruleCondition, error) {
+	var conds []ruleCondition
+	if len(c.SourceApps) > 0 {
+		apps := c.SourceApps
+		conds = append(conds, func(req *routeRequest) bool {
+			return matchBundleID(apps, req.sourceApp)
+		})
+	}
+	if len(c.FrontmostApps) > 0 {
+		apps := c.FrontmostApps
+		conds = append(conds, func(req *routeRequest) bool {
+			return matchBundleID(apps, req.frontmostApp)
+		})
+	}
+	if c.Hours != "" {
+		windows, err := parseHours(c.Hours)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, func(req *routeRequest) bool {
+			minute := req.time.Hour()*60 + req.time.Minute()
+			return slices.ContainsFunc(windows, func(w timeWindow) bool { return w.contains(minute) })
+		})
+	}
+	if len(c.Days) > 0 {
+		days, err := parseDays(c.Days)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, func(req *routeRequest) bool {
+			return days[req.time.Weekday()]
+		})
+	}
+	if len(c.WiFiSSIDs) > 0 {
+		ssids := c.WiFiSSIDs
+		conds = append(conds, func(req *routeRequest) bool {
+			ssid := req.wifiSSID()
+			return ssid != "" && slices.Contains(ssids, ssid)
+		})
+	}
+	if len(c.FocusModes) > 0 {
+		names := c.FocusModes
+		conds = append(conds, func(req *routeRequest) bool {
+			return matchFocusMode(names, req.focusMode())
+		})
+	}
+	if len(c.Calendars) > 0 {
+		calendars := c.Calendars
+		conds = append(conds, func(req *routeRequest) bool {
+			return matchCalendars(calendars, req.eventCalendars())
+		})
+	}
+	if len(c.ResolvesTo) > 0 {
+		ranges, err := parseResolveRanges(c.ResolvesTo)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, func(req *routeRequest) bool {
+			return slices.ContainsFunc(req.hostAddrs(), ranges.contains)
+		})
+	}
+	if c.PAC != nil {
+		proxied, err := c.PAC.compile()
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, proxied)
+	}
+	if c.VPN != nil {
+		connected, err := c.VPN.compile()
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, func(*routeRequest) bool { return connected() })
+	}
+	return conds, nil
+}
+
+// requestConditionAccess asks for the permissions the conditions used by cfg
+// need. macOS only prompts the first time; later calls do nothing.
+func requestConditionAccess(cfg Config) {
+	var location, calendars bool
+	for _, r := range cfg.Rules {
+		for _, c := range r.conditionSets() {
+			location = location || len(c.WiFiSSIDs) > 0
+			calendars = calendars || len(c.Calendars) > 0
+		}
+	}
+	if location {
+		requestLocationAccess()
+	}
+	if calendars {
+		requestCalendarAccess()
+	}
+}
+
+// conditionKeys returns the config keys of the conditions set on r.
+func (r Rule) conditionKeys() []string {
+	keys := r.RuleConditions.keys()
+	if r.Conditions != nil {
+		keys = append(keys, "conditions")
+	}
+	return keys
+}
+
+func (c RuleConditions) keys() []string {
+	var keys []string
+	if len(c.SourceApps) > 0 {
+		keys = append(keys, "source_apps")
+	}
+	if len(c.FrontmostApps) > 0 {
+		keys = append(keys, "frontmost_apps")
+	}
+	if c.Hours != "" {
+		keys = append(keys, "hours")
+	}
+	if len(c.Days) > 0 {
+		keys = append(keys, "days")
+	}
+	if len(c.WiFiSSIDs) > 0 {
+		keys = append(keys, "wifi_ssids")
+	}
+	if c.VPN != nil {
+		keys = append(keys, "vpn")
+	}
+	if len(c.FocusModes) > 0 {
+		keys = append(keys, "focus_modes")
+	}
+	if len(c.Calendars) > 0 {
+		keys = append(keys, "calendars")
+	}
+	if len(c.ResolvesTo) > 0 {
+		keys = append(keys, "resolves_to")
+	}
+	if c.PAC != nil {
+		keys = append(keys, "pac")
+	}
+	return keys
+}
+
+// conditionKey identifies the conditions of r, so rules with equal keys apply
+// under the same circumstances.
+func (r Rule) conditionKey() string {
+	sorted := func(values []string) []string {
+		return slices.Sorted(slices.Values(lowerAll(values)))
+	}
+	data, _ := json.Marshal([]interface{}{
+		sorted(r.SourceApps), sorted(r.FrontmostApps), r.Hours, sorted(r.Days),
+		slices.Sorted(slices.Values(r.WiFiSSIDs)), r.VPN, sorted(r.FocusModes), sorted(r.Calendars),
+		sorted(r.ResolvesTo), r.PAC, r.Conditions,
+	})
+	return string(data)
+}
+
+// matchBundleID reports whether id is one of the bundle identifiers in ids.
+// Bundle identifiers are compared case-insensitively, like LaunchServices
+// does.
+func matchBundleID(ids []string, id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, want := range ids {
+		if strings.EqualFold(want, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// timeWindow is a range of minutes since midnight. Windows whose end comes
+// before their start run past midnight.
+type timeWindow struct {
+	start, end int
+}
+
+func (w timeWindow) contains(minute int) bool {
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// parseHours parses a comma-separated list of "HH:MM-HH:MM" windows.
+func parseHours(s string) ([]timeWindow, error) {
+	var windows []timeWindow
+	for _, part := range strings.Split(s, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid hours %q: want HH:MM-HH:MM", part)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hours %q: %w", part, err)
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hours %q: %w", part, err)
+		}
+		windows = append(windows, timeWindow{start: start, end: end})
+	}
+	return windows, nil
+}
+
+// parseClock returns the minutes since midnight of an "HH:MM" time. "24:00"
+// is accepted as the end of the day.
+func parseClock(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) >= 3 {
+		if d, ok := weekdays[s[:3]]; ok && strings.HasPrefix(strings.ToLower(d.String()), s) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day %q", s)
+}
+
+// parseDays parses day names such as "mon" or "Monday" and ranges such as
+// "mon-fri" into the set of days they cover.
+func parseDays(days []string) ([7]bool, error) {
+	var set [7]bool
+	for _, day := range days {
+		from, to, isRange := strings.Cut(day, "-")
+		start, err := parseWeekday(from)
+		if err != nil {
+			return set, err
+		}
+		end := start
+		if isRange {
+			if end, err = parseWeekday(to); err != nil {
+				return set, err
+			}
+		}
+		for d := start; ; d = (d + 1) % 7 {
+			set[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return set, nil
+}
+
+// urlCriteriaOmitted reports whether r matches on conditions alone, leaving
+// out the pattern that would otherwise be required.
+func (r Rule) urlCriteriaOmitted() bool {
+	return (r.MatchType == "" || r.MatchType == MatchTypeRegex) &&
+		r.Pattern == "" && r.PatternsFile == "" && r.PatternsURL == ""
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHours(t *testing.T) {
+	for _, tt := range []struct {
+		hours   string
+		want    []timeWindow
+		in, out []int // minutes since midnight
+	}{
+		{"09:00-17:30", []timeWindow{{9 * 60, 17*60 + 30}}, []int{9 * 60, 17*60 + 29}, []int{8*60 + 59, 17*60 + 30}},
+		{"22:00-06:00", []timeWindow{{22 * 60, 6 * 60}}, []int{23 * 60, 0, 5*60 + 59}, []int{6 * 60, 12 * 60}},
+		{"08:00-12:00, 13:00-24:00", []timeWindow{{8 * 60, 12 * 60}, {13 * 60, 24 * 60}}, []int{23*60 + 59}, []int{12*60 + 30}},
+	} {
+		got, err := parseHours(tt.hours)
+		if err != nil {
+			t.Errorf("%s: %v", tt.hours, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.hours, got, tt.want)
+		}
+		contains := func(minute int) bool {
+			for _, w := range got {
+				if w.contains(minute) {
+					return true
+				}
+			}
+			return false
+		}
+		for _, m := range tt.in {
+			if !contains(m) {
+				t.Errorf("%s: minute %d not covered", tt.hours, m)
+			}
+		}
+		for _, m := range tt.out {
+			if contains(m) {
+				t.Errorf("%s: minute %d covered", tt.hours, m)
+			}
+		}
+	}
+
+	for _, hours := range []string{"9-5", "09:00", "09:00-25:00", "9am-5pm"} {
+		if _, err := parseHours(hours); err == nil {
+			t.Errorf("%s: parsed", hours)
+		}
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	days := func(ds ...time.Weekday) [7]bool {
+		var set [7]bool
+		for _, d := range ds {
+			set[d] = true
+		}
+		return set
+	}
+	for _, tt := range []struct {
+		days []string
+		want [7]bool
+	}{
+		{[]string{"mon-fri"}, days(time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday)},
+		{[]string{"Saturday", "sun"}, days(time.Saturday, time.Sunday)},
+		{[]string{"fri-mon"}, days(time.Friday, time.Saturday, time.Sunday, time.Monday)},
+		{[]string{"wed"}, days(time.Wednesday)},
+	} {
+		got, err := parseDays(tt.days)
+		if err != nil {
+			t.Errorf("%q: %v", tt.days, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.days, got, tt.want)
+		}
+	}
+
+	for _, day := range []string{"mo", "mondays", "weekend", "mon-"} {
+		if _, err := parseDays([]string{day}); err == nil {
+			t.Errorf("%q: parsed", day)
+		}
+	}
+}
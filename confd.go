@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// confDirPath returns the conf.d directory next to the main config file.
+func confDirPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "conf.d")
+}
+
+// configFragmentPaths lists the config fragments in dir in lexical order. A
+// missing directory simply yields no fragments.
+func configFragmentPaths(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read conf.d: %w", err)
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".json", ".yaml", ".yml", ".toml":
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// mergeConfigFragments merges the given fragment files into the main config
+// document. Rules are concatenated in order; any other key set in a fragment
+// replaces the value from the files before it.
+func mergeConfigFragments(data []byte, fragments []string) ([]byte, error) {
+	doc, err := decodeConfigDoc(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse config JSON: %w", err)
+	}
+
+	for _, p := range fragments {
+		fragData, err := readConfigFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("conf.d/%s: %w", filepath.Base(p), err)
+		}
+		frag, err := decodeConfigDoc(fragData)
+		if err != nil {
+			return nil, fmt.Errorf("conf.d/%s: parse config JSON: %w", filepath.Base(p), err)
+		}
+		mergeConfigDoc(doc, frag, false)
+	}
+
+	return json.Marshal(doc)
+}
+
+// mergeConfigDoc merges src into dst. Rules are concatenated, with the rules
+// from src placed first when rulesFirst is set; any other key in src replaces
+// the value in dst.
+func mergeConfigDoc(dst, src map[string]interface{}, rulesFirst bool) {
+	for k, v := range src {
+		existing, okExisting := dst[k].([]interface{})
+		added, okAdded := v.([]interface{})
+		if k == "rules" && okExisting && okAdded {
+			if rulesFirst {
+				dst[k] = append(append([]interface{}{}, added...), existing...)
+			} else {
+				dst[k] = append(existing, added...)
+			}
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+func decodeConfigDoc(data []byte) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeConfigDoc(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		dst, src   map[string]interface{}
+		rulesFirst bool
+		want       map[string]interface{}
+	}{
+		{
+			name: "src settings win",
+			dst:  map[string]interface{}{"log_level": "info", "default_profile_directory": "Default"},
+			src:  map[string]interface{}{"log_level": "debug"},
+			want: map[string]interface{}{"log_level": "debug", "default_profile_directory": "Default"},
+		},
+		{
+			name: "src rules come last",
+			dst:  map[string]interface{}{"rules": []interface{}{"a"}},
+			src:  map[string]interface{}{"rules": []interface{}{"b"}},
+			want: map[string]interface{}{"rules": []interface{}{"a", "b"}},
+		},
+		{
+			name:       "src rules come first",
+			dst:        map[string]interface{}{"rules": []interface{}{"a"}},
+			src:        map[string]interface{}{"rules": []interface{}{"b"}},
+			rulesFirst: true,
+			want:       map[string]interface{}{"rules": []interface{}{"b", "a"}},
+		},
+		{
+			name: "rules only in src",
+			dst:  map[string]interface{}{},
+			src:  map[string]interface{}{"rules": []interface{}{"b"}},
+			want: map[string]interface{}{"rules": []interface{}{"b"}},
+		},
+	} {
+		mergeConfigDoc(tt.dst, tt.src, tt.rulesFirst)
+		if !reflect.DeepEqual(tt.dst, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.dst, tt.want)
+		}
+	}
+}
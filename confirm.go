@@ -0,0 +1,34 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework Cocoa
+#include <stdlib.h>
+#include "confirm.h"
+*/
+import "C"
+
+import "unsafe"
+
+// needsConfirmation reports whether req should be confirmed before it
+// opens: trusted_source_apps is set and req didn't come from one of them.
+// Links whose sender is unknown need confirming too.
+func (config Config) needsConfirmation(req *routeRequest) bool {
+	return len(config.TrustedSourceApps) > 0 && !matchBundleID(config.TrustedSourceApps, req.sourceApp)
+}
+
+// confirmOpen asks whether to open urlStr, which came from the app with
+// the bundle ID sourceApp, and waits for the answer.
+func confirmOpen(urlStr, sourceApp string) bool {
+	source := "an unknown app"
+	if sourceApp != "" {
+		source = sourceApp
+		if p := appPathForBundleID(sourceApp); p != "" {
+			source = appName(p)
+		}
+	}
+	cURL := C.CString(urlStr)
+	defer C.free(unsafe.Pointer(cURL))
+	cSource := C.CString(source)
+	defer C.free(unsafe.Pointer(cSource))
+	return bool(C.ConfirmOpen(cURL, cSource))
+}
@@ -0,0 +1,6 @@
+#include <stdbool.h>
+
+// ConfirmOpen asks whether to open url, which was sent by source, showing
+// the URL in full. It waits for an answer, returning true to open it, and
+// must not be called on the main thread.
+bool ConfirmOpen(const char *url, const char *source);
@@ -0,0 +1,20 @@
+#import <Cocoa/Cocoa.h>
+#include "confirm.h"
+
+bool ConfirmOpen(const char *url, const char *source) {
+  __block bool open = false;
+  // The arguments stay alive while this waits for the answer.
+  dispatch_sync(dispatch_get_main_queue(), ^{
+    @autoreleasepool {
+      NSAlert *alert = [[[NSAlert alloc] init] autorelease];
+      alert.alertStyle = NSAlertStyleWarning;
+      alert.messageText = [NSString stringWithFormat:@"Open link from %@?", [NSString stringWithUTF8String:source]];
+      alert.informativeText = [NSString stringWithUTF8String:url];
+      [alert addButtonWithTitle:@"Cancel"];
+      [alert addButtonWithTitle:@"Open"];
+      [NSApp activateIgnoringOtherApps:YES];
+      open = [alert runModal] == NSAlertSecondButtonReturn;
+    }
+  });
+  return open;
+}
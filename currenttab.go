@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// currentTabScript prints the URL of the active tab in the front window of
+// the browser named by its argument.
+const currentTabScript = `
+on run argv
+	tell application (item 1 of argv)
+		if (count of windows) is 0 then error "no windows are open"
+		return URL of active tab of front window
+	end tell
+end run
+`
+
+// currentChromeTab returns the URL of the tab Chrome shows in front.
+func currentChromeTab(config Config) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "osascript", "-e", currentTabScript, appName(config.ChromeAppPath)).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	urlStr := strings.TrimSpace(string(out))
+	if urlStr == "" {
+		return "", fmt.Errorf("the front tab has no URL")
+	}
+	return urlStr, nil
+}
+
+// reopenCurrentTab shows the profile picker for the tab Chrome shows in
+// front, for the reopen tab hot key, and opens it again where the user
+// chooses.
+func reopenCurrentTab(config Config) {
+	urlStr, err := currentChromeTab(config)
+	if err != nil {
+		logger.Errorf("Failed to read Chrome's front tab: %v", err)
+		return
+	}
+	reopenWithPicker(config, urlStr)
+}
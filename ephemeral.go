@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ephemeralProfile is the profile_directory value that opens URLs in a
+// throwaway Chrome instance, with a fresh user data directory that is
+// deleted once that Chrome quits.
+const ephemeralProfile = "@ephemeral"
+
+const (
+	// ephemeralMinAge keeps a new directory from being deleted before
+	// Chrome has started and locked it.
+	ephemeralMinAge          = time.Minute
+	ephemeralCleanupInterval = 10 * time.Minute
+)
+
+func ephemeralRoot() string {
+	return filepath.Join(defaultStateDir(), "ephemeral")
+}
+
+// newEphemeralUserDataDir creates the user data directory of a throwaway
+// Chrome instance.
+func newEphemeralUserDataDir() (string, error) {
+	root := ephemeralRoot()
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return "", fmt.Errorf("create ephemeral profile: %w", err)
+	}
+	dir, err := os.MkdirTemp(root, "profile-")
+	if err != nil {
+		return "", fmt.Errorf("create ephemeral profile: %w", err)
+	}
+	return dir, nil
+}
+
+// cleanupEphemeralProfiles deletes the user data directories of throwaway
+// Chrome instances that have quit.
+func cleanupEphemeralProfiles() {
+	root := ephemeralRoot()
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		dir := filepath.Join(root, e.Name())
+		info, err := e.Info()
+		if err != nil || !e.IsDir() || time.Since(info.ModTime()) < ephemeralMinAge || chromeInstanceRunning(dir) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			if logger != nil {
+				logger.Warnf("Failed to delete ephemeral profile %s: %v", dir, err)
+			}
+			continue
+		}
+		if logger != nil {
+			logger.Debugf("Deleted ephemeral profile %s", dir)
+		}
+	}
+}
+
+// cleanupEphemeralProfilesPeriodically runs cleanupEphemeralProfiles now and
+// then every ephemeralCleanupInterval.
+func cleanupEphemeralProfilesPeriodically() {
+	for {
+		cleanupEphemeralProfiles()
+		time.Sleep(ephemeralCleanupInterval)
+	}
+}
+
+// chromeInstanceRunning reports whether a running Chrome holds the lock on
+// userDataDir. Chrome's SingletonLock is a symlink to "<hostname>-<pid>".
+func chromeInstanceRunning(userDataDir string) bool {
+	target, err := os.Readlink(filepath.Join(userDataDir, "SingletonLock"))
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(target[strings.LastIndex(target, "-")+1:])
+	if err != nil {
+		// Keep directories whose lock can't be read.
+		return true
+	}
+	return syscall.Kill(pid, 0) == nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// exporters maps the --to value of `config export` to its implementation.
+// Each returns notes about anything that couldn't be represented exactly.
+var exporters = map[string]func(w io.Writer, cfg Config) ([]string, error){
+	"finicky": exportFinicky,
+}
+
+func runConfigExport(to, configPath string) int {
+	exporter, ok := exporters[to]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "can't export to %q, only to %s\n", to, strings.Join(exporterNames(), ", "))
+		return 2
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	notes, err := exporter(os.Stdout, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export failed: %v\n", err)
+		return 1
+	}
+	for _, n := range notes {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", n)
+	}
+	return 0
+}
+
+func exporterNames() []string {
+	var names []string
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
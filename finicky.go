@@ -0,0 +1,413 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// importFinicky translates the handlers of a Finicky configuration into
+// rules. Only handlers that open Google Chrome with a profile can be
+// translated; function matchers, rewrites, and other browsers are reported.
+func importFinicky(path string) (importResult, error) {
+	var res importResult
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return res, err
+	}
+	root, err := parseJSModule(string(src))
+	if err != nil {
+		return res, fmt.Errorf("parse %s: %w", path, err)
+	}
+	config, ok := root.(*jsObject)
+	if !ok {
+		return res, fmt.Errorf("parse %s: the exported config is not an object literal", path)
+	}
+	profiles, _ := readChromeProfiles(defaultChromeUserDataDir())
+
+	if v, ok := config.get("defaultBrowser"); ok {
+		dir, problem := finickyChromeProfile(v, profiles)
+		if problem != "" {
+			res.skip("defaultBrowser: %s", problem)
+		}
+		res.DefaultProfileDirectory = dir
+	}
+	if v, ok := config.get("rewrite"); ok {
+		if rewrites, ok := v.([]jsValue); ok && len(rewrites) > 0 {
+			res.skip("rewrite: %d URL rewrites are not supported", len(rewrites))
+		}
+	}
+
+	v, _ := config.get("handlers")
+	handlers, ok := v.([]jsValue)
+	if !ok && v != nil {
+		res.skip("handlers: not an array literal")
+	}
+	for i, h := range handlers {
+		handler, ok := h.(*jsObject)
+		if !ok {
+			res.skip("handler %d: not an object literal", i)
+			continue
+		}
+		browser, _ := handler.get("browser")
+		dir, problem := finickyChromeProfile(browser, profiles)
+		if problem != "" {
+			res.skip("handler %d: %s", i, problem)
+			continue
+		}
+		match, _ := handler.get("match")
+		patterns := finickyMatchPatterns(match, func(problem string) {
+			res.skip("handler %d: %s", i, problem)
+		})
+		for _, pattern := range patterns {
+			res.Rules = append(res.Rules, Rule{Pattern: pattern, ProfileDirectory: dir})
+		}
+	}
+
+	return res, nil
+}
+
+func isChromeBrowserName(name string) bool {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "google chrome", "chrome", "com.google.chrome":
+		return true
+	}
+	return false
+}
+
+// finickyChromeProfile returns the Chrome profile directory a Finicky browser
+// value opens, or a description of why it can't be translated.
+func finickyChromeProfile(v jsValue, profiles []chromeProfile) (string, string) {
+	switch b := v.(type) {
+	case string:
+		if isChromeBrowserName(b) {
+			return "", fmt.Sprintf("browser %q does not name a profile", b)
+		}
+		return "", fmt.Sprintf("routes to %q, not Google Chrome", b)
+	case []jsValue:
+		if len(b) == 0 {
+			return "", "empty browser list"
+		}
+		return finickyChromeProfile(b[0], profiles)
+	case *jsObject:
+		nameValue, _ := b.get("name")
+		name, _ := nameValue.(string)
+		if !isChromeBrowserName(name) {
+			return "", fmt.Sprintf("routes to %q, not Google Chrome", name)
+		}
+		profileValue, _ := b.get("profile")
+		profile, ok := profileValue.(string)
+		if !ok || profile == "" {
+			return "", fmt.Sprintf("browser %q does not name a profile", name)
+		}
+		return profileDirectoryFor(profile, profiles), ""
+	case jsOpaque:
+		return "", fmt.Sprintf("browser is computed by code: %s", abbreviate(b.source))
+	case nil:
+		return "", "no browser"
+	}
+	return "", "unsupported browser value"
+}
+
+// finickyMatchPatterns converts a Finicky match value into regex patterns,
+// calling skip for every part that can't be translated.
+func finickyMatchPatterns(v jsValue, skip func(string)) []string {
+	switch m := v.(type) {
+	case string:
+		return []string{finickyGlobPattern(m)}
+	case jsRegexValue:
+		pattern, err := jsRegexPattern(m)
+		if err != nil {
+			skip(fmt.Sprintf("regex /%s/: %v", m.source, err))
+			return nil
+		}
+		return []string{pattern}
+	case []jsValue:
+		var patterns []string
+		for _, e := range m {
+			patterns = append(patterns, finickyMatchPatterns(e, skip)...)
+		}
+		return patterns
+	case jsCall:
+		if (m.callee == "finicky.matchHostnames" || m.callee == "finicky.matchDomains") && len(m.args) == 1 {
+			return finickyHostPatterns(m.args[0], skip)
+		}
+		skip(fmt.Sprintf("unsupported matcher %s()", m.callee))
+	case jsOpaque:
+		skip(fmt.Sprintf("match is computed by code: %s", abbreviate(m.source)))
+	case nil:
+		skip("no match")
+	default:
+		skip("unsupported match value")
+	}
+	return nil
+}
+
+// finickyHostPatterns converts the argument of finicky.matchHostnames into
+// patterns matching the URL host.
+func finickyHostPatterns(v jsValue, skip func(string)) []string {
+	switch h := v.(type) {
+	case string:
+		return []string{`^[a-z][a-z0-9+.-]*://([^/?#@]*@)?` + regexp.QuoteMeta(strings.ToLower(h)) + `([:/?#]|$)`}
+	case jsRegexValue:
+		inner, err := jsRegexPattern(h)
+		if err != nil {
+			skip(fmt.Sprintf("regex /%s/: %v", h.source, err))
+			return nil
+		}
+		// The regex is matched against the host only, so anchor it there.
+		flags := ""
+		if strings.HasPrefix(inner, "(?i)") {
+			flags, inner = "(?i)", strings.TrimPrefix(inner, "(?i)")
+		}
+		prefix, suffix := `[^/?#]*(`, `)`
+		if strings.HasPrefix(inner, "^") {
+			prefix, inner = `(`, inner[1:]
+		}
+		if strings.HasSuffix(inner, "$") && !strings.HasSuffix(inner, `\$`) {
+			suffix, inner = `)([:/?#]|$)`, inner[:len(inner)-1]
+		}
+		return []string{flags + `^[a-z][a-z0-9+.-]*://([^/?#@]*@)?` + prefix + inner + suffix}
+	case []jsValue:
+		var patterns []string
+		for _, e := range h {
+			patterns = append(patterns, finickyHostPatterns(e, skip)...)
+		}
+		return patterns
+	case jsOpaque:
+		skip(fmt.Sprintf("hostnames are computed by code: %s", abbreviate(h.source)))
+	default:
+		skip("unsupported hostname value")
+	}
+	return nil
+}
+
+// finickyGlobPattern converts a Finicky wildcard string into a regex. Finicky
+// matches these against the full URL; a missing scheme is made optional.
+func finickyGlobPattern(glob string) string {
+	parts := strings.Split(glob, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	pattern := strings.Join(parts, ".*")
+	if !strings.Contains(glob, "://") {
+		pattern = `([a-z][a-z0-9+.-]*://)?` + pattern
+	}
+	return "^" + pattern + "$"
+}
+
+// jsRegexPattern converts a JavaScript regex literal into an equivalent Go
+// pattern, failing when it uses syntax Go doesn't support.
+func jsRegexPattern(r jsRegexValue) (string, error) {
+	pattern := r.source
+	if strings.Contains(r.flags, "i") {
+		pattern = "(?i)" + pattern
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return "", fmt.Errorf("not supported by Go regexp")
+	}
+	return pattern, nil
+}
+
+func abbreviate(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > 60 {
+		return s[:57] + "..."
+	}
+	return s
+}
+
+// exportFinicky writes a .finicky.js equivalent of the config's rules.
+func exportFinicky(w io.Writer, cfg Config) ([]string, error) {
+	var notes []string
+	var b strings.Builder
+
+	b.WriteString("// Generated by `chrome-profile-router config export --to finicky`.\n")
+	b.WriteString("module.exports = {\n")
+	defaultBrowser := `"Google Chrome"`
+	if cfg.StrategyForUnknownUrls == StrategyForUnknownUrlsUseDefaultProfile {
+		defaultBrowser = finickyBrowser("Google Chrome", cfg.DefaultProfileDirectory)
+	}
+	if cfg.Background {
+		defaultBrowser = finickyInBackground(defaultBrowser)
+	}
+	fmt.Fprintf(&b, "  defaultBrowser: %s,\n", defaultBrowser)
+	if cfg.StrategyForUnknownUrls == StrategyForUnknownUrlsUseGuestProfile {
+		notes = append(notes, "strategy_for_unknown_urls \"use-guest-profile\" isn't supported by Finicky, unknown URLs open in Chrome")
+	}
+	if cfg.StrategyForUnknownUrls == StrategyForUnknownUrlsAsk {
+		notes = append(notes, "strategy_for_unknown_urls \"ask\" isn't supported by Finicky, unknown URLs open in Chrome")
+	}
+	if len(cfg.FallbackBrowsers) > 0 {
+		notes = append(notes, "fallback_browsers isn't supported by Finicky")
+	}
+	if cfg.NewWindow {
+		notes = append(notes, "new_window isn't supported by Finicky, URLs open in Chrome's usual way")
+	}
+	order := ruleOrder(cfg.Rules, cfg.MatchStrategy)
+	switch cfg.MultiMatchPolicy {
+	case MultiMatchPolicyLast:
+		// Finicky uses the first matching handler.
+		slices.Reverse(order)
+	case MultiMatchPolicyAll, MultiMatchPolicyPrompt:
+		notes = append(notes, fmt.Sprintf("multi_match_policy %q isn't supported by Finicky, the first matching rule wins", cfg.MultiMatchPolicy))
+	}
+	b.WriteString("  handlers: [\n")
+	for _, i := range order {
+		r := cfg.Rules[i]
+		if !cfg.ruleEnabled(r) {
+			continue
+		}
+		if keys := r.conditionKeys(); len(keys) > 0 {
+			notes = append(notes, fmt.Sprintf("rule %d: %s can't be exported, skipped", i, strings.Join(keys, " and ")))
+			continue
+		}
+		if r.Continue {
+			notes = append(notes, fmt.Sprintf("rule %d: continue can't be exported, skipped", i))
+			continue
+		}
+		if r.Script != "" {
+			notes = append(notes, fmt.Sprintf("rule %d: script can't be exported, skipped", i))
+			continue
+		}
+		if len(r.Command) > 0 {
+			notes = append(notes, fmt.Sprintf("rule %d: command can't be exported, skipped", i))
+			continue
+		}
+		if len(r.AskProfiles) > 0 {
+			notes = append(notes, fmt.Sprintf("rule %d: ask_profiles can't be exported, skipped", i))
+			continue
+		}
+		if r.Incognito || r.Guest || r.AppMode || r.Kiosk {
+			notes = append(notes, fmt.Sprintf("rule %d: incognito, guest, app_mode, and kiosk can't be exported, skipped", i))
+			continue
+		}
+		if r.UserDataDir != "" || r.ProfileDirectory == ephemeralProfile {
+			notes = append(notes, fmt.Sprintf("rule %d: user_data_dir and %s can't be exported, skipped", i, ephemeralProfile))
+			continue
+		}
+		if hasCaptureRefs(r.ProfileDirectory) {
+			notes = append(notes, fmt.Sprintf("rule %d: capture group references in profile_directory can't be exported, skipped", i))
+			continue
+		}
+		if len(r.ExcludePatterns) > 0 {
+			notes = append(notes, fmt.Sprintf("rule %d: exclude_patterns can't be exported, skipped", i))
+			continue
+		}
+		pattern, err := r.regexPattern(r.foldCase(cfg.CaseInsensitive))
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("rule %d: %v, skipped", i, err))
+			continue
+		}
+		literal, err := finickyRegexLiteral(pattern)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("rule %d: %v, skipped", i, err))
+			continue
+		}
+		if r.NewWindow != nil && *r.NewWindow {
+			notes = append(notes, fmt.Sprintf("rule %d: new_window can't be exported, opening in Chrome's usual way", i))
+		}
+		browser := finickyBrowser("Google Chrome", r.ProfileDirectory)
+		switch {
+		case r.Container != "":
+			notes = append(notes, fmt.Sprintf("rule %d: Firefox containers can't be exported, opening in Firefox without one", i))
+			fallthrough
+		case cfg.browserType(r.Browser) == browserTypeFirefox:
+			browser = strconv.Quote(appName(cfg.browserAppPath(r.Browser)))
+		case r.Space != "":
+			notes = append(notes, fmt.Sprintf("rule %d: Arc spaces can't be exported, opening in Arc without one", i))
+			fallthrough
+		case cfg.browserType(r.Browser) == browserTypeArc:
+			browser = strconv.Quote(appName(cfg.browserAppPath(r.Browser)))
+		case cfg.browserType(r.Browser) == browserTypeSafari:
+			if r.ProfileDirectory != "" {
+				notes = append(notes, fmt.Sprintf("rule %d: Safari profiles can't be exported, opening in Safari without one", i))
+			}
+			browser = strconv.Quote(appName(cfg.browserAppPath(r.Browser)))
+		case r.Browser != "":
+			browser = finickyBrowser(appName(cfg.browserAppPath(r.Browser)), r.ProfileDirectory)
+		case chromeChannels[r.Channel] != "":
+			browser = finickyBrowser(chromeChannels[r.Channel], r.ProfileDirectory)
+		}
+		if r.AppPath != "" || r.BundleID != "" {
+			// Finicky accepts an app name, path, or bundle ID as the browser.
+			browser = strconv.Quote(r.destination())
+		}
+		if r.opensInBackground(cfg.Background) {
+			browser = finickyInBackground(browser)
+		}
+		b.WriteString("    {\n")
+		fmt.Fprintf(&b, "      match: %s,\n", literal)
+		fmt.Fprintf(&b, "      browser: %s,\n", browser)
+		b.WriteString("    },\n")
+	}
+	b.WriteString("  ],\n")
+	b.WriteString("};\n")
+
+	_, err := io.WriteString(w, b.String())
+	return notes, err
+}
+
+func finickyBrowser(name, profileDir string) string {
+	return fmt.Sprintf("{ name: %s, profile: %s }", strconv.Quote(name), strconv.Quote(profileDir))
+}
+
+// finickyInBackground adds openInBackground to a browser from
+// finickyBrowser or a quoted app name.
+func finickyInBackground(browser string) string {
+	if fields, ok := strings.CutPrefix(browser, "{ "); ok {
+		return "{ " + strings.TrimSuffix(fields, " }") + ", openInBackground: true }"
+	}
+	return "{ name: " + browser + ", openInBackground: true }"
+}
+
+var (
+	leadingRegexFlags = regexp.MustCompile(`^\(\?([is]+)\)`)
+	goOnlyRegexSyntax = regexp.MustCompile(`\(\?[imsU-]+[:)]|\\[AzpPQE]|\[\[:`)
+)
+
+// finickyRegexLiteral converts a Go regex into a JavaScript regex literal.
+// A leading (?i) or (?s) becomes a flag and named groups are rewritten;
+// other Go-only syntax is rejected.
+func finickyRegexLiteral(pattern string) (string, error) {
+	flags := ""
+	for {
+		m := leadingRegexFlags.FindStringSubmatch(pattern)
+		if m == nil {
+			break
+		}
+		flags += m[1]
+		pattern = pattern[len(m[0]):]
+	}
+	pattern = strings.ReplaceAll(pattern, "(?P<", "(?<")
+	if goOnlyRegexSyntax.MatchString(pattern) {
+		return "", fmt.Errorf("pattern %q uses syntax JavaScript doesn't support", pattern)
+	}
+
+	var b strings.Builder
+	b.WriteByte('/')
+	escaped, inClass := false, false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '/' && !inClass:
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	b.WriteByte('/')
+	b.WriteString(flags)
+	return b.String(), nil
+}
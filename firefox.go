@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"net/url"
+)
+
+// containerURL wraps urlStr in the ext+container: scheme of the "Open
+// external links in a container" extension, which opens it in the named
+// Multi-Account Container.
+func containerURL(container, urlStr string) string {
+	return "ext+container:name=" + url.QueryEscape(container) + "&url=" + url.QueryEscape(urlStr)
+}
+
+// Hands a URL to Firefox, in a container if one is given.
+// Uses: NSWorkspace like open [-g] -a "Firefox" "ext+container:name=Work&url=URL"
+func openInFirefox(ctx context.Context, firefoxAppPath, container, urlStr string, background bool) error {
+	if container != "" {
+		urlStr = containerURL(container, urlStr)
+	}
+	_, err := openURLInApp(ctx, firefoxAppPath, "", urlStr, !background)
+	return err
+}
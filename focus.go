@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// focusMode identifies a Focus, e.g. "Work" with identifier
+// "com.apple.focus.work".
+type focusMode struct {
+	Name       string
+	Identifier string
+}
+
+// defaultFocusDir is where macOS keeps the Focus state. Reading it requires
+// Full Disk Access.
+func defaultFocusDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "Library", "DoNotDisturb", "DB")
+}
+
+// readFocusMode returns the Focus that was turned on manually, or nothing if
+// none is. There is no public API for the active Focus, so this reads the
+// database behind Control Center, which only records manual activations.
+func readFocusMode(dir string) (*focusMode, error) {
+	var assertions struct {
+		Data []struct {
+			StoreAssertionRecords []struct {
+				AssertionDetails struct {
+					ModeIdentifier string `json:"assertionDetailsModeIdentifier"`
+				} `json:"assertionDetails"`
+			} `json:"storeAssertionRecords"`
+		} `json:"data"`
+	}
+	if err := readJSONFile(filepath.Join(dir, "Assertions.json"), &assertions); err != nil {
+		return nil, err
+	}
+	var id string
+	for _, d := range assertions.Data {
+		for _, rec := range d.StoreAssertionRecords {
+			if rec.AssertionDetails.ModeIdentifier != "" {
+				id = rec.AssertionDetails.ModeIdentifier
+			}
+		}
+	}
+	if id == "" {
+		return nil, nil
+	}
+
+	mode := &focusMode{Name: id, Identifier: id}
+	var configs struct {
+		Data []struct {
+			ModeConfigurations map[string]struct {
+				Mode struct {
+					Name string `json:"name"`
+				} `json:"mode"`
+			} `json:"modeConfigurations"`
+		} `json:"data"`
+	}
+	if err := readJSONFile(filepath.Join(dir, "ModeConfigurations.json"), &configs); err == nil {
+		for _, d := range configs.Data {
+			if c, ok := d.ModeConfigurations[id]; ok && c.Mode.Name != "" {
+				mode.Name = c.Mode.Name
+			}
+		}
+	}
+	return mode, nil
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// focusMode returns the Focus active when req arrived, looking it up the
+// first time a rule asks for it.
+func (req *routeRequest) focusMode() *focusMode {
+	if !req.focusLoaded {
+		req.focusLoaded = true
+		mode, err := readFocusMode(defaultFocusDir())
+		if err != nil && logger != nil {
+			logger.Warnf("Failed to read the active Focus: %v", err)
+		}
+		req.focus = mode
+	}
+	return req.focus
+}
+
+// matchFocusMode reports whether mode is one of the Focus names or
+// identifiers in names. "none" matches when no Focus is on.
+func matchFocusMode(names []string, mode *focusMode) bool {
+	for _, name := range names {
+		switch {
+		case mode == nil:
+			if strings.EqualFold(name, "none") {
+				return true
+			}
+		case strings.EqualFold(name, mode.Name), strings.EqualFold(name, mode.Identifier):
+			return true
+		}
+	}
+	return false
+}
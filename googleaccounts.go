@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// checkGoogleAccounts validates the google_accounts setting, which maps
+// profile directories to the index of the Google account to use in them.
+func checkGoogleAccounts(accounts map[string]int) error {
+	for profile, index := range accounts {
+		if profile == "" {
+			return fmt.Errorf("google_accounts: profile directory is empty")
+		}
+		if index < 0 {
+			return fmt.Errorf("google_accounts: account index %d for %q is negative", index, profile)
+		}
+	}
+	return nil
+}
+
+// urlForProfile returns the URL to open raw with in profile. Google URLs
+// get the profile's account from google_accounts, so a profile signed into
+// several accounts opens them as the right one.
+func (config Config) urlForProfile(raw, profile string) string {
+	index, ok := config.GoogleAccounts[profile]
+	if !ok {
+		return raw
+	}
+	return withGoogleAccount(raw, index)
+}
+
+// withGoogleAccount points a google.com URL at the account with the given
+// index. Paths with an account segment, such as mail.google.com/mail/u/0/,
+// get it replaced; other URLs get an authuser query parameter.
+func withGoogleAccount(raw string, index int) string {
+	u, err := url.Parse(raw)
+	if err != nil || !isWebURL(raw) {
+		return raw
+	}
+	if site, err := publicsuffix.EffectiveTLDPlusOne(canonicalHost(u.Hostname())); err != nil || site != "google.com" {
+		return raw
+	}
+	n := strconv.Itoa(index)
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i] == "u" && isDigits(segments[i+1]) {
+			segments[i+1] = n
+			escaped := strings.Join(segments, "/")
+			if u.Path, err = url.PathUnescape(escaped); err != nil {
+				return raw
+			}
+			u.RawPath = escaped
+			return u.String()
+		}
+	}
+	// Rebuild the query by hand rather than with url.Values, which would
+	// reorder the parameters.
+	var params []string
+	for _, p := range strings.Split(u.RawQuery, "&") {
+		if key, _, _ := strings.Cut(p, "="); p != "" && key != "authuser" {
+			params = append(params, p)
+		}
+	}
+	u.RawQuery = strings.Join(append(params, "authuser="+n), "&")
+	return u.String()
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
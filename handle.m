@@ -1,5 +1,12 @@
 #include "handler.h"
 
+// frontmostBundleID returns the bundle identifier of the active app, or an
+// empty string if it has none.
+static NSString *frontmostBundleID(void) {
+  NSString *bundleID = [[[NSWorkspace sharedWorkspace] frontmostApplication] bundleIdentifier];
+  return bundleID != nil ? bundleID : @"";
+}
+
 @implementation BrowseAppDelegate
 - (void)applicationWillFinishLaunching:(NSNotification *)aNotification
 {
@@ -14,13 +21,33 @@
   return NSTerminateNow;
 }
 
+// Opening the app again, say from the Finder or Spotlight, shows the rules
+// editor.
+- (BOOL)applicationShouldHandleReopen:(NSApplication *)sender hasVisibleWindows:(BOOL)flag
+{
+  OpenRulesEditor();
+  return NO;
+}
+
 - (void)handleGetURLEvent:(NSAppleEventDescriptor *)event
            withReplyEvent:(NSAppleEventDescriptor *)replyEvent {
-  HandleURL((char*)[[[event paramDescriptorForKeyword:keyDirectObject] stringValue] UTF8String]);
+  NSString *sourceApp = @"";
+  NSAppleEventDescriptor *pidDesc = [event attributeDescriptorForKeyword:keySenderPIDAttr];
+  if (pidDesc != nil) {
+    NSRunningApplication *sender = [NSRunningApplication runningApplicationWithProcessIdentifier:[pidDesc int32Value]];
+    if (sender.bundleIdentifier != nil) {
+      sourceApp = sender.bundleIdentifier;
+    }
+  }
+  HandleURL((char*)[[[event paramDescriptorForKeyword:keyDirectObject] stringValue] UTF8String],
+            (char*)[sourceApp UTF8String],
+            (char*)[frontmostBundleID() UTF8String],
+            (unsigned long)[NSEvent modifierFlags]);
 }
 
 - (BOOL)application:(NSApplication *)sender openFile:(NSString *)filename {
-  HandleURL((char*)[filename UTF8String]);
+  HandleURL((char*)[filename UTF8String], "", (char*)[frontmostBundleID() UTF8String],
+            (unsigned long)[NSEvent modifierFlags]);
   return YES;
 }
 @end
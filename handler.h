@@ -1,6 +1,7 @@
 #import <Cocoa/Cocoa.h>
 
-extern void HandleURL(char*);
+extern void HandleURL(char*, char*, char*, unsigned long);
+extern void OpenRulesEditor(void);
 
 @interface BrowseAppDelegate: NSObject<NSApplicationDelegate>
   - (void)handleGetURLEvent:(NSAppleEventDescriptor *) event withReplyEvent:(NSAppleEventDescriptor *)replyEvent;
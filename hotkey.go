@@ -0,0 +1,106 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework Carbon
+#include "hotkey.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hot key IDs, passed back by HotKeyPressed.
+const (
+	hotKeyPause = iota + 1
+	hotKeyReopenTab
+)
+
+// Carbon's modifier masks for hot keys, by the key names of
+// picker_modifiers.
+var hotKeyModifiers = map[string]uint{
+	"command": 1 << 8,
+	"shift":   1 << 9,
+	"option":  1 << 11,
+	"control": 1 << 12,
+}
+
+// hotKeyCodes maps key names to the virtual key codes of an ANSI keyboard.
+var hotKeyCodes = map[string]uint{
+	"a": 0x00, "s": 0x01, "d": 0x02, "f": 0x03, "h": 0x04, "g": 0x05, "z": 0x06, "x": 0x07,
+	"c": 0x08, "v": 0x09, "b": 0x0b, "q": 0x0c, "w": 0x0d, "e": 0x0e, "r": 0x0f, "y": 0x10,
+	"t": 0x11, "1": 0x12, "2": 0x13, "3": 0x14, "4": 0x15, "6": 0x16, "5": 0x17, "=": 0x18,
+	"9": 0x19, "7": 0x1a, "-": 0x1b, "8": 0x1c, "0": 0x1d, "]": 0x1e, "o": 0x1f, "u": 0x20,
+	"[": 0x21, "i": 0x22, "p": 0x23, "l": 0x25, "j": 0x26, "'": 0x27, "k": 0x28, ";": 0x29,
+	"\\": 0x2a, ",": 0x2b, "/": 0x2c, "n": 0x2d, "m": 0x2e, ".": 0x2f, "`": 0x32,
+	"return": 0x24, "tab": 0x30, "space": 0x31, "escape": 0x35,
+	"f1": 0x7a, "f2": 0x78, "f3": 0x63, "f4": 0x76, "f5": 0x60, "f6": 0x61,
+	"f7": 0x62, "f8": 0x64, "f9": 0x65, "f10": 0x6d, "f11": 0x67, "f12": 0x6f,
+	"left": 0x7b, "right": 0x7c, "down": 0x7d, "up": 0x7e,
+}
+
+// hotKey is a key held with modifiers, which works from any app.
+type hotKey struct {
+	keyCode   uint
+	modifiers uint // Carbon modifier masks, 0 for no hot key
+}
+
+// parseHotKey parses a hot key such as "control+option+p": modifier names
+// as in picker_modifiers and a key, joined by "+". At least one modifier is
+// needed so typing the key alone still works.
+func parseHotKey(s string) (hotKey, error) {
+	var k hotKey
+	parts := strings.Split(strings.ToLower(strings.ReplaceAll(s, " ", "")), "+")
+	key := parts[len(parts)-1]
+	code, ok := hotKeyCodes[key]
+	if !ok {
+		return k, fmt.Errorf("hot key %q doesn't end in a known key", s)
+	}
+	for _, name := range parts[:len(parts)-1] {
+		mask, ok := hotKeyModifiers[name]
+		if !ok {
+			return k, fmt.Errorf("hot key %q has unknown modifier %q", s, name)
+		}
+		k.modifiers |= mask
+	}
+	if k.modifiers == 0 {
+		return k, fmt.Errorf("hot key %q needs a modifier such as \"control+option+%s\"", s, key)
+	}
+	k.keyCode = code
+	return k, nil
+}
+
+// registerHotKeys replaces the hot keys of the previous config with those
+// of config.
+func registerHotKeys(config Config) {
+	C.UnregisterGlobalHotKeys()
+	if k := config.pauseHotKey; k.modifiers != 0 {
+		C.RegisterGlobalHotKey(hotKeyPause, C.uint(k.keyCode), C.uint(k.modifiers))
+	}
+	if k := config.reopenTabHotKey; k.modifiers != 0 {
+		C.RegisterGlobalHotKey(hotKeyReopenTab, C.uint(k.keyCode), C.uint(k.modifiers))
+	}
+}
+
+//export HotKeyPressed
+func HotKeyPressed(id C.int) {
+	config := *currentConfig.Load()
+	switch id {
+	case hotKeyPause:
+		go togglePause(config)
+	case hotKeyReopenTab:
+		go reopenCurrentTab(config)
+	}
+}
+
+//export HotKeyUnavailable
+func HotKeyUnavailable(id C.int) {
+	config := *currentConfig.Load()
+	switch id {
+	case hotKeyPause:
+		logger.Errorf("Pause hot key %q is taken by another app", config.PauseHotKey)
+	case hotKeyReopenTab:
+		logger.Errorf("Reopen tab hot key %q is taken by another app", config.ReopenTabHotKey)
+	}
+}
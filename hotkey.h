@@ -0,0 +1,13 @@
+#include <stdbool.h>
+
+extern void HotKeyPressed(int id);
+extern void HotKeyUnavailable(int id);
+
+// RegisterGlobalHotKey makes the key with the virtual key code keyCode,
+// held with the Carbon modifiers, call HotKeyPressed with id from any app.
+// When another app already has the combination, HotKeyUnavailable is
+// called with id instead.
+void RegisterGlobalHotKey(int id, unsigned int keyCode, unsigned int modifiers);
+
+// UnregisterGlobalHotKeys releases every hot key registered so far.
+void UnregisterGlobalHotKeys(void);
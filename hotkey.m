@@ -0,0 +1,45 @@
+#import <Carbon/Carbon.h>
+#include "hotkey.h"
+
+static const int maxHotKeys = 16;
+static EventHotKeyRef hotKeys[maxHotKeys];
+static int hotKeyCount;
+static bool handlerInstalled;
+
+static OSStatus hotKeyHandler(EventHandlerCallRef next, EventRef event, void *data) {
+  EventHotKeyID hotKeyID;
+  if (GetEventParameter(event, kEventParamDirectObject, typeEventHotKeyID, NULL, sizeof(hotKeyID), NULL, &hotKeyID) != noErr) {
+    return eventNotHandledErr;
+  }
+  HotKeyPressed((int)hotKeyID.id);
+  return noErr;
+}
+
+// The Carbon event manager belongs to the main thread, so hot keys are
+// registered there, in the order the calls were made.
+void RegisterGlobalHotKey(int id, unsigned int keyCode, unsigned int modifiers) {
+  dispatch_async(dispatch_get_main_queue(), ^{
+    if (!handlerInstalled) {
+      EventTypeSpec spec = {kEventClassKeyboard, kEventHotKeyPressed};
+      InstallApplicationEventHandler(&hotKeyHandler, 1, &spec, NULL, NULL);
+      handlerInstalled = true;
+    }
+    EventHotKeyID hotKeyID = {'cprr', (UInt32)id};
+    EventHotKeyRef ref;
+    if (hotKeyCount == maxHotKeys ||
+        RegisterEventHotKey(keyCode, modifiers, hotKeyID, GetApplicationEventTarget(), 0, &ref) != noErr) {
+      HotKeyUnavailable(id);
+      return;
+    }
+    hotKeys[hotKeyCount++] = ref;
+  });
+}
+
+void UnregisterGlobalHotKeys(void) {
+  dispatch_async(dispatch_get_main_queue(), ^{
+    for (int i = 0; i < hotKeyCount; i++) {
+      UnregisterEventHotKey(hotKeys[i]);
+    }
+    hotKeyCount = 0;
+  });
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// importResult is what an importer could translate from another tool's
+// configuration, plus notes about everything it had to leave out.
+type importResult struct {
+	Rules                   []Rule
+	DefaultProfileDirectory string
+	Skipped                 []string
+}
+
+func (r *importResult) skip(format string, args ...interface{}) {
+	r.Skipped = append(r.Skipped, fmt.Sprintf(format, args...))
+}
+
+// importers maps the --from value of `config import` to its implementation.
+var importers = map[string]func(path string) (importResult, error){
+	"finicky":        importFinicky,
+	"choosy":         importChoosy,
+	"browserosaurus": importBrowserosaurus,
+}
+
+func runConfigImport(from, path string) int {
+	importer, ok := importers[from]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "can't import from %q, only from %s\n", from, strings.Join(importerNames(), ", "))
+		return 2
+	}
+
+	res, err := importer(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		return 1
+	}
+	if err := writeImportedConfig(os.Stdout, res); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write config: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d rules.\n", len(res.Rules))
+	if len(res.Skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "Could not translate %d items:\n", len(res.Skipped))
+		for _, s := range res.Skipped {
+			fmt.Fprintf(os.Stderr, "  - %s\n", s)
+		}
+	}
+	return 0
+}
+
+func importerNames() []string {
+	var names []string
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeImportedConfig prints the import result as a JSON config that can be
+// used as is or dropped into conf.d.
+func writeImportedConfig(w io.Writer, res importResult) error {
+	out := struct {
+		Version                 int                    `json:"version"`
+		DefaultProfileDirectory string                 `json:"default_profile_directory,omitempty"`
+		StrategyForUnknownUrls  StrategyForUnknownUrls `json:"strategy_for_unknown_urls,omitempty"`
+		Rules                   []Rule                 `json:"rules"`
+	}{
+		Version:                 currentConfigVersion,
+		DefaultProfileDirectory: res.DefaultProfileDirectory,
+		Rules:                   res.Rules,
+	}
+	if res.DefaultProfileDirectory != "" {
+		out.StrategyForUnknownUrls = StrategyForUnknownUrlsUseDefaultProfile
+	}
+	if out.Rules == nil {
+		out.Rules = []Rule{}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// profileDirectoryFor maps a profile given by directory or display name to
+// its directory, falling back to the name itself when it is unknown.
+func profileDirectoryFor(name string, profiles []chromeProfile) string {
+	for _, p := range profiles {
+		if p.Directory == name {
+			return name
+		}
+	}
+	for _, p := range profiles {
+		if strings.EqualFold(p.Name, name) {
+			return p.Directory
+		}
+	}
+	return name
+}
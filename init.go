@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// starterConfig is the config written by the init wizard.
+type starterConfig struct {
+	Version                 int                    `json:"version"`
+	ChromeAppPath           string                 `json:"chrome_app_path"`
+	DefaultProfileDirectory string                 `json:"default_profile_directory"`
+	StrategyForUnknownUrls  StrategyForUnknownUrls `json:"strategy_for_unknown_urls"`
+	LogLevel                string                 `json:"log_level"`
+	Rules                   []Rule                 `json:"rules"`
+}
+
+// hostPattern returns a regex matching URLs on domain and its subdomains.
+func hostPattern(domain string) string {
+	return `^https?://([^/?#]+\.)?` + regexp.QuoteMeta(domain) + `([:/?#]|$)`
+}
+
+// encodeStarterConfig serializes cfg in the format implied by the extension of
+// configPath.
+func encodeStarterConfig(configPath string, cfg starterConfig) ([]byte, error) {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if ext := strings.ToLower(filepath.Ext(configPath)); ext == ".json" || ext == "" {
+		return append(data, '\n'), nil
+	}
+	doc, err := decodeConfigDoc(data)
+	if err != nil {
+		return nil, err
+	}
+	return encodeConfigDoc(configPath, doc)
+}
+
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (w *wizard) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	line, _ := w.in.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def
+	}
+	return line
+}
+
+func (w *wizard) confirm(question string, def bool) bool {
+	d := "y/N"
+	if def {
+		d = "Y/n"
+	}
+	answer := strings.ToLower(w.ask(question+" ("+d+")", ""))
+	if answer == "" {
+		return def
+	}
+	return answer == "y" || answer == "yes"
+}
+
+// chooseProfile asks for a profile by number and returns its directory.
+func (w *wizard) chooseProfile(question string, profiles []chromeProfile, def int) string {
+	for {
+		answer := w.ask(question, strconv.Itoa(def+1))
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(profiles) {
+			return profiles[n-1].Directory
+		}
+		fmt.Fprintf(w.out, "Please enter a number between 1 and %d.\n", len(profiles))
+	}
+}
+
+func runInit(configPath string) int {
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+
+	if _, err := os.Stat(configPath); err == nil {
+		if !w.confirm(fmt.Sprintf("%s already exists. Overwrite it?", configPath), false) {
+			return 1
+		}
+	}
+
+	profiles, err := readChromeProfiles(defaultChromeUserDataDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\nMake sure Google Chrome is installed and has been started at least once.\n", err)
+		return 1
+	}
+	if len(profiles) == 0 {
+		fmt.Fprintln(os.Stderr, "No Chrome profiles found.")
+		return 1
+	}
+
+	fmt.Fprintln(w.out, "Found these Chrome profiles:")
+	for i, p := range profiles {
+		fmt.Fprintf(w.out, "  %d) %s  (%s)\n", i+1, p.Label(), p.Directory)
+	}
+	fmt.Fprintln(w.out)
+
+	cfg := starterConfig{
+		Version:                currentConfigVersion,
+		ChromeAppPath:          w.ask("Path to Google Chrome", detectChromeAppPath()),
+		StrategyForUnknownUrls: StrategyForUnknownUrlsUseBrowserDefault,
+		LogLevel:               "info",
+		Rules:                  []Rule{},
+	}
+	cfg.DefaultProfileDirectory = w.chooseProfile("Default profile", profiles, 0)
+	if w.confirm("Open URLs that match no rule in the default profile?", true) {
+		cfg.StrategyForUnknownUrls = StrategyForUnknownUrlsUseDefaultProfile
+	}
+
+	fmt.Fprintln(w.out, "\nFor each profile, list the domains that should open in it (comma separated, empty to skip).")
+	for _, p := range profiles {
+		answer := w.ask(p.Label(), "")
+		for _, domain := range strings.Split(answer, ",") {
+			domain = strings.ToLower(strings.TrimSpace(domain))
+			if domain == "" {
+				continue
+			}
+			cfg.Rules = append(cfg.Rules, Rule{MatchType: MatchTypeHost, Host: domain, ProfileDirectory: p.Directory})
+		}
+	}
+
+	data, err := encodeStarterConfig(configPath, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to encode config: %v\n", err)
+		return 1
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create config directory: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write config: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(w.out, "\nWrote %s with %d rules.\n", configPath, len(cfg.Rules))
+	return 0
+}
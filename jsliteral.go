@@ -0,0 +1,502 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// This file implements a small, forgiving reader for the literal parts of a
+// JavaScript file: object and array literals, strings, regexes, numbers,
+// simple calls, and top-level const/let/var bindings. Anything else (functions,
+// operators, ...) is kept as opaque source text so callers can report what
+// they couldn't translate instead of failing outright.
+
+type jsTokenKind int
+
+const (
+	jsEOF jsTokenKind = iota
+	jsIdent
+	jsString
+	jsTemplate
+	jsRegex
+	jsNumber
+	jsPunct
+)
+
+type jsToken struct {
+	kind       jsTokenKind
+	text       string // raw source text
+	value      string // decoded string value, regex source, or identifier name
+	flags      string // regex flags
+	start, end int
+}
+
+// jsValue is one of: string, float64, bool, nil, jsRegexValue, []jsValue,
+// *jsObject, jsCall, or jsOpaque.
+type jsValue interface{}
+
+type jsRegexValue struct {
+	source string
+	flags  string
+}
+
+type jsObject struct {
+	keys   []string
+	values map[string]jsValue
+}
+
+func (o *jsObject) get(key string) (jsValue, bool) {
+	if o == nil {
+		return nil, false
+	}
+	v, ok := o.values[key]
+	return v, ok
+}
+
+type jsCall struct {
+	callee string
+	args   []jsValue
+}
+
+type jsOpaque struct {
+	source string
+}
+
+func tokenizeJS(src string) ([]jsToken, error) {
+	var tokens []jsToken
+	i := 0
+	regexAllowed := true
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c >= utf8.RuneSelf && isJSSpace(src[i:]):
+			// A byte order mark, no-break space, or line separator.
+			_, n := utf8.DecodeRuneInString(src[i:])
+			i += n
+			continue
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+			continue
+		}
+
+		start := i
+		var tok jsToken
+		switch {
+		case c == '"' || c == '\'':
+			value, n, err := readJSString(src[i:], c)
+			if err != nil {
+				return nil, err
+			}
+			i += n
+			tok = jsToken{kind: jsString, value: value}
+		case c == '`':
+			j := i + 1
+			for j < len(src) && src[j] != '`' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated template literal")
+			}
+			i = j + 1
+			tok = jsToken{kind: jsTemplate, value: src[start+1 : j]}
+		case c == '/' && regexAllowed:
+			j, inClass := i+1, false
+			for j < len(src) && (src[j] != '/' || inClass) && src[j] != '\n' {
+				switch src[j] {
+				case '\\':
+					j++
+				case '[':
+					inClass = true
+				case ']':
+					inClass = false
+				}
+				j++
+			}
+			if j >= len(src) || src[j] != '/' {
+				return nil, fmt.Errorf("unterminated regular expression")
+			}
+			source := src[i+1 : j]
+			j++
+			flagStart := j
+			for j < len(src) && isJSIdentChar(rune(src[j])) {
+				j++
+			}
+			i = j
+			tok = jsToken{kind: jsRegex, value: source, flags: src[flagStart:j]}
+		case c >= '0' && c <= '9':
+			for i < len(src) && (isJSIdentChar(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			tok = jsToken{kind: jsNumber}
+		case isJSIdentStart(c):
+			for i < len(src) {
+				r, n := utf8.DecodeRuneInString(src[i:])
+				if !isJSIdentChar(r) {
+					break
+				}
+				i += n
+			}
+			if i == start {
+				// Not a letter either, so it can only be punctuation.
+				_, n := utf8.DecodeRuneInString(src[i:])
+				i += n
+				tok = jsToken{kind: jsPunct, value: src[start:i]}
+				break
+			}
+			tok = jsToken{kind: jsIdent, value: src[start:i]}
+		default:
+			n := 1
+			for _, op := range []string{"=>", "...", "===", "!==", "==", "!=", "&&", "||", "??", "?."} {
+				if strings.HasPrefix(src[i:], op) {
+					n = len(op)
+					break
+				}
+			}
+			i += n
+			tok = jsToken{kind: jsPunct, value: src[start:i]}
+		}
+		tok.start, tok.end, tok.text = start, i, src[start:i]
+		tokens = append(tokens, tok)
+
+		switch tok.kind {
+		case jsIdent:
+			regexAllowed = tok.value == "return" || tok.value == "typeof"
+		case jsPunct:
+			regexAllowed = !strings.Contains(")]}", tok.value)
+		default:
+			regexAllowed = false
+		}
+	}
+	tokens = append(tokens, jsToken{kind: jsEOF, start: len(src), end: len(src)})
+	return tokens, nil
+}
+
+func isJSIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= utf8.RuneSelf
+}
+
+// isJSSpace reports whether s starts with a character JavaScript skips as
+// white space or a line terminator outside of ASCII.
+func isJSSpace(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '\uFEFF' || unicode.IsSpace(r) || unicode.Is(unicode.Zs, r)
+}
+
+func isJSIdentChar(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func readJSString(s string, quote byte) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'u':
+				if i+4 < len(s) {
+					if r, err := strconv.ParseUint(s[i+1:i+5], 16, 32); err == nil {
+						b.WriteRune(rune(r))
+						i += 4
+						continue
+					}
+				}
+				b.WriteByte(e)
+			case '\n':
+			default:
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+type jsParser struct {
+	src    string
+	tokens []jsToken
+	pos    int
+	env    map[string]jsValue
+}
+
+func (p *jsParser) peek() jsToken { return p.tokens[p.pos] }
+
+func (p *jsParser) next() jsToken {
+	t := p.tokens[p.pos]
+	if t.kind != jsEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *jsParser) isPunct(v string) bool {
+	t := p.peek()
+	return t.kind == jsPunct && t.value == v
+}
+
+// parseJSModule returns the value assigned to module.exports (or exported by
+// default), resolving references to top-level bindings.
+func parseJSModule(src string) (jsValue, error) {
+	tokens, err := tokenizeJS(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &jsParser{src: src, tokens: tokens, env: map[string]jsValue{}}
+
+	var exported jsValue
+	found := false
+	for p.peek().kind != jsEOF {
+		t := p.next()
+		if t.kind != jsIdent {
+			continue
+		}
+		switch {
+		case t.value == "const" || t.value == "let" || t.value == "var":
+			name := p.peek()
+			if name.kind != jsIdent {
+				continue
+			}
+			p.next()
+			if p.isPunct("=") {
+				p.next()
+				p.env[name.value] = p.parseValue()
+			}
+		case t.value == "module" && p.isPunct("."):
+			p.next()
+			if p.peek().kind == jsIdent && p.peek().value == "exports" {
+				p.next()
+				if p.isPunct("=") {
+					p.next()
+					exported, found = p.parseValue(), true
+				}
+			}
+		case t.value == "export" && p.peek().kind == jsIdent && p.peek().value == "default":
+			p.next()
+			exported, found = p.parseValue(), true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no module.exports or export default found")
+	}
+	return exported, nil
+}
+
+func (p *jsParser) parseValue() jsValue {
+	start := p.pos
+	v := p.parsePrimary()
+	// Values followed by an operator or other trailing expression are opaque.
+	if !p.atValueEnd() {
+		p.pos = start
+		return p.skipOpaque()
+	}
+	return v
+}
+
+func (p *jsParser) atValueEnd() bool {
+	t := p.peek()
+	return t.kind == jsEOF || (t.kind == jsPunct && (t.value == "," || t.value == "}" || t.value == "]" || t.value == ")" || t.value == ";"))
+}
+
+func (p *jsParser) parsePrimary() jsValue {
+	t := p.peek()
+	switch t.kind {
+	case jsString:
+		p.next()
+		return t.value
+	case jsTemplate:
+		if strings.Contains(t.value, "${") {
+			return p.skipOpaque()
+		}
+		p.next()
+		return t.value
+	case jsRegex:
+		p.next()
+		return jsRegexValue{source: t.value, flags: t.flags}
+	case jsNumber:
+		p.next()
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return jsOpaque{source: t.text}
+		}
+		return f
+	case jsPunct:
+		switch t.value {
+		case "{":
+			return p.parseObject()
+		case "[":
+			return p.parseArray()
+		}
+	case jsIdent:
+		switch t.value {
+		case "true", "false":
+			p.next()
+			return t.value == "true"
+		case "null", "undefined":
+			p.next()
+			return nil
+		case "function", "async", "new":
+			return p.skipOpaque()
+		}
+		// identifier, member access, or call
+		callee := p.next().value
+		for p.isPunct(".") && p.tokens[p.pos+1].kind == jsIdent {
+			p.next()
+			callee += "." + p.next().value
+		}
+		if p.isPunct("(") {
+			p.next()
+			var args []jsValue
+			for !p.isPunct(")") && p.peek().kind != jsEOF {
+				args = append(args, p.parseElement())
+			}
+			p.next()
+			return jsCall{callee: callee, args: args}
+		}
+		if p.isPunct("=>") {
+			return p.skipOpaque()
+		}
+		if v, ok := p.env[callee]; ok {
+			return v
+		}
+		return jsOpaque{source: callee}
+	}
+	return p.skipOpaque()
+}
+
+func (p *jsParser) parseObject() jsValue {
+	start := p.pos
+	p.next() // {
+	obj := &jsObject{values: map[string]jsValue{}}
+	for !p.isPunct("}") {
+		t := p.next()
+		var key string
+		switch t.kind {
+		case jsIdent, jsString, jsNumber:
+			key = t.value
+			if t.kind == jsNumber {
+				key = t.text
+			}
+		default:
+			// spread, computed keys, ...: give up on this object
+			p.pos = start
+			return p.skipOpaque()
+		}
+		switch {
+		case p.isPunct(":"):
+			p.next()
+			obj.set(key, p.parseValue())
+		case p.isPunct("(") || t.kind == jsIdent && (key == "async" || key == "get" || key == "set"):
+			// method shorthand
+			p.pos--
+			obj.set(key, p.skipOpaque())
+		default:
+			// property shorthand
+			v, ok := p.env[key]
+			if !ok {
+				v = jsOpaque{source: key}
+			}
+			obj.set(key, v)
+		}
+		if p.isPunct(",") {
+			p.next()
+		} else if !p.isPunct("}") {
+			p.pos = start
+			return p.skipOpaque()
+		}
+	}
+	p.next() // }
+	return obj
+}
+
+func (o *jsObject) set(key string, v jsValue) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func (p *jsParser) parseArray() jsValue {
+	p.next() // [
+	var arr []jsValue
+	for !p.isPunct("]") && p.peek().kind != jsEOF {
+		arr = append(arr, p.parseElement())
+	}
+	p.next() // ]
+	return arr
+}
+
+// parseElement parses one comma separated element of an array or argument
+// list and always makes progress, even on a stray closing bracket.
+func (p *jsParser) parseElement() jsValue {
+	before := p.pos
+	v := p.parseValue()
+	if p.pos == before {
+		p.next()
+	}
+	if p.isPunct(",") {
+		p.next()
+	}
+	return v
+}
+
+// skipOpaque consumes one expression of unknown shape, i.e. everything up to
+// the next comma or closing bracket at the current nesting level.
+func (p *jsParser) skipOpaque() jsValue {
+	start := p.peek().start
+	depth := 0
+	end := start
+	for {
+		t := p.peek()
+		if t.kind == jsEOF {
+			break
+		}
+		if t.kind == jsPunct {
+			switch t.value {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				if depth == 0 {
+					return jsOpaque{source: strings.TrimSpace(p.src[start:end])}
+				}
+				depth--
+			case ",", ";":
+				if depth == 0 {
+					return jsOpaque{source: strings.TrimSpace(p.src[start:end])}
+				}
+			}
+		}
+		end = t.end
+		p.next()
+	}
+	return jsOpaque{source: strings.TrimSpace(p.src[start:end])}
+}
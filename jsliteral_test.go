@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestTokenizeJSUnicodeSpace(t *testing.T) {
+	for _, src := range []string{
+		"\uFEFFexport default {}",
+		"export\u00a0default {}",
+		"export default\u2028{}",
+		"export default {} \u00bf",
+	} {
+		tokens, err := tokenizeJS(src)
+		if err != nil {
+			t.Fatalf("tokenizeJS(%q): %v", src, err)
+		}
+		var idents []string
+		for _, tok := range tokens {
+			if tok.kind == jsIdent {
+				idents = append(idents, tok.value)
+			}
+		}
+		if len(idents) != 2 || idents[0] != "export" || idents[1] != "default" {
+			t.Errorf("tokenizeJS(%q) identifiers = %q, want [export default]", src, idents)
+		}
+		if last := tokens[len(tokens)-1]; last.kind != jsEOF {
+			t.Errorf("tokenizeJS(%q) doesn't end in EOF", src)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// launchTarget is where a URL opens: a Chrome profile, or another app given
+// by path or bundle ID.
+type launchTarget struct {
+	browser       string // name in the browsers setting, "" for chrome_app_path
+	profile       string // Chrome profile directory, "" for Chrome's own choice
+	userDataDir   string // Chrome's --user-data-dir, "" for the browser's own
+	incognito     bool
+	guest         bool
+	appMode       bool
+	kiosk         bool
+	newWindow     bool
+	background    bool       // opened without bringing the browser or app to the front
+	launchMode    LaunchMode // how Chrome is launched, "" for open
+	reuseTab      TabReuse   // which open tab is focused instead, "" for none
+	tabGroup      TabGroup   // Chrome tab group the tab joins, no title for none
+	windowDisplay string     // display the window is moved to, "" for the main one
+	windowBounds  string     // "x,y,w,h" the window is given, "" to center it
+	container     string     // Firefox container, for browsers of type firefox
+	space         string     // Arc space, for browsers of type arc
+	appPath       string
+	bundleID      string
+}
+
+// opensApp reports whether t opens URLs outside Chrome.
+func (t launchTarget) opensApp() bool {
+	return t.appPath != "" || t.bundleID != ""
+}
+
+func (t launchTarget) String() string {
+	var s string
+	switch {
+	case t.appPath != "":
+		s = fmt.Sprintf("app=%q", t.appPath)
+	case t.bundleID != "":
+		s = fmt.Sprintf("bundle-id=%q", t.bundleID)
+	case t.container != "":
+		s = fmt.Sprintf("container=%q", t.container)
+	case t.space != "":
+		s = fmt.Sprintf("space=%q", t.space)
+	case t.guest:
+		s = "guest"
+	default:
+		s = fmt.Sprintf("profile-directory=%q", t.profile)
+	}
+	if t.browser != "" {
+		s = fmt.Sprintf("browser=%q %s", t.browser, s)
+	}
+	if t.userDataDir != "" {
+		s += fmt.Sprintf(" user-data-dir=%q", t.userDataDir)
+	}
+	if t.incognito {
+		s += " incognito"
+	}
+	if t.appMode {
+		s += " app-mode"
+	}
+	if t.kiosk {
+		s += " kiosk"
+	}
+	if t.newWindow {
+		s += " new-window"
+	}
+	if t.background {
+		s += " background"
+	}
+	if t.launchMode != "" {
+		s += " " + string(t.launchMode)
+	}
+	if t.reuseTab != "" {
+		s += " reuse-tabs=" + string(t.reuseTab)
+	}
+	if t.tabGroup.Title != "" {
+		s += fmt.Sprintf(" tab-group=%q", t.tabGroup.Title)
+	}
+	if t.windowDisplay != "" {
+		s += fmt.Sprintf(" window-display=%q", t.windowDisplay)
+	}
+	if t.windowBounds != "" {
+		s += fmt.Sprintf(" window-bounds=%q", t.windowBounds)
+	}
+	return s
+}
+
+// appLabel names the app of t for the profile prompt, e.g. "zoom.us" for
+// /Applications/zoom.us.app.
+func (t launchTarget) appLabel() string {
+	if t.appPath != "" {
+		return appName(t.appPath)
+	}
+	return t.bundleID
+}
+
+// chromeFlags returns the command-line flags Chrome is launched with for t,
+// besides the profile.
+func (t launchTarget) chromeFlags() []string {
+	var flags []string
+	if t.userDataDir != "" {
+		flags = append(flags, "--user-data-dir="+t.userDataDir)
+	}
+	if t.incognito {
+		flags = append(flags, "--incognito")
+	}
+	if t.guest {
+		flags = append(flags, "--guest")
+	}
+	if t.kiosk {
+		flags = append(flags, "--kiosk")
+	}
+	if t.newWindow {
+		flags = append(flags, "--new-window")
+	}
+	return flags
+}
+
+// openURL opens urlStr at t, in Chrome unless t names another app. The
+// launch is given up after launch_timeout.
+func openURL(config Config, t launchTarget, urlStr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.launchTimeout)
+	defer cancel()
+	if t.opensApp() {
+		return openInApp(ctx, t, urlStr)
+	}
+	switch config.browserType(t.browser) {
+	case browserTypeFirefox:
+		return openInFirefox(ctx, config.browserAppPath(t.browser), t.container, urlStr, t.background)
+	case browserTypeSafari:
+		return openInSafari(ctx, config.browserAppPath(t.browser), t.profile, urlStr, t.background)
+	case browserTypeArc:
+		return openInArc(ctx, config.browserAppPath(t.browser), t.space, urlStr, t.background)
+	}
+	flags := t.chromeFlags()
+	if t.usesCDP() {
+		dataDir := t.userDataDir
+		if dataDir == "" {
+			dataDir = config.browserUserDataDir(t.browser)
+		}
+		if config.tabGroups {
+			// Whichever rule launches Chrome, the extension has to be
+			// there for the rules with tab groups.
+			flags = append(flags, tabGroupFlags()...)
+		}
+		return openInChromeCDP(ctx, config.browserAppPath(t.browser), config.browserBundleID(t.browser), dataDir, urlStr, t, flags)
+	}
+	if t.profile == ephemeralProfile {
+		dir, err := newEphemeralUserDataDir()
+		if err != nil {
+			return err
+		}
+		t.profile = ""
+		flags = append(flags, "--user-data-dir="+dir, "--no-first-run", "--no-default-browser-check")
+	}
+	return openInChrome(ctx, config.browserAppPath(t.browser), config.browserBundleID(t.browser), urlStr, t, flags)
+}
+
+// lastResortBrowser opens URLs that no other browser could. The router is
+// the default browser itself, so handing them to the system default would
+// only send them back; Safari comes with every Mac.
+const lastResortBrowser = "Safari"
+
+const (
+	defaultLaunchRetries    = 3
+	defaultLaunchRetryDelay = 500 * time.Millisecond
+	defaultLaunchTimeout    = 10 * time.Second
+)
+
+// openURLWithRetries opens urlStr at t. When that fails, e.g. while Chrome
+// is being updated or just quit, it is retried in the background with the
+// delay doubling each time, and then handed to the fallback browsers, so
+// the URL isn't dropped. Apps that aren't installed go straight to the
+// fallbacks.
+func openURLWithRetries(config Config, t launchTarget, urlStr string) {
+	err := openURL(config, t, urlStr)
+	if err == nil {
+		if t.placesWindow() {
+			go placeWindow(config, t)
+		}
+		return
+	}
+	if errors.Is(err, errLaunchTimedOut) || config.launchRetries == 0 || !config.installed(t) {
+		giveUpOpening(config, t, urlStr, err)
+		return
+	}
+	if logger != nil {
+		logger.Warnf("Failed to open %s at %s, retrying: %v", urlStr, t, err)
+	}
+	go func() {
+		delay := config.launchRetryDelay
+		for attempt := 1; attempt <= config.launchRetries; attempt++ {
+			time.Sleep(delay)
+			delay *= 2
+			if err = openURL(config, t, urlStr); err == nil {
+				if logger != nil {
+					logger.Infof("Opened %s at %s after %d retries", urlStr, t, attempt)
+				}
+				if t.placesWindow() {
+					placeWindow(config, t)
+				}
+				return
+			}
+			if errors.Is(err, errLaunchTimedOut) {
+				break
+			}
+		}
+		giveUpOpening(config, t, urlStr, err)
+	}()
+}
+
+// giveUpOpening hands urlStr, which failed to open at t with err, to the
+// fallbacks, and shows an alert when they fail too. Launches that timed out
+// aren't handed on, since more launches would pile up behind whatever is
+// stuck.
+func giveUpOpening(config Config, t launchTarget, urlStr string, err error) {
+	if errors.Is(err, errLaunchTimedOut) {
+		if logger != nil {
+			logger.Errorf("Gave up opening %s at %s after %s, a dialog may be waiting for an answer: %v", urlStr, t, config.launchTimeout, err)
+		}
+		showLaunchError(config, t, urlStr, err)
+		return
+	}
+	if err := openFallbacks(config, t, urlStr, err); err != nil {
+		if logger != nil {
+			logger.Errorf("Failed to open URL: %v", err)
+		}
+		showLaunchError(config, t, urlStr, err)
+	}
+}
+
+// installed reports whether the app or browser of t can be found. Apps
+// given by name rather than path are assumed to be.
+func (config Config) installed(t launchTarget) bool {
+	switch {
+	case t.bundleID != "":
+		return appPathForBundleID(t.bundleID) != ""
+	case t.appPath != "":
+		return !strings.Contains(t.appPath, "/") || fileExists(t.appPath)
+	case config.browserBundleID(t.browser) != "":
+		return appPathForBundleID(config.browserBundleID(t.browser)) != ""
+	}
+	return fileExists(config.browserAppPath(t.browser))
+}
+
+// openFallbacks opens urlStr, which failed to open at t with err, in the
+// fallback_browsers in turn, e.g. on a Mac without Chrome, and then in
+// lastResortBrowser, so links never just vanish. Fallbacks get the URL
+// without a profile.
+func openFallbacks(config Config, t launchTarget, urlStr string, err error) error {
+	for _, name := range config.FallbackBrowsers {
+		if name == t.browser && !t.opensApp() {
+			continue
+		}
+		if logger != nil {
+			logger.Warnf("Failed to open %s at %s, trying browser %q: %v", urlStr, t, name, err)
+		}
+		fallback := launchTarget{browser: name, background: t.background}
+		if err = openURL(config, fallback, urlStr); err == nil {
+			return nil
+		}
+	}
+	if logger != nil {
+		logger.Warnf("Failed to open %s at %s, trying %s: %v", urlStr, t, lastResortBrowser, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.launchTimeout)
+	defer cancel()
+	return openInSafari(ctx, lastResortBrowser, "", urlStr, t.background)
+}
+
+// Hands a URL to another app through NSWorkspace, like
+// open -a "/Applications/zoom.us.app" "URL", or open -b us.zoom.xos "URL".
+func openInApp(ctx context.Context, t launchTarget, urlStr string) error {
+	bundleID := t.bundleID
+	if t.appPath != "" {
+		bundleID = ""
+	}
+	pid, err := openURLInApp(ctx, t.appPath, bundleID, urlStr, !t.background)
+	if err != nil {
+		return err
+	}
+	if logger != nil {
+		logger.Debugf("Opened %s in %s as pid %d", urlStr, t, pid)
+	}
+	return nil
+}
+
+// errLaunchTimedOut is returned for launches that didn't finish within
+// launch_timeout, as when Chrome shows a dialog that its profile is locked.
+var errLaunchTimedOut = errors.New("launch timed out")
+
+// runLauncher runs cmd, made with ctx, which ends it when the launch takes
+// too long rather than leaving it behind.
+func runLauncher(ctx context.Context, cmd *exec.Cmd) error {
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// Don't wait for children left holding the output open after a kill.
+	cmd.WaitDelay = 100 * time.Millisecond
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(cmd.Path), errLaunchTimedOut)
+	}
+	return err
+}
+
+// opensNewWindow reports whether the rule's URLs open in a new window rather
+// than a tab, falling back to the config-wide default when the rule doesn't
+// say.
+func (r Rule) opensNewWindow(def bool) bool {
+	if r.NewWindow != nil {
+		return *r.NewWindow
+	}
+	return def
+}
+
+// opensInBackground reports whether the rule's URLs open without bringing
+// the browser to the front, falling back to the config-wide default when the
+// rule doesn't say.
+func (r Rule) opensInBackground(def bool) bool {
+	if r.Background != nil {
+		return *r.Background
+	}
+	return def
+}
+
+// targetLaunchMode returns how a rule's browser is launched given its
+// launch_mode, falling back to the config-wide default when the rule doesn't
+// say. It is "" for open, so targets launched the usual way compare equal.
+func targetLaunchMode(mode, def LaunchMode) LaunchMode {
+	if mode == "" {
+		mode = def
+	}
+	if mode == LaunchModeOpen {
+		return ""
+	}
+	return mode
+}
+
+// targetTabReuse returns which open tab a rule's URLs focus given its
+// reuse_tabs, falling back to the config-wide default when the rule doesn't
+// say. It is "" for off.
+func targetTabReuse(reuse, def TabReuse) TabReuse {
+	if reuse == "" {
+		reuse = def
+	}
+	if reuse == TabReuseOff {
+		return ""
+	}
+	return reuse
+}
+
+// destination names where r sends URLs, for reports.
+func (r Rule) destination() string {
+	if r.AppPath != "" {
+		return r.AppPath
+	}
+	if r.BundleID != "" {
+		return r.BundleID
+	}
+	if r.Container != "" {
+		return r.Container + " in " + r.Browser
+	}
+	if r.Space != "" {
+		return r.Space + " in " + r.Browser
+	}
+	if r.Browser != "" {
+		return r.ProfileDirectory + " in " + r.Browser
+	}
+	if r.Channel != "" && r.Channel != "stable" {
+		return r.ProfileDirectory + " in Chrome " + r.Channel
+	}
+	dest := r.ProfileDirectory
+	if r.UserDataDir != "" {
+		dest += " in " + r.UserDataDir
+	}
+	if r.Incognito {
+		dest += " (incognito)"
+	}
+	if r.Kiosk {
+		dest += " (kiosk)"
+	}
+	if r.Guest {
+		dest = "Guest"
+	}
+	return dest
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"os"
+	"regexp/syntax"
+	"slices"
+	"strings"
+)
+
+const (
+	lintSamples    = 64
+	lintMinSamples = 8
+)
+
+// lintRule is an enabled rule prepared for linting.
+type lintRule struct {
+	index   int
+	rule    Rule
+	matcher urlMatcher
+}
+
+// lintConfig reports rules that duplicate an earlier rule or can never match
+// because earlier rules catch every URL they match. Shadowing is detected by
+// generating sample URLs from each rule, so it is a strong hint rather than a
+// proof.
+func lintConfig(cfg Config) []string {
+	var rules []lintRule
+	for _, i := range ruleOrder(cfg.Rules, cfg.MatchStrategy) {
+		r := cfg.Rules[i]
+		if !cfg.ruleEnabled(r) {
+			continue
+		}
+		m, err := compileRule(i, r, r.foldCase(cfg.CaseInsensitive))
+		if err != nil {
+			continue
+		}
+		rules = append(rules, lintRule{index: i, rule: r, matcher: m})
+	}
+	if cfg.MultiMatchPolicy == MultiMatchPolicyLast {
+		slices.Reverse(rules)
+	}
+	// With "all" and "prompt" every matching rule is used, so only exact
+	// duplicates are dead weight.
+	checkShadowing := cfg.MultiMatchPolicy != MultiMatchPolicyAll && cfg.MultiMatchPolicy != MultiMatchPolicyPrompt
+
+	var findings []string
+	seen := map[string]lintRule{}
+	for n, b := range rules {
+		key := lintKey(b.rule, cfg.CaseInsensitive)
+		if a, ok := seen[key]; ok {
+			findings = append(findings, fmt.Sprintf("rule %d (%s): duplicate of rule %d", b.index, describeRule(b.rule), a.index))
+			continue
+		}
+		seen[key] = b
+		if !checkShadowing || n == 0 {
+			continue
+		}
+
+		samples := sampleRuleURLs(b, rand.New(rand.NewPCG(uint64(b.index), 1)))
+		if len(samples) < lintMinSamples {
+			continue
+		}
+		for _, a := range rules[:n] {
+			if a.rule.ExpiresAt != "" || a.rule.Continue || a.rule.resolvesProfile() || len(a.rule.conditionKeys()) > 0 {
+				// It stops shadowing once it expires, doesn't stop
+				// evaluation, or depends on more than the URL.
+				continue
+			}
+			if matchesAll(a.matcher, samples) {
+				findings = append(findings, fmt.Sprintf("rule %d (%s): never matches, rule %d (%s) catches every URL it matches first", b.index, describeRule(b.rule), a.index, describeRule(a.rule)))
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// lintKey identifies what a rule matches and where it sends URLs, so two
+// rules with the same key are duplicates.
+func lintKey(r Rule, fold bool) string {
+	key := struct {
+		Type     MatchType
+		Values   []string
+		URL      [5]string
+		Excludes []string
+		Fold     bool
+		Continue bool
+		Rewrites []Rewrite
+		Conds    string
+		Script   string
+		Command  []string
+		Browser  [5]string
+		Flags    []bool
+		Launch   LaunchMode
+		Reuse    TabReuse
+		Group    TabGroup
+		Window   [2]string
+		Profile  [2]string
+		Ask      []string
+		App      [2]string
+	}{
+		Type:     r.MatchType,
+		Values:   r.matchValues(),
+		URL:      [5]string{r.Scheme, r.Host, r.Port, r.Path, r.Query},
+		Excludes: r.ExcludePatterns,
+		Fold:     r.foldCase(fold),
+		Continue: r.Continue,
+		Rewrites: r.Rewrites,
+		Conds:    r.conditionKey(),
+		Script:   r.Script,
+		Command:  r.Command,
+		Browser:  [5]string{r.Browser, r.Channel, r.UserDataDir, r.Container, r.Space},
+		Flags:    []bool{r.Incognito, r.Guest, r.AppMode, r.Kiosk, r.NewWindow != nil, r.opensNewWindow(false), r.Background != nil, r.opensInBackground(false)},
+		Launch:   r.LaunchMode,
+		Reuse:    r.ReuseTabs,
+		Group:    r.tabGroup(),
+		Window:   [2]string{r.WindowDisplay, r.WindowBounds},
+		Profile:  [2]string{r.ProfileDirectory, r.FallbackProfileDirectory},
+		Ask:      r.AskProfiles,
+		App:      [2]string{r.AppPath, r.BundleID},
+	}
+	if key.Type == "" {
+		key.Type = MatchTypeRegex
+	}
+	switch key.Type {
+	case MatchTypeHost, MatchTypeSite:
+		for i, v := range key.Values {
+			key.Values[i] = normalizeRuleHost(v)
+		}
+		key.Fold = false
+	case MatchTypeCIDR:
+		for i, v := range key.Values {
+			if p, err := parseCIDR(v); err == nil {
+				key.Values[i] = p.String()
+			}
+		}
+		key.Fold = false
+	}
+	key.Values = slices.Compact(slices.Sorted(slices.Values(key.Values)))
+	data, _ := json.Marshal(key)
+	return string(data)
+}
+
+func lowerAll(values []string) []string {
+	lower := make([]string, len(values))
+	for i, v := range values {
+		lower[i] = strings.ToLower(v)
+	}
+	return lower
+}
+
+// describeRule summarizes what a rule matches for lint output.
+func describeRule(r Rule) string {
+	var parts []string
+	switch r.MatchType {
+	case MatchTypeHost:
+		if r.Host != "" {
+			parts = append(parts, "host "+r.Host)
+		}
+	case MatchTypeSite:
+		if r.Site != "" {
+			parts = append(parts, "site "+r.Site)
+		}
+	case MatchTypeCIDR:
+		if r.CIDR != "" {
+			parts = append(parts, "cidr "+r.CIDR)
+		}
+	case MatchTypeURL:
+		for _, c := range urlComponents {
+			if v := c.value(r); v != "" {
+				parts = append(parts, c.name+" "+v)
+			}
+		}
+	default:
+		if r.Pattern != "" {
+			parts = append(parts, r.Pattern)
+		}
+	}
+	for _, list := range []string{r.PatternsFile, r.PatternsURL} {
+		if list != "" {
+			parts = append(parts, list)
+		}
+	}
+	if len(r.SourceApps) > 0 {
+		parts = append(parts, "from "+strings.Join(r.SourceApps, "|"))
+	}
+	if len(r.FrontmostApps) > 0 {
+		parts = append(parts, "in "+strings.Join(r.FrontmostApps, "|"))
+	}
+	if len(r.Days) > 0 {
+		parts = append(parts, "on "+strings.Join(r.Days, ","))
+	}
+	if r.Hours != "" {
+		parts = append(parts, "at "+r.Hours)
+	}
+	if len(r.WiFiSSIDs) > 0 {
+		parts = append(parts, "on Wi-Fi "+strings.Join(r.WiFiSSIDs, "|"))
+	}
+	if r.VPN != nil {
+		parts = append(parts, "on VPN")
+	}
+	if len(r.FocusModes) > 0 {
+		parts = append(parts, "in Focus "+strings.Join(r.FocusModes, "|"))
+	}
+	if len(r.Calendars) > 0 {
+		parts = append(parts, "during "+strings.Join(r.Calendars, "|")+" events")
+	}
+	if len(r.ResolvesTo) > 0 {
+		parts = append(parts, "resolving to "+strings.Join(r.ResolvesTo, "|"))
+	}
+	if r.PAC != nil {
+		parts = append(parts, "via PAC proxy")
+	}
+	if r.Conditions != nil {
+		parts = append(parts, "with conditions")
+	}
+	if r.Script != "" {
+		parts = append(parts, "script "+r.Script)
+	}
+	if len(r.Command) > 0 {
+		parts = append(parts, "command "+r.Command[0])
+	}
+	return abbreviate(strings.Join(parts, " + "))
+}
+
+func matchesAll(m urlMatcher, samples []*routeRequest) bool {
+	for _, req := range samples {
+		if !m.match(req) {
+			return false
+		}
+	}
+	return true
+}
+
+// sampleRuleURLs generates URLs the rule matches.
+func sampleRuleURLs(lr lintRule, rnd *rand.Rand) []*routeRequest {
+	var samples []*routeRequest
+	values := lr.rule.matchValues()
+	for range lintSamples * 4 {
+		if len(samples) == lintSamples {
+			break
+		}
+		var u string
+		switch lr.rule.MatchType {
+		case MatchTypeHost, MatchTypeSite:
+			if len(values) == 0 {
+				return nil
+			}
+			u = sampleHostURL(normalizeRuleHost(values[rnd.IntN(len(values))]), rnd)
+		case MatchTypeGlob:
+			if len(values) == 0 {
+				return nil
+			}
+			u = sampleGlobURL(values[rnd.IntN(len(values))], rnd)
+		case MatchTypeCIDR:
+			if len(values) == 0 {
+				return nil
+			}
+			u = sampleCIDRURL(values[rnd.IntN(len(values))], rnd)
+		case MatchTypeURL:
+			u = sampleComponentURL(lr.rule, rnd)
+		default:
+			if len(values) == 0 {
+				return nil
+			}
+			u = sampleRegexURL(values[rnd.IntN(len(values))], rnd)
+		}
+		if req := newRouteRequest(u); lr.matcher.match(req) {
+			samples = append(samples, req)
+		}
+	}
+	return samples
+}
+
+var (
+	sampleSubdomains = []string{"", "", "www.", "a.", "x.y."}
+	samplePaths      = []string{"/", "", "/a", "/a/b?c=1", "/x#y", "/index.html"}
+	samplePrefixes   = []string{"", "https://", "https://www.", "http://a.example/", "https://a.example/?u="}
+	sampleSuffixes   = []string{"", "/", "/a", "?q=1", "/x/y#z"}
+)
+
+func pick(rnd *rand.Rand, choices []string) string {
+	return choices[rnd.IntN(len(choices))]
+}
+
+func sampleHostURL(host string, rnd *rand.Rand) string {
+	return "https://" + pick(rnd, sampleSubdomains) + host + pick(rnd, samplePaths)
+}
+
+// sampleCIDRURL returns a URL whose host is a random address in cidr.
+func sampleCIDRURL(cidr string, rnd *rand.Rand) string {
+	p, err := parseCIDR(cidr)
+	if err != nil {
+		return ""
+	}
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		if rnd.IntN(2) == 1 {
+			b[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	host := addr.String()
+	if addr.Is6() {
+		host = "[" + host + "]"
+	}
+	return "http://" + host + pick(rnd, samplePaths)
+}
+
+func sampleGlobURL(glob string, rnd *rand.Rand) string {
+	var b strings.Builder
+	for _, c := range glob {
+		switch c {
+		case '*':
+			b.WriteString(pick(rnd, []string{"", "a", "x.y", "a/b", "q=1"}))
+		case '?':
+			b.WriteByte("abz1"[rnd.IntN(4)])
+		default:
+			b.WriteRune(c)
+		}
+	}
+	s := b.String()
+	if !strings.Contains(glob, "://") {
+		s = "https://" + s
+	}
+	return s
+}
+
+func sampleComponentURL(r Rule, rnd *rand.Rand) string {
+	def := map[string]string{"scheme": "https", "host": "example.com", "port": "", "path": "/", "query": ""}
+	parts := map[string]string{}
+	for _, c := range urlComponents {
+		v := c.value(r)
+		if v == "" {
+			parts[c.name] = def[c.name]
+			continue
+		}
+		re, err := syntax.Parse(v, syntax.Perl)
+		if err != nil {
+			return ""
+		}
+		var b strings.Builder
+		sampleRegex(re.Simplify(), rnd, &b)
+		parts[c.name] = b.String()
+	}
+	u := parts["scheme"] + "://" + parts["host"]
+	if parts["port"] != "" {
+		u += ":" + parts["port"]
+	}
+	if !strings.HasPrefix(parts["path"], "/") {
+		u += "/"
+	}
+	u += parts["path"]
+	if parts["query"] != "" {
+		u += "?" + parts["query"]
+	}
+	return u
+}
+
+// sampleRegexURL generates a string matching expr, padded with URL-like
+// text where the pattern isn't anchored.
+func sampleRegexURL(expr string, rnd *rand.Rand) string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	sampleRegex(re.Simplify(), rnd, &b)
+	s := b.String()
+	if !strings.HasPrefix(strings.TrimPrefix(expr, "(?i)"), "^") {
+		s = pick(rnd, samplePrefixes) + s
+	}
+	if !strings.HasSuffix(expr, "$") {
+		s += pick(rnd, sampleSuffixes)
+	}
+	return s
+}
+
+// sampleRegex appends a random string matching re to b.
+func sampleRegex(re *syntax.Regexp, rnd *rand.Rand, b *strings.Builder) {
+	repeat := func(min, max int) {
+		if max < 0 {
+			max = min + 2
+		}
+		for range min + rnd.IntN(max-min+1) {
+			sampleRegex(re.Sub[0], rnd, b)
+		}
+	}
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		b.WriteRune(sampleCharClass(re.Rune, rnd))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte("abxyz019-._"[rnd.IntN(11)])
+	case syntax.OpCapture:
+		sampleRegex(re.Sub[0], rnd, b)
+	case syntax.OpStar:
+		repeat(0, 2)
+	case syntax.OpPlus:
+		repeat(1, 3)
+	case syntax.OpQuest:
+		repeat(0, 1)
+	case syntax.OpRepeat:
+		repeat(re.Min, min(re.Max, re.Min+2))
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			sampleRegex(sub, rnd, b)
+		}
+	case syntax.OpAlternate:
+		sampleRegex(re.Sub[rnd.IntN(len(re.Sub))], rnd, b)
+	}
+}
+
+// sampleCharClass picks a character from a class given as lo-hi pairs,
+// preferring printable ASCII.
+func sampleCharClass(ranges []rune, rnd *rand.Rand) rune {
+	var printable []rune
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := max(ranges[i], '!'), min(ranges[i+1], '~')
+		for c := lo; c <= hi; c++ {
+			printable = append(printable, c)
+		}
+	}
+	if len(printable) > 0 {
+		return printable[rnd.IntN(len(printable))]
+	}
+	if len(ranges) >= 2 {
+		return ranges[0]
+	}
+	return 'a'
+}
+
+func runConfigLint(configPath string) int {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	findings := lintConfig(cfg)
+	if len(findings) == 0 {
+		fmt.Printf("%s: no problems found\n", configPath)
+		return 0
+	}
+	for _, f := range findings {
+		fmt.Println(f)
+	}
+	return 1
+}
@@ -8,24 +8,79 @@ package main
 import "C"
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/sirupsen/logrus"
+	"github.com/tailscale/hujson"
+	"gopkg.in/yaml.v3"
 )
 
 type Rule struct {
-	Pattern          string `json:"pattern"`
-	ProfileDirectory string `json:"profile_directory"`
+	Name            string    `json:"name,omitempty"`
+	MatchType       MatchType `json:"match_type,omitempty"`
+	Pattern         string    `json:"pattern,omitempty"`
+	Host            string    `json:"host,omitempty"`
+	Site            string    `json:"site,omitempty"`
+	CIDR            string    `json:"cidr,omitempty"`
+	Scheme          string    `json:"scheme,omitempty"`
+	Port            string    `json:"port,omitempty"`
+	Path            string    `json:"path,omitempty"`
+	Query           string    `json:"query,omitempty"`
+	ExcludePatterns []string  `json:"exclude_patterns,omitempty"`
+	CaseInsensitive *bool     `json:"case_insensitive,omitempty"`
+	Priority        int       `json:"priority,omitempty"`
+	Enabled         *bool     `json:"enabled,omitempty"`
+	ExpiresAt       string    `json:"expires_at,omitempty"`
+	Tags            []string  `json:"tags,omitempty"`
+	PatternsFile    string    `json:"patterns_file,omitempty"`
+	PatternsURL     string    `json:"patterns_url,omitempty"`
+	Continue        bool      `json:"continue,omitempty"`
+	Rewrites        []Rewrite `json:"rewrites,omitempty"`
+	Notify          *bool     `json:"notify,omitempty"`
+	RuleConditions
+	Conditions               *ConditionExpr `json:"conditions,omitempty"`
+	Script                   string         `json:"script,omitempty"`
+	Command                  []string       `json:"command,omitempty"`
+	CommandTimeout           string         `json:"command_timeout,omitempty"`
+	listEntries              []string
+	Browser                  string     `json:"browser,omitempty"`
+	Container                string     `json:"container,omitempty"`
+	Space                    string     `json:"space,omitempty"`
+	Channel                  string     `json:"channel,omitempty"`
+	UserDataDir              string     `json:"user_data_dir,omitempty"`
+	Incognito                bool       `json:"incognito,omitempty"`
+	Guest                    bool       `json:"guest,omitempty"`
+	AppMode                  bool       `json:"app_mode,omitempty"`
+	Kiosk                    bool       `json:"kiosk,omitempty"`
+	NewWindow                *bool      `json:"new_window,omitempty"`
+	Background               *bool      `json:"background,omitempty"`
+	LaunchMode               LaunchMode `json:"launch_mode,omitempty"`
+	ReuseTabs                TabReuse   `json:"reuse_tabs,omitempty"`
+	TabGroup                 *TabGroup  `json:"tab_group,omitempty"`
+	WindowDisplay            string     `json:"window_display,omitempty"`
+	WindowBounds             string     `json:"window_bounds,omitempty"`
+	ProfileDirectory         string     `json:"profile_directory"`
+	AskProfiles              []string   `json:"ask_profiles,omitempty"`
+	FallbackProfileDirectory string     `json:"fallback_profile_directory,omitempty"`
+	AppPath                  string     `json:"app_path,omitempty"`
+	BundleID                 string     `json:"bundle_id,omitempty"`
 }
 
 type StrategyForUnknownUrls string
@@ -33,77 +88,819 @@ type StrategyForUnknownUrls string
 const (
 	StrategyForUnknownUrlsUseBrowserDefault StrategyForUnknownUrls = "use-browser-default"
 	StrategyForUnknownUrlsUseDefaultProfile StrategyForUnknownUrls = "use-default-profile"
+	StrategyForUnknownUrlsUseGuestProfile   StrategyForUnknownUrls = "use-guest-profile"
+	StrategyForUnknownUrlsAsk               StrategyForUnknownUrls = "ask"
 )
 
+type MultiMatchPolicy string
+
+const (
+	MultiMatchPolicyFirst  MultiMatchPolicy = "first"
+	MultiMatchPolicyLast   MultiMatchPolicy = "last"
+	MultiMatchPolicyPrompt MultiMatchPolicy = "prompt"
+	MultiMatchPolicyAll    MultiMatchPolicy = "all"
+)
+
+type LaunchMode string
+
+const (
+	LaunchModeOpen LaunchMode = "open"
+	LaunchModeExec LaunchMode = "exec"
+	LaunchModeCDP  LaunchMode = "cdp"
+)
+
+// TabReuse is what makes an open tab count as already showing a URL, so it
+// is focused instead of opening the URL again.
+type TabReuse string
+
+const (
+	TabReuseOff    TabReuse = "off"
+	TabReuseURL    TabReuse = "url"
+	TabReuseOrigin TabReuse = "origin"
+)
+
+type MatchStrategy string
+
+const (
+	MatchStrategyFirstMatch   MatchStrategy = "first-match"
+	MatchStrategyMostSpecific MatchStrategy = "most-specific"
+)
+
+// focusChromeWindowScript brings the browser named by its argument to the
+// front.
 const focusChromeWindowScript = `
+on run argv
 	delay 0.05
-	tell application "Google Chrome"
+	tell application (item 1 of argv)
 		activate
 	end tell
+end run
 `
 
 type Config struct {
+	Schema                  string                 `json:"$schema"`
+	Version                 int                    `json:"version"`
 	ChromeAppPath           string                 `json:"chrome_app_path"`
+	ChromeBundleID          string                 `json:"chrome_bundle_id"`
+	Browsers                map[string]Browser     `json:"browsers"`
+	FallbackBrowsers        []string               `json:"fallback_browsers"`
+	LaunchRetries           *int                   `json:"launch_retries"`
+	LaunchRetryDelay        string                 `json:"launch_retry_delay"`
+	LaunchTimeout           string                 `json:"launch_timeout"`
 	DefaultProfileDirectory string                 `json:"default_profile_directory"`
 	StrategyForUnknownUrls  StrategyForUnknownUrls `json:"strategy_for_unknown_urls"`
+	MatchStrategy           MatchStrategy          `json:"match_strategy"`
+	MultiMatchPolicy        MultiMatchPolicy       `json:"multi_match_policy"`
+	NewWindow               bool                   `json:"new_window"`
+	Background              bool                   `json:"background"`
+	LaunchMode              LaunchMode             `json:"launch_mode"`
+	ReuseTabs               TabReuse               `json:"reuse_tabs"`
+	PickerModifiers         []string               `json:"picker_modifiers"`
+	TrustedSourceApps       []string               `json:"trusted_source_apps"`
+	MenuBar                 bool                   `json:"menu_bar"`
+	PauseHotKey             string                 `json:"pause_hotkey"`
+	ReopenTabHotKey         string                 `json:"reopen_tab_hotkey"`
+	Notify                  bool                   `json:"notify"`
+	RecentLinks             *int                   `json:"recent_links"`
+	CaseInsensitive         bool                   `json:"case_insensitive"`
+	NormalizeURLs           *bool                  `json:"normalize_urls"`
+	Unwrap                  map[string]bool        `json:"unwrap"`
+	ExpandShortLinks        *ShortLinkSettings     `json:"expand_short_links"`
+	Canonicalize            map[string]bool        `json:"canonicalize"`
+	Rewrites                []Rewrite              `json:"rewrites"`
+	GoogleAccounts          map[string]int         `json:"google_accounts"`
+	ProfileSets             map[string][]string    `json:"profile_sets"`
 	Rules                   []Rule                 `json:"rules"`
+	DisabledTags            []string               `json:"disabled_tags"`
+	PatternsRefreshInterval string                 `json:"patterns_refresh_interval"`
+	RuleSets                map[string]RuleSet     `json:"rule_sets"`
+	ActiveRuleSet           string                 `json:"active_rule_set"`
 	LogLevel                string                 `json:"log_level"`
+	Strict                  bool                   `json:"strict"`
+	ConfigURL               string                 `json:"config_url"`
+	ConfigSignatureURL      string                 `json:"config_signature_url"`
+	ConfigPublicKey         string                 `json:"config_public_key"`
+	PidFile                 string                 `json:"pid_file"`
+	LogFile                 string                 `json:"log_file"`
 	compiledRules           []compiledRule
+	disabledTags            map[string]bool
+	patternFiles            []string
+	scriptFiles             []string
+	patternURLs             []string
+	patternsRefreshInterval time.Duration
+	launchRetries           int
+	recentLinks             int // how many routed links recent.json keeps
+	launchRetryDelay        time.Duration
+	launchTimeout           time.Duration
+	path                    string   // file the config was loaded from
+	warnings                []string // problems that didn't stop it from loading
+	paused                  bool     // routing is paused, see pause.go
+	pauseHotKey             hotKey
+	reopenTabHotKey         hotKey
+	override                routeOverride
+	tabGroups               bool // some rule puts its tabs in a tab group
+	pickerModifiers         uint
+	unwrappers              []unwrapper
+	shortLinks              *shortLinkExpander
+	canonicalizers          []canonicalizer
+	channels                map[string]Browser // Chrome channels used by rules, by browser name
+	rewrites                []compiledRewrite
 	parsedLogLevel          logrus.Level
 }
 
 type compiledRule struct {
-	re               *regexp.Regexp
-	profileDirectory string
+	index                    int // position in Config.Rules
+	matcher                  urlMatcher
+	cont                     bool
+	rewrites                 []compiledRewrite // applied before later rules see the URL, with cont
+	carried                  carriedOptions    // added to the final target, with cont
+	browser                  string
+	container                string
+	space                    string
+	userDataDir              string // passed to Chrome as --user-data-dir
+	profilesDir              string // where the browser keeps its profiles
+	incognito                bool
+	guest                    bool
+	appMode                  bool
+	kiosk                    bool
+	newWindow                bool
+	background               bool
+	launchMode               LaunchMode
+	reuseTab                 TabReuse
+	tabGroup                 TabGroup
+	windowDisplay            string
+	windowBounds             string
+	profileDirectory         string
+	fallbackProfileDirectory string
+	askProfiles              []string // profiles the user picks among, none to open profileDirectory
+	appPath                  string
+	bundleID                 string
+	resolver                 profileResolver
+	captures                 *regexp.Regexp // set when the profiles reference capture groups
 }
 
-var urlListener chan string = make(chan string)
-var pidFilePath string = filepath.Join("/tmp", "chrome-profile-router.pid")
-var logFilePath string = filepath.Join("/tmp", "chrome-profile-router.log")
+// route returns where req opens under the rule, and whether the rule
+// applies to it at all. Rules with a script or command apply only when it
+// picks a profile.
+func (r compiledRule) route(req *routeRequest) (launchTarget, bool) {
+	if !r.matcher.match(req) {
+		return launchTarget{}, false
+	}
+	if r.appPath != "" || r.bundleID != "" {
+		return launchTarget{appPath: r.appPath, bundleID: r.bundleID, background: r.background}, true
+	}
+	dir, fallback := r.profileDirectory, r.fallbackProfileDirectory
+	if r.captures != nil {
+		dir, fallback = expandCaptures(r.captures, req.raw, dir), expandCaptures(r.captures, req.raw, fallback)
+	}
+	if r.resolver != nil {
+		if dir = r.resolver.profile(req); dir == "" {
+			return launchTarget{}, false
+		}
+	}
+	return launchTarget{
+		browser:       r.browser,
+		userDataDir:   r.userDataDir,
+		profile:       profileOrFallback(r.profilesDir, dir, fallback),
+		incognito:     r.incognito,
+		guest:         r.guest,
+		appMode:       r.appMode,
+		kiosk:         r.kiosk,
+		newWindow:     r.newWindow,
+		background:    r.background,
+		launchMode:    r.launchMode,
+		reuseTab:      r.reuseTab,
+		tabGroup:      r.tabGroup,
+		windowDisplay: r.windowDisplay,
+		windowBounds:  r.windowBounds,
+		container:     r.container,
+		space:         r.space,
+	}, true
+}
+
+// profileOrFallback returns dir, switching to fallback when dir doesn't
+// exist in profilesDir, since Chrome would otherwise silently create an
+// empty profile with that name.
+func profileOrFallback(profilesDir, dir, fallback string) string {
+	if dir == "" || dir == ephemeralProfile || fallback == "" || profilesDir == "" || chromeProfileExists(profilesDir, dir) {
+		return dir
+	}
+	if logger != nil {
+		logger.Infof("Profile %q not found, using fallback %q", dir, fallback)
+	}
+	return fallback
+}
+
+// urlListener is buffered so the main thread, which receives the URLs,
+// isn't held up while the profile picker waits for an answer.
+var urlListener chan *routeRequest = make(chan *routeRequest, 64)
 var logger *logrus.Logger = nil
 
-func defaultConfigPath() string {
+// strictConfig is set by --strict and makes loadConfig reject unknown keys
+// regardless of the config's own "strict" setting.
+var strictConfig bool = false
+
+// configPathEnv names the environment variable that overrides the config path.
+const configPathEnv = "CHROME_PROFILE_ROUTER_CONFIG"
+
+// configFileNames lists the file names looked up in the config directory, in
+// order of preference.
+var configFileNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+const appDirName = "chrome-profile-router"
+
+// xdgDir returns $<envVar>/chrome-profile-router, or ~/<fallback>/chrome-profile-router
+// when the variable is unset. Relative values are ignored as the XDG spec
+// requires.
+func xdgDir(envVar, fallback string) string {
+	if dir := os.Getenv(envVar); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appDirName)
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return ""
 	}
-	return filepath.Join(home, ".config", "chrome-profile-router", "config.json")
+	return filepath.Join(home, fallback, appDirName)
 }
 
-func loadConfig(path string) (Config, error) {
+func defaultConfigPath() string {
+	dir := xdgDir("XDG_CONFIG_HOME", ".config")
+	if dir == "" {
+		return ""
+	}
+	for _, name := range configFileNames {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return filepath.Join(dir, configFileNames[0])
+}
+
+// defaultStateDir is where the log file lives unless configured otherwise.
+func defaultStateDir() string {
+	if dir := xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state")); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), appDirName)
+}
+
+// defaultRuntimeDir is where the pid file lives unless configured otherwise.
+func defaultRuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appDirName)
+	}
+	return defaultStateDir()
+}
+
+// resolveConfigPath picks the config file to load: the --config flag wins over
+// the environment variable, which wins over the default location.
+func resolveConfigPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if p := os.Getenv(configPathEnv); p != "" {
+		return p
+	}
+	return defaultConfigPath()
+}
+
+// filterLaunchArgs drops the -psn_* process serial number argument that Launch
+// Services passes to apps started from Finder on older macOS versions.
+func filterLaunchArgs(args []string) []string {
+	var out []string
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-psn_") {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// configToJSON converts the raw config file contents into JSON based on the
+// file extension, so every format shares the same decoding and defaults.
+func configToJSON(path string, data []byte) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("parse config YAML: %w", err)
+		}
+		if doc == nil {
+			return []byte("{}"), nil
+		}
+		out, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("convert config YAML: %w", err)
+		}
+		return out, nil
+	case ".plist":
+		return plistToJSON(data)
+	case ".toml":
+		var doc map[string]interface{}
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("parse config TOML: %w", err)
+		}
+		out, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("convert config TOML: %w", err)
+		}
+		return out, nil
+	default:
+		// JSON configs may contain comments and trailing commas (JWCC).
+		out, err := hujson.Standardize(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse config JSON: %w", err)
+		}
+		return out, nil
+	}
+}
+
+var envVarRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} references with the value of the environment
+// variable NAME; unset variables expand to an empty string. Bare $NAME is left
+// alone since `$` is meaningful in regex patterns.
+func expandEnv(s string) string {
+	return expandEnvExcept(s, nil)
+}
+
+// expandEnvExcept is expandEnv leaving references to the names in keep
+// alone.
+func expandEnvExcept(s string, keep []string) string {
+	return envVarRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := envVarRe.FindStringSubmatch(m)[1]
+		if slices.Contains(keep, name) {
+			return m
+		}
+		return os.Getenv(name)
+	})
+}
+
+// checkUnknownConfigFields decodes the merged config document again while
+// rejecting keys that don't correspond to a config field, pointing at the
+// offending rule when possible.
+func checkUnknownConfigFields(data []byte) error {
+	strictDecode := func(data []byte, v interface{}) error {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(v)
+	}
+
 	var cfg Config
+	err := strictDecode(data, &cfg)
+	if err == nil {
+		return nil
+	}
+	var raw struct {
+		Rules    []json.RawMessage          `json:"rules"`
+		RuleSets map[string]json.RawMessage `json:"rule_sets"`
+	}
+	if json.Unmarshal(data, &raw) == nil {
+		for i, r := range raw.Rules {
+			var rule Rule
+			if err := strictDecode(r, &rule); err != nil {
+				return fmt.Errorf("strict config: rule %d: %w", i, err)
+			}
+		}
+		for name, set := range raw.RuleSets {
+			var rs RuleSet
+			if err := strictDecode(set, &rs); err != nil {
+				return fmt.Errorf("strict config: rule set %q: %w", name, err)
+			}
+		}
+	}
+	return fmt.Errorf("strict config: %w", err)
+}
 
+// readConfigFile reads the config file at path and returns its contents
+// converted to JSON.
+func readConfigFile(path string) ([]byte, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return cfg, fmt.Errorf("open config: %w", err)
+		return nil, fmt.Errorf("open config: %w", err)
 	}
 	defer f.Close()
 
 	data, err := io.ReadAll(f)
 	if err != nil {
-		return cfg, fmt.Errorf("read config: %w", err)
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	data, err = configToJSON(path, data)
+	if err != nil {
+		return nil, err
+	}
+	return migrateConfigJSON(data)
+}
+
+func loadConfig(path string) (Config, error) {
+	var cfg Config
+
+	managed := managedConfigPaths()
+	data, err := readConfigFile(path)
+	if errors.Is(err, fs.ErrNotExist) && len(managed) > 0 {
+		// Managed preferences alone are a complete config.
+		data, err = []byte("{}"), nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	fragments, err := configFragmentPaths(confDirPath(path))
+	if err != nil {
+		return cfg, err
+	}
+	if len(fragments) > 0 {
+		if data, err = mergeConfigFragments(data, fragments); err != nil {
+			return cfg, err
+		}
+	}
+	if len(managed) > 0 {
+		if data, err = applyManagedConfig(data, managed); err != nil {
+			return cfg, err
+		}
+	}
+	var warnings []string
+	if data, warnings, err = applyRemoteConfig(data); err != nil {
+		return cfg, err
+	}
+	if data, err = applyRuleSet(data); err != nil {
+		return cfg, err
 	}
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return cfg, fmt.Errorf("parse config JSON: %w", err)
 	}
+	cfg.path = path
+	cfg.warnings = warnings
+	if cfg.Strict || strictConfig {
+		if err := checkUnknownConfigFields(data); err != nil {
+			return cfg, err
+		}
+	}
+
+	cfg.ChromeAppPath = expandEnv(cfg.ChromeAppPath)
+	for name, b := range cfg.Browsers {
+		b.AppPath, b.UserDataDir = expandEnv(b.AppPath), expandEnv(b.UserDataDir)
+		cfg.Browsers[name] = b
+	}
+	cfg.DefaultProfileDirectory = expandEnv(cfg.DefaultProfileDirectory)
+	cfg.PidFile = expandEnv(cfg.PidFile)
+	cfg.LogFile = expandEnv(cfg.LogFile)
+	for i := range cfg.Rules {
+		cfg.Rules[i].Pattern = expandEnv(cfg.Rules[i].Pattern)
+		cfg.Rules[i].Host = expandEnv(cfg.Rules[i].Host)
+		cfg.Rules[i].Site = expandEnv(cfg.Rules[i].Site)
+		cfg.Rules[i].CIDR = expandEnv(cfg.Rules[i].CIDR)
+		cfg.Rules[i].Path = expandEnv(cfg.Rules[i].Path)
+		cfg.Rules[i].Query = expandEnv(cfg.Rules[i].Query)
+		cfg.Rules[i].PatternsFile = expandEnv(cfg.Rules[i].PatternsFile)
+		cfg.Rules[i].Script = expandEnv(cfg.Rules[i].Script)
+		cfg.Rules[i].AppPath = expandEnv(cfg.Rules[i].AppPath)
+		cfg.Rules[i].UserDataDir = expandEnv(cfg.Rules[i].UserDataDir)
+		for j, arg := range cfg.Rules[i].Command {
+			cfg.Rules[i].Command[j] = expandEnv(arg)
+		}
+		for j, p := range cfg.Rules[i].ExcludePatterns {
+			cfg.Rules[i].ExcludePatterns[j] = expandEnv(p)
+		}
+		// ${name} in a profile refers to the capture group of that name
+		// rather than an environment variable.
+		groups := captureGroupNames(cfg.Rules[i].Pattern)
+		cfg.Rules[i].ProfileDirectory = expandEnvExcept(cfg.Rules[i].ProfileDirectory, groups)
+		cfg.Rules[i].FallbackProfileDirectory = expandEnvExcept(cfg.Rules[i].FallbackProfileDirectory, groups)
+	}
 
+	if cfg.ChromeAppPath == "" && cfg.ChromeBundleID != "" {
+		cfg.ChromeAppPath = appPathForBundleID(cfg.ChromeBundleID)
+	}
 	if cfg.ChromeAppPath == "" {
-		cfg.ChromeAppPath = "/Applications/Google Chrome.app"
+		cfg.ChromeAppPath = detectChromeAppPath()
 	}
 	if cfg.DefaultProfileDirectory == "" {
 		cfg.DefaultProfileDirectory = "Default"
 	}
+	if err := checkBrowsers(cfg.Browsers); err != nil {
+		return cfg, err
+	}
+	if err := checkFallbackBrowsers(cfg.FallbackBrowsers, cfg.Browsers); err != nil {
+		return cfg, err
+	}
+	if cfg.PidFile == "" {
+		cfg.PidFile = filepath.Join(defaultRuntimeDir(), "chrome-profile-router.pid")
+	}
+	if cfg.LogFile == "" {
+		cfg.LogFile = filepath.Join(defaultStateDir(), "chrome-profile-router.log")
+	}
+
+	switch cfg.MatchStrategy {
+	case "":
+		cfg.MatchStrategy = MatchStrategyFirstMatch
+	case MatchStrategyFirstMatch, MatchStrategyMostSpecific:
+	default:
+		return cfg, fmt.Errorf("unknown match_strategy %q", cfg.MatchStrategy)
+	}
+	switch cfg.MultiMatchPolicy {
+	case "":
+		cfg.MultiMatchPolicy = MultiMatchPolicyFirst
+	case MultiMatchPolicyFirst, MultiMatchPolicyLast, MultiMatchPolicyPrompt, MultiMatchPolicyAll:
+	default:
+		return cfg, fmt.Errorf("unknown multi_match_policy %q", cfg.MultiMatchPolicy)
+	}
+	switch cfg.LaunchMode {
+	case "":
+		cfg.LaunchMode = LaunchModeOpen
+	case LaunchModeOpen, LaunchModeExec, LaunchModeCDP:
+	default:
+		return cfg, fmt.Errorf("unknown launch_mode %q", cfg.LaunchMode)
+	}
+	switch cfg.ReuseTabs {
+	case "":
+		cfg.ReuseTabs = TabReuseOff
+	case TabReuseOff, TabReuseURL, TabReuseOrigin:
+	default:
+		return cfg, fmt.Errorf("unknown reuse_tabs %q", cfg.ReuseTabs)
+	}
+	if cfg.PickerModifiers == nil {
+		cfg.PickerModifiers = defaultPickerModifiers
+	}
+	for _, name := range cfg.PickerModifiers {
+		flag, ok := modifierFlags[name]
+		if !ok {
+			return cfg, fmt.Errorf("unknown picker_modifiers key %q", name)
+		}
+		cfg.pickerModifiers |= flag
+	}
+	if cfg.unwrappers, err = compileUnwrappers(cfg.Unwrap); err != nil {
+		return cfg, err
+	}
+	if cfg.shortLinks, err = compileShortLinks(cfg.ExpandShortLinks); err != nil {
+		return cfg, err
+	}
+	if cfg.canonicalizers, err = compileCanonicalizers(cfg.Canonicalize); err != nil {
+		return cfg, err
+	}
+	if cfg.rewrites, err = compileRewrites(cfg.Rewrites); err != nil {
+		return cfg, err
+	}
+	if err := checkGoogleAccounts(cfg.GoogleAccounts); err != nil {
+		return cfg, err
+	}
+	if err := checkProfileSets(cfg.ProfileSets); err != nil {
+		return cfg, err
+	}
+
+	cfg.patternsRefreshInterval = defaultPatternsRefreshInterval
+	if cfg.PatternsRefreshInterval != "" {
+		d, err := time.ParseDuration(cfg.PatternsRefreshInterval)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("patterns_refresh_interval %q is not a positive duration such as \"6h\"", cfg.PatternsRefreshInterval)
+		}
+		cfg.patternsRefreshInterval = d
+	}
+	cfg.launchRetries = defaultLaunchRetries
+	if cfg.LaunchRetries != nil {
+		if *cfg.LaunchRetries < 0 {
+			return cfg, fmt.Errorf("launch_retries %d is negative", *cfg.LaunchRetries)
+		}
+		cfg.launchRetries = *cfg.LaunchRetries
+	}
+	cfg.recentLinks = defaultRecentLinks
+	if cfg.RecentLinks != nil {
+		if *cfg.RecentLinks < 0 {
+			return cfg, fmt.Errorf("recent_links %d is negative", *cfg.RecentLinks)
+		}
+		cfg.recentLinks = *cfg.RecentLinks
+	}
+	cfg.launchRetryDelay = defaultLaunchRetryDelay
+	if cfg.LaunchRetryDelay != "" {
+		d, err := time.ParseDuration(cfg.LaunchRetryDelay)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("launch_retry_delay %q is not a positive duration such as \"1s\"", cfg.LaunchRetryDelay)
+		}
+		cfg.launchRetryDelay = d
+	}
+	cfg.launchTimeout = defaultLaunchTimeout
+	if cfg.LaunchTimeout != "" {
+		d, err := time.ParseDuration(cfg.LaunchTimeout)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("launch_timeout %q is not a positive duration such as \"10s\"", cfg.LaunchTimeout)
+		}
+		cfg.launchTimeout = d
+	}
+
+	if cfg.disabledTags, err = disabledTagSet(cfg.DisabledTags); err != nil {
+		return cfg, err
+	}
+	cfg.paused = routingPaused()
+	if cfg.override, err = readOverride(); err != nil {
+		return cfg, err
+	}
+	if cfg.PauseHotKey != "" {
+		if cfg.pauseHotKey, err = parseHotKey(cfg.PauseHotKey); err != nil {
+			return cfg, fmt.Errorf("pause_hotkey: %w", err)
+		}
+	}
+	if cfg.ReopenTabHotKey != "" {
+		if cfg.reopenTabHotKey, err = parseHotKey(cfg.ReopenTabHotKey); err != nil {
+			return cfg, fmt.Errorf("reopen_tab_hotkey: %w", err)
+		}
+		if cfg.reopenTabHotKey == cfg.pauseHotKey {
+			return cfg, fmt.Errorf("reopen_tab_hotkey: %q is also pause_hotkey", cfg.ReopenTabHotKey)
+		}
+	}
 
 	var cr []compiledRule
-	for i, r := range cfg.Rules {
-		if r.Pattern == "" || r.ProfileDirectory == "" {
-			return cfg, fmt.Errorf("rule %d invalid: pattern and profile_directory are required", i)
+	for _, i := range ruleOrder(cfg.Rules, cfg.MatchStrategy) {
+		r := cfg.Rules[i]
+		if !cfg.ruleEnabled(r) {
+			continue
+		}
+		opensApp := r.AppPath != "" || r.BundleID != ""
+		if r.Channel != "" {
+			if r.Browser != "" || opensApp {
+				return cfg, fmt.Errorf("rule %d invalid: channel can't be used with browser, app_path, or bundle_id", i)
+			}
+			name, b, err := channelBrowser(r.Channel)
+			if err != nil {
+				return cfg, fmt.Errorf("rule %d invalid: %w", i, err)
+			}
+			if name != "" {
+				if cfg.channels == nil {
+					cfg.channels = map[string]Browser{}
+				}
+				cfg.channels[name] = b
+			}
+			r.Browser = name
 		}
-		re, err := regexp.Compile(r.Pattern)
+		browserType := cfg.browserType(r.Browser)
+		if r.ProfileDirectory == "" && len(r.AskProfiles) == 0 && !r.Continue && !r.resolvesProfile() && !opensApp && browserType == browserTypeChromium && r.UserDataDir == "" && !r.Guest {
+			return cfg, fmt.Errorf("rule %d invalid: profile_directory is required", i)
+		}
+		switch {
+		case r.AppPath != "" && r.BundleID != "":
+			return cfg, fmt.Errorf("rule %d invalid: app_path and bundle_id can't be used together", i)
+		case opensApp && (r.ProfileDirectory != "" || r.FallbackProfileDirectory != ""):
+			return cfg, fmt.Errorf("rule %d invalid: profile directories can't be used with app_path or bundle_id", i)
+		case opensApp && r.resolvesProfile():
+			return cfg, fmt.Errorf("rule %d invalid: script and command can't be used with app_path or bundle_id", i)
+		case opensApp && r.Browser != "":
+			return cfg, fmt.Errorf("rule %d invalid: browser can't be used with app_path or bundle_id", i)
+		case len(r.AskProfiles) > 0 && (opensApp || browserType != browserTypeChromium):
+			return cfg, fmt.Errorf("rule %d invalid: ask_profiles requires a Chromium-based browser", i)
+		case len(r.AskProfiles) > 0 && (r.ProfileDirectory != "" || r.FallbackProfileDirectory != "" || r.resolvesProfile() || r.Guest || r.Continue):
+			return cfg, fmt.Errorf("rule %d invalid: ask_profiles takes the place of profile_directory, so it can't be used with profile directories, script, command, guest, or continue", i)
+		case len(r.AskProfiles) == 1 || slices.Contains(r.AskProfiles, ""):
+			return cfg, fmt.Errorf("rule %d invalid: ask_profiles needs at least two profile directories to choose between", i)
+		}
+		if _, ok := cfg.browser(r.Browser); r.Browser != "" && !ok {
+			return cfg, fmt.Errorf("rule %d invalid: browser %q isn't defined in browsers", i, r.Browser)
+		}
+		switch {
+		case browserType == browserTypeFirefox && (r.ProfileDirectory != "" || r.FallbackProfileDirectory != "" || r.resolvesProfile()):
+			return cfg, fmt.Errorf("rule %d invalid: Firefox browsers take a container rather than a profile", i)
+		case r.Container != "" && browserType != browserTypeFirefox:
+			return cfg, fmt.Errorf("rule %d invalid: container requires a browser of type firefox", i)
+		case browserType == browserTypeArc && (r.ProfileDirectory != "" || r.FallbackProfileDirectory != "" || r.resolvesProfile()):
+			return cfg, fmt.Errorf("rule %d invalid: Arc browsers take a space rather than a profile", i)
+		case r.Space != "" && browserType != browserTypeArc:
+			return cfg, fmt.Errorf("rule %d invalid: space requires a browser of type arc", i)
+		case r.UserDataDir != "" && (opensApp || browserType != browserTypeChromium):
+			return cfg, fmt.Errorf("rule %d invalid: user_data_dir requires a Chromium-based browser", i)
+		case r.Incognito && (opensApp || browserType != browserTypeChromium):
+			return cfg, fmt.Errorf("rule %d invalid: incognito requires a Chromium-based browser", i)
+		case r.AppMode && (opensApp || browserType != browserTypeChromium):
+			return cfg, fmt.Errorf("rule %d invalid: app_mode requires a Chromium-based browser", i)
+		case r.Kiosk && (opensApp || browserType != browserTypeChromium):
+			return cfg, fmt.Errorf("rule %d invalid: kiosk requires a Chromium-based browser", i)
+		case r.LaunchMode != "" && r.LaunchMode != LaunchModeOpen && r.LaunchMode != LaunchModeExec && r.LaunchMode != LaunchModeCDP:
+			return cfg, fmt.Errorf("rule %d invalid: unknown launch_mode %q", i, r.LaunchMode)
+		case r.LaunchMode != "" && (opensApp || browserType != browserTypeChromium):
+			return cfg, fmt.Errorf("rule %d invalid: launch_mode requires a Chromium-based browser", i)
+		case r.ReuseTabs != "" && r.ReuseTabs != TabReuseOff && r.ReuseTabs != TabReuseURL && r.ReuseTabs != TabReuseOrigin:
+			return cfg, fmt.Errorf("rule %d invalid: unknown reuse_tabs %q", i, r.ReuseTabs)
+		case r.ReuseTabs != "" && r.ReuseTabs != TabReuseOff && (opensApp || browserType != browserTypeChromium || targetLaunchMode(r.LaunchMode, cfg.LaunchMode) != LaunchModeCDP):
+			return cfg, fmt.Errorf("rule %d invalid: reuse_tabs requires a Chromium-based browser with launch_mode cdp", i)
+		case r.TabGroup != nil && (opensApp || browserType != browserTypeChromium || targetLaunchMode(r.LaunchMode, cfg.LaunchMode) != LaunchModeCDP):
+			return cfg, fmt.Errorf("rule %d invalid: tab_group requires a Chromium-based browser with launch_mode cdp", i)
+		case r.TabGroup != nil && (r.Incognito || r.Guest || r.AppMode || r.Kiosk || r.ProfileDirectory == ephemeralProfile):
+			return cfg, fmt.Errorf("rule %d invalid: tab_group can't be used with incognito, guest, app_mode, kiosk, or %s, which aren't opened through the DevTools protocol", i, ephemeralProfile)
+		case (r.WindowDisplay != "" || r.WindowBounds != "") && opensApp:
+			return cfg, fmt.Errorf("rule %d invalid: window_display and window_bounds require a browser", i)
+		case (r.WindowDisplay != "" || r.WindowBounds != "") && r.opensInBackground(cfg.Background):
+			return cfg, fmt.Errorf("rule %d invalid: window_display and window_bounds can't be used with background, which leaves another window in front", i)
+		case r.NewWindow != nil && (opensApp || browserType != browserTypeChromium):
+			return cfg, fmt.Errorf("rule %d invalid: new_window requires a Chromium-based browser", i)
+		case r.Guest && (opensApp || browserType != browserTypeChromium):
+			return cfg, fmt.Errorf("rule %d invalid: guest requires a Chromium-based browser", i)
+		case r.Guest && (r.ProfileDirectory != "" || r.FallbackProfileDirectory != "" || r.resolvesProfile() || r.Incognito):
+			return cfg, fmt.Errorf("rule %d invalid: guest opens Chrome's Guest profile, so it can't be used with a profile or incognito", i)
+		case r.ProfileDirectory == ephemeralProfile && (r.UserDataDir != "" || browserType != browserTypeChromium):
+			return cfg, fmt.Errorf("rule %d invalid: %s can't be used with user_data_dir or a browser that isn't Chromium-based", i, ephemeralProfile)
+		case browserType == browserTypeSafari && r.ProfileDirectory != "" && r.Background != nil && *r.Background:
+			return cfg, fmt.Errorf("rule %d invalid: background can't be used with Safari profiles, which are opened through Safari's menus", i)
+		case browserType == browserTypeSafari && r.FallbackProfileDirectory != "":
+			return cfg, fmt.Errorf("rule %d invalid: fallback_profile_directory can't be used with Safari, whose profiles can't be checked", i)
+		}
+		profilesDir := cfg.browserUserDataDir(r.Browser)
+		if r.UserDataDir != "" {
+			r.UserDataDir = resolveConfigRelativePath(path, r.UserDataDir)
+			profilesDir = r.UserDataDir
+		}
+		if r.PatternsFile != "" {
+			file := resolveConfigRelativePath(path, r.PatternsFile)
+			if r.listEntries, err = readPatternsFile(file); err != nil {
+				return cfg, fmt.Errorf("rule %d: %w", i, err)
+			}
+			cfg.Rules[i].listEntries = r.listEntries
+			cfg.patternFiles = append(cfg.patternFiles, file)
+		}
+		if r.PatternsURL != "" {
+			if err := validateHTTPSURL("patterns_url", r.PatternsURL); err != nil {
+				return cfg, fmt.Errorf("rule %d: %w", i, err)
+			}
+			r.listEntries = append(r.listEntries, readCachedPatternList(r.PatternsURL)...)
+			cfg.Rules[i].listEntries = r.listEntries
+			cfg.patternURLs = append(cfg.patternURLs, r.PatternsURL)
+		}
+		if len(r.listEntries) > 0 {
+			var skipped []string
+			r.listEntries, skipped = validListEntries(r)
+			cfg.Rules[i].listEntries = r.listEntries
+			for _, msg := range skipped {
+				cfg.warnings = append(cfg.warnings, fmt.Sprintf("rule %d: skipped pattern list entry %s", i, msg))
+			}
+		}
+		m, err := compileRule(i, r, r.foldCase(cfg.CaseInsensitive))
+		if err != nil {
+			return cfg, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if len(r.Rewrites) > 0 && !r.Continue {
+			return cfg, fmt.Errorf("rule %d invalid: rewrites requires continue, so that later rules see the rewritten URL", i)
+		}
+		rewrites, err := compileRewrites(r.Rewrites)
 		if err != nil {
-			return cfg, fmt.Errorf("rule %d: compile regexp: %w", i, err)
+			return cfg, fmt.Errorf("rule %d: %w", i, err)
+		}
+		rule := compiledRule{
+			index:                    i,
+			matcher:                  m,
+			cont:                     r.Continue,
+			rewrites:                 rewrites,
+			carried:                  r.carriedOptions(),
+			browser:                  r.Browser,
+			container:                r.Container,
+			space:                    r.Space,
+			userDataDir:              r.UserDataDir,
+			profilesDir:              profilesDir,
+			incognito:                r.Incognito,
+			guest:                    r.Guest,
+			appMode:                  r.AppMode,
+			kiosk:                    r.Kiosk,
+			newWindow:                r.opensNewWindow(cfg.NewWindow),
+			background:               r.opensInBackground(cfg.Background),
+			launchMode:               targetLaunchMode(r.LaunchMode, cfg.LaunchMode),
+			reuseTab:                 targetTabReuse(r.ReuseTabs, cfg.ReuseTabs),
+			profileDirectory:         r.ProfileDirectory,
+			fallbackProfileDirectory: r.FallbackProfileDirectory,
+			askProfiles:              r.AskProfiles,
+			appPath:                  r.AppPath,
+			bundleID:                 r.BundleID,
+			windowDisplay:            r.WindowDisplay,
+			windowBounds:             r.WindowBounds,
+		}
+		if r.WindowBounds != "" {
+			if _, err := parseWindowBounds(r.WindowBounds); err != nil {
+				return cfg, fmt.Errorf("rule %d: %w", i, err)
+			}
+		}
+		if r.TabGroup != nil {
+			if err := r.TabGroup.validate(); err != nil {
+				return cfg, fmt.Errorf("rule %d: %w", i, err)
+			}
+			rule.tabGroup = *r.TabGroup
+			cfg.tabGroups = true
+		}
+		if hasCaptureRefs(r.ProfileDirectory) || hasCaptureRefs(r.FallbackProfileDirectory) {
+			if rule.captures, err = compileCaptures(r, r.foldCase(cfg.CaseInsensitive)); err != nil {
+				return cfg, fmt.Errorf("rule %d: %w", i, err)
+			}
+		}
+		switch {
+		case r.Script != "" && len(r.Command) > 0:
+			return cfg, fmt.Errorf("rule %d invalid: script and command can't be used together", i)
+		case r.Script != "":
+			file := resolveConfigRelativePath(path, r.Script)
+			if rule.resolver, err = loadRouteScript(file); err != nil {
+				return cfg, fmt.Errorf("rule %d: %w", i, err)
+			}
+			cfg.scriptFiles = append(cfg.scriptFiles, file)
+		case len(r.Command) > 0:
+			if rule.resolver, err = newResolverCommand(path, r.Command, r.CommandTimeout); err != nil {
+				return cfg, fmt.Errorf("rule %d: %w", i, err)
+			}
+		case r.CommandTimeout != "":
+			return cfg, fmt.Errorf("rule %d invalid: command_timeout requires command", i)
 		}
-		cr = append(cr, compiledRule{re: re, profileDirectory: r.ProfileDirectory})
+		cr = append(cr, rule)
 	}
 	cfg.compiledRules = cr
 
@@ -119,21 +916,155 @@ func loadConfig(path string) (Config, error) {
 	return cfg, nil
 }
 
-func chooseProfile(urlStr string, config Config) string {
-	for _, r := range config.compiledRules {
-		if r.re.MatchString(urlStr) {
-			return r.profileDirectory
+// routeTargets returns where req should open according to the multi-match
+// policy, with the index in Config.Rules of the rule that chose each target,
+// -1 for none. With the prompt policy, every candidate is returned. It also
+// reports whether the user should be asked among the targets: because a
+// rule with ask_profiles matched, or because no rule matched under the ask
+// strategy, which returns every profile.
+//
+// Matching rules with continue set don't end evaluation. Their rewrites
+// change req for the rules after them, the options they set are added to
+// every target returned, and the target of the last of them that has one is
+// used only when no other rule matches.
+func routeTargets(req *routeRequest, config Config) ([]launchTarget, []int, bool) {
+	rules := config.compiledRules
+	if config.MultiMatchPolicy == MultiMatchPolicyLast {
+		rules = slices.Clone(rules)
+		slices.Reverse(rules)
+	}
+	every := config.MultiMatchPolicy == MultiMatchPolicyAll || config.MultiMatchPolicy == MultiMatchPolicyPrompt
+
+	var targets []launchTarget
+	var ruleOf []int
+	var continued launchTarget
+	continuedRule := -1
+	var carried carriedOptions
+	ask := false
+	seen := map[launchTarget]bool{}
+	for _, r := range rules {
+		target, ok := r.route(req)
+		if !ok {
+			continue
+		}
+		if r.cont {
+			if r.hasTarget() {
+				continued, continuedRule = target, r.index
+			}
+			carried = carried.add(r.carried)
+			if raw := applyRewrites(req.raw, r.rewrites); raw != req.raw {
+				if logger != nil {
+					logger.Debugf("Rule %d rewrote %s to %s", r.index, req.raw, raw)
+				}
+				req.setURL(raw)
+			}
+			continue
 		}
+		candidates := []launchTarget{target}
+		if len(r.askProfiles) > 0 {
+			candidates, ask = r.askTargets(target), true
+		}
+		for _, t := range candidates {
+			if t = carried.applyTo(t); !seen[t] {
+				seen[t] = true
+				targets = append(targets, t)
+				ruleOf = append(ruleOf, r.index)
+			}
+		}
+		if !every {
+			break
+		}
+	}
+	if len(targets) > 0 {
+		return targets, ruleOf, ask
+	}
+	if continuedRule >= 0 {
+		return []launchTarget{carried.applyTo(continued)}, []int{continuedRule}, false
+	}
+	switch config.StrategyForUnknownUrls {
+	case StrategyForUnknownUrlsUseDefaultProfile:
+		return []launchTarget{config.profileTarget(config.DefaultProfileDirectory)}, []int{-1}, false
+	case StrategyForUnknownUrlsUseGuestProfile:
+		t := config.profileTarget("")
+		t.guest = true
+		return []launchTarget{t}, []int{-1}, false
+	case StrategyForUnknownUrlsAsk:
+		targets = pickerTargets(nil, config)
+		return targets, slices.Repeat([]int{-1}, len(targets)), true
+	}
+	return []launchTarget{config.profileTarget("")}, []int{-1}, false // StrategyForUnknownUrlsUseBrowserDefault
+}
+
+// hasTarget reports whether the rule says where URLs open, rather than only
+// how, which rules with continue needn't.
+func (r compiledRule) hasTarget() bool {
+	return r.profileDirectory != "" || r.resolver != nil || r.appPath != "" || r.bundleID != "" ||
+		r.guest || r.browser != "" || r.userDataDir != ""
+}
+
+// carriedOptions are the launch options a rule with continue sets itself,
+// which the rules after it don't turn off.
+type carriedOptions struct {
+	incognito  bool
+	newWindow  bool
+	background bool
+}
+
+// carriedOptions returns the options the rule turns on itself, rather than
+// through the top-level defaults.
+func (r Rule) carriedOptions() carriedOptions {
+	return carriedOptions{
+		incognito:  r.Incognito,
+		newWindow:  r.NewWindow != nil && *r.NewWindow,
+		background: r.Background != nil && *r.Background,
+	}
+}
+
+func (o carriedOptions) add(other carriedOptions) carriedOptions {
+	return carriedOptions{
+		incognito:  o.incognito || other.incognito,
+		newWindow:  o.newWindow || other.newWindow,
+		background: o.background || other.background,
 	}
-	if config.StrategyForUnknownUrls == StrategyForUnknownUrlsUseDefaultProfile {
-		return config.DefaultProfileDirectory
+}
+
+// applyTo turns the options on in t, leaving out those its kind of target
+// doesn't have: apps have no windows or Incognito, and the Guest profile
+// has no Incognito.
+func (o carriedOptions) applyTo(t launchTarget) launchTarget {
+	t.background = t.background || o.background
+	if t.opensApp() {
+		return t
+	}
+	t.newWindow = t.newWindow || o.newWindow
+	t.incognito = t.incognito || (o.incognito && !t.guest)
+	return t
+}
+
+// askTargets returns target in each of the rule's ask_profiles.
+func (r compiledRule) askTargets(target launchTarget) []launchTarget {
+	targets := make([]launchTarget, len(r.askProfiles))
+	for i, dir := range r.askProfiles {
+		targets[i] = target
+		targets[i].profile = dir
 	}
-	return "" // StrategyForUnknownUrlsUseBrowserDefault
+	return targets
+}
+
+// profileTarget returns the target of profile dir of chrome_app_path with
+// the config-wide launch options, Chrome's own choice for "".
+func (config Config) profileTarget(dir string) launchTarget {
+	return launchTarget{profile: dir, newWindow: config.NewWindow, background: config.Background, launchMode: targetLaunchMode("", config.LaunchMode), reuseTab: targetTabReuse("", config.ReuseTabs)}
 }
 
-// macOS-friendly launcher for Chrome with profile.
-// Uses: open -na "Google Chrome" --args --profile-directory="X" "URL"
-func openInChrome(chromeAppPath, profileDir, urlStr string) error {
+// macOS-friendly launcher for Chrome with the profile of t.
+// Launches a new instance through NSWorkspace, like
+// open -na "Google Chrome" --args --profile-directory="X" "URL", or by
+// bundle ID when bundleID is given, which finds Chrome wherever it is
+// installed. With launch_mode exec, Chrome's binary is run instead. With
+// t.appMode, the URL opens in a window without tabs or toolbar; with
+// t.background, Chrome isn't brought to the front.
+func openInChrome(ctx context.Context, chromeAppPath, bundleID, urlStr string, t launchTarget, flags []string) error {
 	// Sanity: ensure it's a URL we can hand off (http/https/file/custom schemes may arrive).
 	// We'll pass anything we got; but prefer http/https/mailto like a normal browser.
 	// macOS will pass the exact URL given to the default browser.
@@ -158,98 +1089,222 @@ func openInChrome(chromeAppPath, profileDir, urlStr string) error {
 		}
 	}
 
-	args := []string{
-		"-na", chromeAppPath,
-		"--args",
+	args := append([]string(nil), flags...)
+	if t.profile != "" {
+		args = append(args, fmt.Sprintf("--profile-directory=%s", t.profile))
 	}
-	if profileDir != "" {
-		args = append(args, fmt.Sprintf("--profile-directory=%s", profileDir))
+	if t.appMode {
+		args = append(args, "--app="+urlStr)
+	} else {
+		args = append(args, urlStr)
 	}
-	args = append(args, urlStr)
 
-	cmd := exec.Command("open", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return err
+	var pid int
+	if t.launchMode == LaunchModeExec {
+		pid, err = execApp(chromeAppPath, bundleID, args)
+	} else {
+		pid, err = launchApp(ctx, chromeAppPath, bundleID, args, true, !t.background)
 	}
-
-	osascriptCmd := exec.Command("osascript", "-e", focusChromeWindowScript)
-	osascriptCmd.Stdout = os.Stdout
-	osascriptCmd.Stderr = os.Stderr
-	if err := osascriptCmd.Run(); err != nil {
-		return err
+	if err != nil {
+		return fmt.Errorf("launch %s: %w", appName(chromeAppPath), err)
+	}
+	if logger != nil {
+		logger.Debugf("Launched %s as pid %d", appName(chromeAppPath), pid)
+	}
+	if t.background {
+		return nil
 	}
 
-	return nil
+	return focusChrome(ctx, chromeAppPath)
 }
 
-func processURL(urlStr string, config Config) {
-	profile := chooseProfile(urlStr, config)
-	logger.Debugf("Routing: %s  ->  profile-directory=%q\n", urlStr, profile)
+// focusChrome brings the Chrome at chromeAppPath to the front.
+func focusChrome(ctx context.Context, chromeAppPath string) error {
+	return runLauncher(ctx, exec.CommandContext(ctx, "osascript", "-e", focusChromeWindowScript, appName(chromeAppPath)))
+}
 
-	if err := openInChrome(config.ChromeAppPath, profile, urlStr); err != nil {
-		logger.Errorf("Failed to open URL in Chrome: %v\n", err)
+func processURL(req *routeRequest, config Config) {
+	logger.Debugf("Received %s from %q, frontmost app %q\n", req.raw, req.sourceApp, req.frontmostApp)
+	// Confirm before anything else, even while paused, and show the link
+	// unwrapped but without contacting short link services for it.
+	if config.needsConfirmation(req) && !confirmOpen(unwrapURL(req.raw, config.unwrappers), req.sourceApp) {
+		logger.Infof("Not opening %s from %q, which wasn't confirmed\n", req.raw, req.sourceApp)
+		return
+	}
+	if config.paused {
+		logger.Debugf("Routing paused, opening %s in Chrome's last used profile\n", req.raw)
+		openURLWithRetries(config, launchTarget{}, req.raw)
+		recordRouting(config, req.raw, launchTarget{})
+		return
+	}
+	config.transformURL(req)
+	urlStr := req.raw
+	if t, ok := config.overrideTarget(); ok {
+		targetURL := config.urlForProfile(urlStr, t.profile)
+		logger.Debugf("Override until %s, opening %s in %s\n", config.override.Until.Format("15:04"), targetURL, t)
+		openURLWithRetries(config, t, targetURL)
+		recordRouting(config, targetURL, t)
+		if config.Notify {
+			notifyRouting(config, urlStr, t, "Override until "+config.override.Until.Format("15:04"))
+		}
+		return
+	}
+	routed, rules, ask := routeTargets(req, config)
+	urlStr = req.raw // rules with continue may have rewritten it
+	targets := routed
+	prompt := (ask || config.MultiMatchPolicy == MultiMatchPolicyPrompt) && len(targets) > 1
+	if req.modifiers&config.pickerModifiers != 0 {
+		logger.Debugf("Modifier key held, showing the profile picker for %s\n", urlStr)
+		targets = pickerTargets(targets, config)
+		prompt = true
+	}
+	if prompt {
+		choice, ok := promptForTarget(urlStr, targets, config, "Open in Last Used Profile")
+		if !ok {
+			logger.Debugf("Prompt cancelled, opening %s in Chrome's last used profile\n", urlStr)
+			choice = launchTarget{}
+		}
+		targets = []launchTarget{choice}
+	}
+
+	for _, target := range targets {
+		targetURL := config.urlForProfile(urlStr, target.profile)
+		logger.Debugf("Routing: %s  ->  %s\n", targetURL, target)
+
+		openURLWithRetries(config, target, targetURL)
+		recordRouting(config, targetURL, target)
+		// Links the user just picked a profile for need no notification.
+		if i := slices.Index(routed, target); i >= 0 && !prompt {
+			if why, ok := config.routingReason(rules[i]); ok {
+				notifyRouting(config, urlStr, target, why)
+			}
+		}
 	}
 }
 
-func isRunning(pidFilePath string) bool {
+// runningPid returns the pid recorded in pidFilePath if that process is alive.
+func runningPid(pidFilePath string) (int, bool) {
 	if data, err := os.ReadFile(pidFilePath); err == nil {
 		if pid, err := strconv.Atoi(string(data)); err == nil {
 			if err := syscall.Kill(pid, 0); err == nil {
-				return true
+				return pid, true
 			}
 		}
 	}
 
-	return false
+	return 0, false
+}
+
+func isRunning(pidFilePath string) bool {
+	_, ok := runningPid(pidFilePath)
+	return ok
+}
+
+// notifyRunningInstance asks a running router to reload its config.
+func notifyRunningInstance(pidFilePath string) {
+	if pid, ok := runningPid(pidFilePath); ok {
+		syscall.Kill(pid, syscall.SIGHUP)
+	}
 }
 
 func main() {
+	root := newRootCommand()
+	root.SetArgs(cliArgs(os.Args[1:]))
+	if err := root.Execute(); err != nil {
+		var code exitCode
+		if errors.As(err, &code) {
+			os.Exit(int(code))
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+// runServe runs the router as an app, handling the URLs macOS sends it
+// until it quits, and returns the process exit code when it can't start.
+func runServe(configPath string) int {
 	// load config
-	config, err := loadConfig(defaultConfigPath())
+	config, err := loadConfig(configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		os.Exit(2)
-		return
+		return 2
 	}
 
 	// initialize logger
-	logFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err := os.MkdirAll(filepath.Dir(config.LogFile), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create log directory: %v\n", err)
+		return 2
+	}
+	logFile, err := os.OpenFile(config.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to open log file: %v\n", err)
-		os.Exit(2)
-		return
+		return 2
 	}
 	logger = logrus.New()
 	logger.SetOutput(logFile)
 	logger.SetLevel(config.parsedLogLevel)
 	defer logFile.Close()
 
+	for _, s := range staleRules(config) {
+		logger.Warnf("Stale rule, consider removing it: %s", s)
+	}
+	for _, w := range config.warnings {
+		logger.Warn(w)
+	}
+
+	// rewrite configs that use an older schema version
+	if err := upgradeConfigFiles(configPath); err != nil {
+		logger.Errorf("failed to migrate config: %v", err)
+	}
+
 	// exit if another instance is running
-	if isRunning(pidFilePath) {
+	if isRunning(config.PidFile) {
 		logger.Error("Another instance is running, exiting")
-		os.Exit(0)
-		return
+		return 0
+	}
+	if err := os.MkdirAll(filepath.Dir(config.PidFile), 0755); err != nil {
+		logger.Errorf("failed to create pid directory: %v", err)
+		return 2
 	}
-	if err := os.WriteFile(pidFilePath, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+	if err := os.WriteFile(config.PidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
 		logger.Errorf("failed to write pid file: %v", err)
-		os.Exit(2)
-		return
+		return 2
+	}
+	defer os.Remove(config.PidFile)
+
+	// reload config on change
+	currentConfig.Store(&config)
+	if err := watchConfig(configPath); err != nil {
+		logger.Errorf("failed to watch config, hot reload disabled: %v", err)
+	}
+	reloadOnSignal(configPath)
+	if config.ConfigURL != "" {
+		go refreshRemoteConfig(configPath, config)
 	}
-	defer os.Remove(pidFilePath)
+	go refreshPatternLists(configPath)
+	go cleanupEphemeralProfilesPeriodically()
 
+	requestConditionAccess(config)
+	updateMenuBar(config)
+	registerHotKeys(config)
+	setUpNotifications()
+	scheduleOverrideEnd(config)
 	logger.Info("Start listening for URLs")
 	go func() {
-		for url := range urlListener {
-			processURL(url, config)
+		for req := range urlListener {
+			processURL(req, *currentConfig.Load())
 		}
 	}()
 
 	C.Run()
+	return 0
 }
 
 //export HandleURL
-func HandleURL(u *C.char) {
-	urlListener <- C.GoString(u)
+func HandleURL(u *C.char, sourceApp *C.char, frontmostApp *C.char, modifiers C.ulong) {
+	req := newRouteRequest(C.GoString(u))
+	req.sourceApp = C.GoString(sourceApp)
+	req.frontmostApp = C.GoString(frontmostApp)
+	req.modifiers = uint(modifiers)
+	urlListener <- req
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestRouteTargetsContinue(t *testing.T) {
+	rewrites, err := compileRewrites([]Rewrite{{Pattern: "^http://", Replace: "https://"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{compiledRules: []compiledRule{
+		{
+			index:    0,
+			matcher:  regexMatcher{re: regexp.MustCompile(".")},
+			cont:     true,
+			rewrites: rewrites,
+			carried:  carriedOptions{newWindow: true, background: true},
+		},
+		{
+			index:            1,
+			matcher:          regexMatcher{re: regexp.MustCompile(`^https://example\.com/`)},
+			profileDirectory: "Profile 1",
+		},
+		{
+			index:    2,
+			matcher:  regexMatcher{re: regexp.MustCompile(`^https://app\.example\.org/`)},
+			bundleID: "com.example.app",
+		},
+	}}
+
+	for _, tt := range []struct {
+		raw     string
+		wantURL string
+		want    launchTarget
+		rule    int
+	}{
+		// The later rule only matches the rewritten URL, and gets the
+		// continuing rule's options.
+		{"http://example.com/a", "https://example.com/a", launchTarget{profile: "Profile 1", newWindow: true, background: true}, 1},
+		// Apps have no windows to open.
+		{"http://app.example.org/b", "https://app.example.org/b", launchTarget{bundleID: "com.example.app", background: true}, 2},
+		// Without a target of its own, the continuing rule leaves
+		// unmatched URLs to strategy_for_unknown_urls.
+		{"http://other.example.net/", "https://other.example.net/", launchTarget{}, -1},
+	} {
+		req := newRouteRequest(tt.raw)
+		targets, rules, _ := routeTargets(req, config)
+		if req.raw != tt.wantURL {
+			t.Errorf("%s: routed as %s, want %s", tt.raw, req.raw, tt.wantURL)
+		}
+		if want := []launchTarget{tt.want}; !reflect.DeepEqual(targets, want) {
+			t.Errorf("%s: targets = %+v, want %+v", tt.raw, targets, want)
+		}
+		if want := []int{tt.rule}; !reflect.DeepEqual(rules, want) {
+			t.Errorf("%s: rules = %v, want %v", tt.raw, rules, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	bundleIdentifier     = "com.davidzwliu.chromeprofilerouter"
+	managedPreferenceDir = "/Library/Managed Preferences"
+)
+
+// managedConfigCandidates lists where an MDM (e.g. a Jamf configuration
+// profile) installs managed preferences for the app, computer-level first,
+// then user-level.
+func managedConfigCandidates() []string {
+	candidates := []string{filepath.Join(managedPreferenceDir, bundleIdentifier+".plist")}
+	if u, err := user.Current(); err == nil {
+		candidates = append(candidates, filepath.Join(managedPreferenceDir, u.Username, bundleIdentifier+".plist"))
+	}
+	return candidates
+}
+
+// managedConfigPaths returns the managed preference files that exist.
+func managedConfigPaths() []string {
+	var paths []string
+	for _, p := range managedConfigCandidates() {
+		if _, err := os.Stat(p); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// plistToJSON converts an XML or binary property list into JSON using plutil.
+func plistToJSON(data []byte) ([]byte, error) {
+	cmd := exec.Command("plutil", "-convert", "json", "-o", "-", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("parse config plist: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("parse config plist: %w", err)
+	}
+	return out, nil
+}
+
+// applyManagedConfig overlays the managed preferences on top of the user
+// config. Managed rules are evaluated before the user's own rules and every
+// other managed key overrides the user's value.
+func applyManagedConfig(data []byte, managed []string) ([]byte, error) {
+	doc, err := decodeConfigDoc(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse config JSON: %w", err)
+	}
+
+	for _, p := range managed {
+		managedData, err := readConfigFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("managed preferences %s: %w", p, err)
+		}
+		managedDoc, err := decodeConfigDoc(managedData)
+		if err != nil {
+			return nil, fmt.Errorf("managed preferences %s: parse config JSON: %w", p, err)
+		}
+		for k := range managedDoc {
+			// Configuration profiles may carry payload metadata alongside the settings.
+			if strings.HasPrefix(k, "Payload") {
+				delete(managedDoc, k)
+			}
+		}
+		mergeConfigDoc(doc, managedDoc, true)
+	}
+
+	return json.Marshal(doc)
+}
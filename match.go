@@ -0,0 +1,776 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+type MatchType string
+
+const (
+	MatchTypeRegex MatchType = "regex"
+	MatchTypeHost  MatchType = "host"
+	MatchTypeGlob  MatchType = "glob"
+	MatchTypeSite  MatchType = "site"
+	MatchTypeURL   MatchType = "url"
+	MatchTypeCIDR  MatchType = "cidr"
+)
+
+// routeRequest is a URL waiting to be routed, parsed once up front so
+// matchers don't each have to.
+type routeRequest struct {
+	raw          string
+	url          *url.URL
+	host         string // see canonicalHost, without port
+	sourceApp    string // bundle identifier of the app that sent the URL, if known
+	frontmostApp string // bundle identifier of the app active when the URL arrived
+	modifiers    uint   // modifier keys held when the URL arrived, see modifierFlags
+	time         time.Time
+	ssid         *string // Wi-Fi network name, see wifiSSID
+	focus        *focusMode
+	focusLoaded  bool
+	calendars    []string // busy calendars, see eventCalendars
+	addrs        []netip.Addr
+	addrsLoaded  bool
+}
+
+func newRouteRequest(raw string) *routeRequest {
+	req := &routeRequest{time: time.Now()}
+	req.setURL(raw)
+	return req
+}
+
+// setURL replaces the URL of req, keeping the context it arrived in.
+func (req *routeRequest) setURL(raw string) {
+	req.raw, req.url, req.host = raw, nil, ""
+	req.addrs, req.addrsLoaded = nil, false
+	u, err := url.Parse(raw)
+	if err == nil && u.Scheme == "" && u.Host == "" && !strings.HasPrefix(raw, "/") {
+		// Bare "example.com/path" is opened as https, so match it that way.
+		u, err = url.Parse("https://" + raw)
+	}
+	if err == nil {
+		req.url = u
+		req.host = canonicalHost(u.Hostname())
+	}
+}
+
+// urlMatcher decides whether a rule applies to a URL.
+type urlMatcher interface {
+	match(req *routeRequest) bool
+}
+
+type regexMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m regexMatcher) match(req *routeRequest) bool {
+	return m.re.MatchString(req.raw)
+}
+
+// hostMatcher matches a set of hosts and all of their subdomains.
+type hostMatcher struct {
+	hosts map[string]bool
+}
+
+func (m hostMatcher) match(req *routeRequest) bool {
+	for h := req.host; h != ""; {
+		if m.hosts[h] {
+			return true
+		}
+		i := strings.IndexByte(h, '.')
+		if i < 0 {
+			break
+		}
+		h = h[i+1:]
+	}
+	return false
+}
+
+// siteMatcher matches every host whose registrable domain (eTLD+1 according
+// to the Public Suffix List) is one of sites.
+type siteMatcher struct {
+	sites map[string]bool
+}
+
+func (m siteMatcher) match(req *routeRequest) bool {
+	if req.host == "" {
+		return false
+	}
+	site, err := publicsuffix.EffectiveTLDPlusOne(req.host)
+	return err == nil && m.sites[site]
+}
+
+// cidrMatcher matches URLs whose host is an IP address in one of prefixes.
+type cidrMatcher struct {
+	prefixes []netip.Prefix
+}
+
+func (m cidrMatcher) match(req *routeRequest) bool {
+	addr, err := netip.ParseAddr(req.host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range m.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// captureRefRe finds $1, ${1}, $name, and ${name} references in a profile
+// directory, as understood by regexp.Expand.
+var captureRefRe = regexp.MustCompile(`\$(?:([A-Za-z0-9_]+)|\{([A-Za-z0-9_]+)\})`)
+
+func hasCaptureRefs(s string) bool {
+	return captureRefRe.MatchString(s)
+}
+
+// captureGroupNames returns the names of the capture groups in pattern.
+func captureGroupNames(pattern string) []string {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// compileCaptures compiles the pattern whose capture groups the profiles of
+// r reference, checking that every referenced group exists.
+func compileCaptures(r Rule, fold bool) (*regexp.Regexp, error) {
+	if (r.MatchType != "" && r.MatchType != MatchTypeRegex) || r.Pattern == "" {
+		return nil, fmt.Errorf("profile directories can only reference capture groups of a regex pattern")
+	}
+	re, err := regexp.Compile(caseFlag(fold) + r.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compile regexp: %w", err)
+	}
+	for _, dir := range []string{r.ProfileDirectory, r.FallbackProfileDirectory} {
+		for _, m := range captureRefRe.FindAllStringSubmatch(dir, -1) {
+			ref := m[1] + m[2]
+			if n, err := strconv.Atoi(ref); err == nil && n <= re.NumSubexp() || re.SubexpIndex(ref) >= 0 {
+				continue
+			}
+			return nil, fmt.Errorf("profile directory %q references capture group %q, which pattern doesn't have", dir, ref)
+		}
+	}
+	return re, nil
+}
+
+// expandCaptures replaces capture group references in template with what
+// re captured in rawURL. Entries of patterns_file aren't part of re, so URLs
+// they matched leave the references empty.
+func expandCaptures(re *regexp.Regexp, rawURL, template string) string {
+	match := re.FindStringSubmatchIndex(rawURL)
+	if match == nil {
+		return captureRefRe.ReplaceAllString(template, "")
+	}
+	return string(re.ExpandString(nil, template, rawURL, match))
+}
+
+// parseCIDR parses a CIDR range, or a single address as a range holding
+// only that address.
+func parseCIDR(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("cidr %q: not a CIDR range or IP address", s)
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// anyMatcher matches when one of its matchers does.
+type anyMatcher []urlMatcher
+
+func (m anyMatcher) match(req *routeRequest) bool {
+	for _, sub := range m {
+		if sub.match(req) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlComponent names a part of a parsed URL a "url" rule can match.
+type urlComponent struct {
+	name  string
+	value func(r Rule) string
+	get   func(req *routeRequest) string
+}
+
+var defaultPorts = map[string]string{"http": "80", "https": "443", "ftp": "21", "ws": "80", "wss": "443"}
+
+var urlComponents = []urlComponent{
+	{"scheme", func(r Rule) string { return r.Scheme }, func(req *routeRequest) string { return strings.ToLower(req.url.Scheme) }},
+	{"host", func(r Rule) string { return r.Host }, func(req *routeRequest) string { return req.host }},
+	{"port", func(r Rule) string { return r.Port }, func(req *routeRequest) string {
+		if p := req.url.Port(); p != "" {
+			return p
+		}
+		return defaultPorts[strings.ToLower(req.url.Scheme)]
+	}},
+	{"path", func(r Rule) string { return r.Path }, func(req *routeRequest) string {
+		if req.url.Path == "" {
+			return "/"
+		}
+		return req.url.Path
+	}},
+	{"query", func(r Rule) string { return r.Query }, func(req *routeRequest) string { return req.url.RawQuery }},
+}
+
+// componentMatcher matches components of the parsed URL separately; every
+// component the rule sets must match.
+type componentMatcher struct {
+	conds []componentCond
+}
+
+type componentCond struct {
+	get func(req *routeRequest) string
+	re  *regexp.Regexp
+}
+
+func (m componentMatcher) match(req *routeRequest) bool {
+	if req.url == nil {
+		return false
+	}
+	for _, c := range m.conds {
+		if !c.re.MatchString(c.get(req)) {
+			return false
+		}
+	}
+	return true
+}
+
+func compileComponentMatcher(r Rule, fold bool) (urlMatcher, error) {
+	var m componentMatcher
+	for _, c := range urlComponents {
+		expr := c.value(r)
+		if expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(caseFlag(fold) + expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: compile regexp: %w", c.name, err)
+		}
+		m.conds = append(m.conds, componentCond{get: c.get, re: re})
+	}
+	if len(m.conds) == 0 {
+		return nil, fmt.Errorf("match_type %q needs at least one of scheme, host, port, path, or query", r.MatchType)
+	}
+	return m, nil
+}
+
+// globMatcher matches a shell-style glob where `*` matches any run of
+// characters and `?` a single one. What the glob is compared against depends
+// on its shape: globs containing "://" see the whole URL, globs containing "/"
+// see host, path, and query, and anything else sees only the host.
+type globMatcher struct {
+	re   *regexp.Regexp
+	part globPart
+}
+
+type globPart int
+
+const (
+	globHost globPart = iota
+	globHostPath
+	globURL
+)
+
+func (m globMatcher) match(req *routeRequest) bool {
+	switch m.part {
+	case globURL:
+		return m.re.MatchString(req.raw)
+	case globHostPath:
+		if req.url == nil {
+			return false
+		}
+		return m.re.MatchString(req.host + requestPath(req.url))
+	default:
+		return req.host != "" && m.re.MatchString(req.host)
+	}
+}
+
+// requestPath returns the path and query of u, with an empty path reported
+// as "/" so "example.com/*" matches "https://example.com".
+func requestPath(u *url.URL) string {
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	return p
+}
+
+// splitGlob classifies a glob and lowercases its host portion.
+func splitGlob(glob string) (string, globPart) {
+	if strings.Contains(glob, "://") {
+		return glob, globURL
+	}
+	if i := strings.Index(glob, "/"); i >= 0 {
+		return strings.ToLower(glob[:i]) + glob[i:], globHostPath
+	}
+	return strings.ToLower(glob), globHost
+}
+
+// globToRegex translates glob wildcards, using star as the expansion of `*`.
+func globToRegex(glob, star string) string {
+	var b strings.Builder
+	for _, c := range glob {
+		switch c {
+		case '*':
+			b.WriteString(star)
+		case '?':
+			b.WriteByte('.')
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// globPattern returns a regex matching the same URLs as glob.
+func globPattern(glob string) string {
+	glob, part := splitGlob(glob)
+	const prefix = `^[a-z][a-z0-9+.-]*://([^/?#@]*@)?`
+	switch part {
+	case globURL:
+		return "^" + globToRegex(glob, ".*") + "$"
+	case globHostPath:
+		i := strings.Index(glob, "/")
+		return prefix + globToRegex(glob[:i], `[^/?#]*`) + `(:[0-9]+)?` + globToRegex(glob[i:], ".*") + `(#.*)?$`
+	default:
+		return prefix + globToRegex(glob, `[^/?#]*`) + `(:[0-9]+)?([/?#]|$)`
+	}
+}
+
+// normalizeRuleHost lowercases a host rule value and drops a leading "*." or
+// "." since subdomains always match anyway.
+func normalizeRuleHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	host = strings.TrimPrefix(host, "*")
+	host = strings.TrimPrefix(host, ".")
+	return canonicalHost(host)
+}
+
+// excludingMatcher wraps a matcher and rejects URLs matching any of the
+// rule's exclude_patterns.
+type excludingMatcher struct {
+	urlMatcher
+	excludes []*regexp.Regexp
+}
+
+func (m excludingMatcher) match(req *routeRequest) bool {
+	if !m.urlMatcher.match(req) {
+		return false
+	}
+	for _, re := range m.excludes {
+		if re.MatchString(req.raw) {
+			return false
+		}
+	}
+	return true
+}
+
+// compileRule builds the matcher for rule i including its exclusions and
+// expiry.
+func compileRule(i int, r Rule, fold bool) (urlMatcher, error) {
+	conditions, err := compileConditions(r, fold)
+	if err != nil {
+		return nil, err
+	}
+	var m urlMatcher = everyURL{}
+	if (len(conditions) == 0 && !r.resolvesProfile()) || !r.urlCriteriaOmitted() {
+		if m, err = compileMatcher(r, fold); err != nil {
+			return nil, err
+		}
+	}
+	if len(conditions) > 0 {
+		m = conditionalMatcher{urlMatcher: m, conditions: conditions}
+	}
+	if len(r.ExcludePatterns) > 0 {
+		em := excludingMatcher{urlMatcher: m}
+		for j, p := range r.ExcludePatterns {
+			re, err := regexp.Compile(caseFlag(fold) + p)
+			if err != nil {
+				return nil, fmt.Errorf("exclude pattern %d: compile regexp: %w", j, err)
+			}
+			em.excludes = append(em.excludes, re)
+		}
+		m = em
+	}
+	if r.ExpiresAt != "" {
+		t, err := parseExpiry(r.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		m = expiringMatcher{urlMatcher: m, index: i, expiresAt: t}
+	}
+	return m, nil
+}
+
+// ruleOrder returns the indices of rules in evaluation order: higher priority
+// first, then, with the most-specific strategy, more specific rules first.
+// Ties keep file order, so taking the first match in this order picks the
+// most specific matching rule.
+func ruleOrder(rules []Rule, strategy MatchStrategy) []int {
+	order := make([]int, len(rules))
+	spec := make([]int, len(rules))
+	for i, r := range rules {
+		order[i] = i
+		if strategy == MatchStrategyMostSpecific {
+			spec[i] = ruleSpecificity(r)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ra, rb := rules[order[a]], rules[order[b]]
+		if ra.Priority != rb.Priority {
+			return ra.Priority > rb.Priority
+		}
+		return spec[order[a]] > spec[order[b]]
+	})
+	return order
+}
+
+// ruleSpecificity scores how specific a rule is for the most-specific match
+// strategy: the number of literal characters a URL must contain to match.
+// Host-based rules count the host, so "docs.example.com" beats "example.com".
+func ruleSpecificity(r Rule) int {
+	switch r.MatchType {
+	case MatchTypeHost:
+		return len(normalizeRuleHost(r.Host))
+	case MatchTypeSite:
+		return len(normalizeRuleHost(r.Site))
+	case MatchTypeCIDR:
+		// Longer prefixes are more specific.
+		if p, err := parseCIDR(r.CIDR); err == nil {
+			return p.Bits()
+		}
+		return 0
+	case MatchTypeGlob:
+		return len(r.Pattern) - strings.Count(r.Pattern, "*") - strings.Count(r.Pattern, "?")
+	case MatchTypeURL:
+		n := 0
+		for _, c := range urlComponents {
+			n += regexLiteralLength(c.value(r))
+		}
+		return n
+	default:
+		return regexLiteralLength(r.Pattern)
+	}
+}
+
+// regexLiteralLength counts the literal characters every match of expr
+// contains.
+func regexLiteralLength(expr string) int {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return 0
+	}
+	var walk func(re *syntax.Regexp) int
+	walk = func(re *syntax.Regexp) int {
+		switch re.Op {
+		case syntax.OpLiteral:
+			return len(re.Rune)
+		case syntax.OpCapture, syntax.OpPlus:
+			return walk(re.Sub[0])
+		case syntax.OpRepeat:
+			return re.Min * walk(re.Sub[0])
+		case syntax.OpConcat:
+			n := 0
+			for _, sub := range re.Sub {
+				n += walk(sub)
+			}
+			return n
+		case syntax.OpAlternate:
+			n := -1
+			for _, sub := range re.Sub {
+				if l := walk(sub); n < 0 || l < n {
+					n = l
+				}
+			}
+			return max(n, 0)
+		default:
+			return 0
+		}
+	}
+	return walk(re)
+}
+
+// expiringMatcher stops matching once the rule's expires_at has passed,
+// logging when an expired rule would otherwise have matched.
+type expiringMatcher struct {
+	urlMatcher
+	index     int
+	expiresAt time.Time
+}
+
+func (m expiringMatcher) match(req *routeRequest) bool {
+	if time.Now().Before(m.expiresAt) {
+		return m.urlMatcher.match(req)
+	}
+	if logger != nil && m.urlMatcher.match(req) {
+		logger.Warnf("Rule %d expired on %s and was skipped for %s", m.index, m.expiresAt.Format(time.RFC3339), req.raw)
+	}
+	return false
+}
+
+// parseExpiry parses an expires_at value. A plain date means the rule is
+// valid through the end of that day in local time.
+func parseExpiry(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expires_at %q is neither a date (YYYY-MM-DD) nor an RFC 3339 timestamp", s)
+	}
+	return t.AddDate(0, 0, 1), nil
+}
+
+// staleRules describes the enabled rules of cfg whose expires_at has passed,
+// so they can be cleaned up.
+func staleRules(cfg Config) []string {
+	var stale []string
+	now := time.Now()
+	for i, r := range cfg.Rules {
+		if !cfg.ruleEnabled(r) || r.ExpiresAt == "" {
+			continue
+		}
+		if t, err := parseExpiry(r.ExpiresAt); err == nil && !now.Before(t) {
+			stale = append(stale, fmt.Sprintf("rule %d expired on %s", i, r.ExpiresAt))
+		}
+	}
+	return stale
+}
+
+// enabled reports whether the rule takes part in routing. Rules are enabled
+// unless they say "enabled": false.
+func (r Rule) enabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// foldCase reports whether the rule matches case-insensitively, falling back
+// to the config-wide default when the rule doesn't say.
+func (r Rule) foldCase(def bool) bool {
+	if r.CaseInsensitive != nil {
+		return *r.CaseInsensitive
+	}
+	return def
+}
+
+// caseFlag returns the regex flag group that makes a pattern
+// case-insensitive when fold is set.
+func caseFlag(fold bool) string {
+	if fold {
+		return "(?i)"
+	}
+	return ""
+}
+
+// matchValues returns the values a rule matches against: the inline pattern,
+// host, or site for its match_type followed by the entries of its
+// patterns_file.
+func (r Rule) matchValues() []string {
+	var v string
+	switch r.MatchType {
+	case MatchTypeHost:
+		v = r.Host
+	case MatchTypeSite:
+		v = r.Site
+	case MatchTypeCIDR:
+		v = r.CIDR
+	case MatchTypeURL:
+	default:
+		v = r.Pattern
+	}
+	var values []string
+	if v != "" {
+		values = append(values, v)
+	}
+	return append(values, r.listEntries...)
+}
+
+// validListEntries returns the entries of the rule's pattern list that
+// compile for its match_type, and a message for each one that doesn't, so a
+// bad line in a list doesn't stop the config from loading.
+func validListEntries(r Rule) ([]string, []string) {
+	if r.MatchType == MatchTypeURL {
+		return r.listEntries, nil
+	}
+	var valid, skipped []string
+	for _, e := range r.listEntries {
+		entry := Rule{MatchType: r.MatchType, listEntries: []string{e}}
+		if _, err := compileMatcher(entry, false); err != nil {
+			skipped = append(skipped, fmt.Sprintf("%q: %v", e, err))
+			continue
+		}
+		valid = append(valid, e)
+	}
+	return valid, skipped
+}
+
+// compileMatcher builds the matcher for a rule according to its match_type.
+// Hosts are always compared in lowercase; fold additionally makes patterns
+// case-insensitive.
+func compileMatcher(r Rule, fold bool) (urlMatcher, error) {
+	hasList := r.PatternsFile != "" || r.PatternsURL != ""
+	if r.MatchType == MatchTypeURL {
+		if hasList {
+			return nil, fmt.Errorf("patterns_file and patterns_url can't be used with match_type %q", r.MatchType)
+		}
+		return compileComponentMatcher(r, fold)
+	}
+
+	values := r.matchValues()
+	if len(values) == 0 && hasList {
+		// An empty or not yet downloaded list matches nothing rather than
+		// failing the load.
+		return anyMatcher(nil), nil
+	}
+	if len(values) == 0 {
+		switch r.MatchType {
+		case MatchTypeHost:
+			return nil, fmt.Errorf("host or patterns_file is required for match_type %q", r.MatchType)
+		case MatchTypeSite:
+			return nil, fmt.Errorf("site or patterns_file is required for match_type %q", r.MatchType)
+		case MatchTypeCIDR:
+			return nil, fmt.Errorf("cidr or patterns_file is required for match_type %q", r.MatchType)
+		case "", MatchTypeRegex, MatchTypeGlob:
+			return nil, fmt.Errorf("pattern is required")
+		}
+	}
+
+	switch r.MatchType {
+	case "", MatchTypeRegex:
+		for _, v := range values {
+			if _, err := regexp.Compile(v); err != nil {
+				return nil, fmt.Errorf("compile regexp: %w", err)
+			}
+		}
+		// One alternation is much faster than trying hundreds of regexes.
+		expr := values[0]
+		if len(values) > 1 {
+			expr = "(?:" + strings.Join(values, ")|(?:") + ")"
+		}
+		re, err := regexp.Compile(caseFlag(fold) + expr)
+		if err != nil {
+			return nil, fmt.Errorf("compile regexp: %w", err)
+		}
+		return regexMatcher{re: re}, nil
+	case MatchTypeHost:
+		m := hostMatcher{hosts: map[string]bool{}}
+		for _, v := range values {
+			if host := normalizeRuleHost(v); host != "" {
+				m.hosts[host] = true
+			}
+		}
+		return m, nil
+	case MatchTypeSite:
+		m := siteMatcher{sites: map[string]bool{}}
+		for _, v := range values {
+			site := normalizeRuleHost(v)
+			registrable, err := publicsuffix.EffectiveTLDPlusOne(site)
+			if err != nil {
+				return nil, fmt.Errorf("site %q: %w", v, err)
+			}
+			if registrable != site {
+				return nil, fmt.Errorf("site %q is not a registrable domain, did you mean %q?", v, registrable)
+			}
+			m.sites[site] = true
+		}
+		return m, nil
+	case MatchTypeCIDR:
+		var m cidrMatcher
+		for _, v := range values {
+			p, err := parseCIDR(v)
+			if err != nil {
+				return nil, err
+			}
+			m.prefixes = append(m.prefixes, p)
+		}
+		return m, nil
+	case MatchTypeGlob:
+		var m anyMatcher
+		for _, v := range values {
+			g, err := compileGlob(v, fold)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, g)
+		}
+		if len(m) == 1 {
+			return m[0], nil
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown match_type %q", r.MatchType)
+	}
+}
+
+func compileGlob(pattern string, fold bool) (globMatcher, error) {
+	glob, part := splitGlob(pattern)
+	expr := globToRegex(glob, ".*")
+	if i := strings.Index(glob, "/"); part == globHostPath {
+		// Wildcards in the host must not reach into the path.
+		expr = globToRegex(glob[:i], "[^/]*") + globToRegex(glob[i:], ".*")
+	}
+	re, err := regexp.Compile(caseFlag(fold) + "^" + expr + "$")
+	if err != nil {
+		return globMatcher{}, fmt.Errorf("compile glob: %w", err)
+	}
+	return globMatcher{re: re, part: part}, nil
+}
+
+// regexPattern returns a regex equivalent to the rule's matcher, for
+// exporting to tools that only understand regexes.
+func (r Rule) regexPattern(fold bool) (string, error) {
+	var patterns []string
+	for _, v := range r.matchValues() {
+		switch r.MatchType {
+		case "", MatchTypeRegex:
+			patterns = append(patterns, v)
+		case MatchTypeHost:
+			fold = true
+			patterns = append(patterns, hostPattern(normalizeRuleHost(v)))
+		case MatchTypeGlob:
+			patterns = append(patterns, globPattern(v))
+		case MatchTypeSite:
+			// Exact for the site itself; it can't express hosts that are
+			// public suffixes in their own right, such as user.github.io.
+			fold = true
+			patterns = append(patterns, hostPattern(normalizeRuleHost(v)))
+		default:
+			return "", fmt.Errorf("match_type %q has no regex equivalent", r.MatchType)
+		}
+	}
+	if len(patterns) == 0 {
+		return "", fmt.Errorf("match_type %q has no regex equivalent", r.MatchType)
+	}
+	if len(patterns) == 1 {
+		return caseFlag(fold) + patterns[0], nil
+	}
+	return caseFlag(fold) + "(?:" + strings.Join(patterns, ")|(?:") + ")", nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompileMatcher(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		rule   Rule
+		fold   bool
+		match  []string
+		reject []string
+	}{
+		{
+			name:   "regex",
+			rule:   Rule{Pattern: `^https://github\.com/acme/`},
+			match:  []string{"https://github.com/acme/app"},
+			reject: []string{"https://github.com/other/app", "https://GitHub.com/acme/app"},
+		},
+		{
+			name:  "regex with case folding",
+			rule:  Rule{MatchType: MatchTypeRegex, Pattern: `^https://github\.com/acme/`},
+			fold:  true,
+			match: []string{"https://GitHub.com/Acme/app"},
+		},
+		{
+			name:   "host covers subdomains",
+			rule:   Rule{MatchType: MatchTypeHost, Host: "*.Example.com"},
+			match:  []string{"https://example.com/", "https://docs.EXAMPLE.com:8443/a", "example.com/bare"},
+			reject: []string{"https://notexample.com/", "https://example.com.evil.net/"},
+		},
+		{
+			name:   "site",
+			rule:   Rule{MatchType: MatchTypeSite, Site: "example.co.uk"},
+			match:  []string{"https://www.example.co.uk/"},
+			reject: []string{"https://other.co.uk/"},
+		},
+		{
+			name:   "cidr",
+			rule:   Rule{MatchType: MatchTypeCIDR, CIDR: "10.0.0.0/8"},
+			match:  []string{"http://10.1.2.3:8080/"},
+			reject: []string{"http://192.168.1.1/", "https://intranet.example.com/"},
+		},
+		{
+			name:   "host glob",
+			rule:   Rule{MatchType: MatchTypeGlob, Pattern: "*.atlassian.net"},
+			match:  []string{"https://acme.atlassian.net/browse/X-1"},
+			reject: []string{"https://atlassian.net.evil.com/"},
+		},
+		{
+			name:   "glob wildcards in the host stay out of the path",
+			rule:   Rule{MatchType: MatchTypeGlob, Pattern: "*.example.com/admin/*"},
+			match:  []string{"https://a.example.com/admin/users"},
+			reject: []string{"https://a.example.com/docs/admin/x", "https://evil.net/x.example.com/admin/y"},
+		},
+		{
+			name:   "list entries",
+			rule:   Rule{MatchType: MatchTypeHost, listEntries: []string{"a.example.com", "b.example.com"}},
+			match:  []string{"https://a.example.com/", "https://b.example.com/"},
+			reject: []string{"https://c.example.com/"},
+		},
+	} {
+		m, err := compileMatcher(tt.rule, tt.fold)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for _, raw := range tt.match {
+			if !m.match(newRouteRequest(raw)) {
+				t.Errorf("%s: %s not matched", tt.name, raw)
+			}
+		}
+		for _, raw := range tt.reject {
+			if m.match(newRouteRequest(raw)) {
+				t.Errorf("%s: %s matched", tt.name, raw)
+			}
+		}
+	}
+}
+
+func TestCompileMatcherErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		rule Rule
+	}{
+		{"missing pattern", Rule{MatchType: MatchTypeRegex}},
+		{"missing host", Rule{MatchType: MatchTypeHost}},
+		{"bad regex", Rule{Pattern: "("}},
+		{"site below the registrable domain", Rule{MatchType: MatchTypeSite, Site: "www.example.com"}},
+		{"bad cidr", Rule{MatchType: MatchTypeCIDR, CIDR: "10.0.0.0/33"}},
+		{"unknown match_type", Rule{MatchType: "prefix", Pattern: "https://"}},
+	} {
+		if _, err := compileMatcher(tt.rule, false); err == nil {
+			t.Errorf("%s: compiled", tt.name)
+		}
+	}
+}
+
+func TestValidListEntries(t *testing.T) {
+	r := Rule{MatchType: MatchTypeRegex, listEntries: []string{`^https://a\.`, "(", `^https://b\.`}}
+	valid, skipped := validListEntries(r)
+	if want := []string{`^https://a\.`, `^https://b\.`}; !reflect.DeepEqual(valid, want) {
+		t.Errorf("valid = %q, want %q", valid, want)
+	}
+	if len(skipped) != 1 {
+		t.Errorf("skipped = %q, want the one bad entry", skipped)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework Cocoa
+#include <stdlib.h>
+#include "menubar.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// maxRecentRoutings is how many routings the status item's menu lists.
+const maxRecentRoutings = 10
+
+// menuProfiles are the directories of the profiles the menu last offered to
+// send links to, and the names of the profile sets, in order.
+var menuProfiles struct {
+	mu   sync.Mutex
+	dirs []string
+	sets []string
+}
+
+// updateMenuBar shows or hides the status item as menu_bar says, and
+// brings its menu up to date.
+func updateMenuBar(config Config) {
+	links, _ := readRecentLinks()
+	if len(links) > maxRecentRoutings {
+		links = links[:maxRecentRoutings]
+	}
+	entries := make([]string, len(links))
+	for i, l := range links {
+		entries[i] = l.String()
+	}
+	cEntries := make([]*C.char, len(entries)+1)
+	for i, e := range entries {
+		cEntries[i] = C.CString(e)
+		defer C.free(unsafe.Pointer(cEntries[i]))
+	}
+
+	var dirs []string
+	var cProfiles []*C.char
+	if config.MenuBar {
+		profiles, _ := readChromeProfiles(defaultChromeUserDataDir())
+		for _, p := range profiles {
+			dirs = append(dirs, p.Directory)
+			cProfiles = append(cProfiles, C.CString(p.Label()))
+			defer C.free(unsafe.Pointer(cProfiles[len(cProfiles)-1]))
+		}
+	}
+	cProfiles = append(cProfiles, nil)
+	sets := config.profileSetNames()
+	cSets := make([]*C.char, len(sets)+1)
+	for i, s := range sets {
+		cSets[i] = C.CString(s)
+		defer C.free(unsafe.Pointer(cSets[i]))
+	}
+	menuProfiles.mu.Lock()
+	menuProfiles.dirs = dirs
+	menuProfiles.sets = sets
+	menuProfiles.mu.Unlock()
+	cMinutes := make([]C.int, len(overrideDurations))
+	for i, d := range overrideDurations {
+		cMinutes[i] = C.int(d / time.Minute)
+	}
+
+	override := ""
+	if t, ok := config.overrideTarget(); ok {
+		override = fmt.Sprintf("Every link to %s until %s", targetLabels([]launchTarget{t}, config)[0], config.override.Until.Format("15:04"))
+	}
+	cOverride := C.CString(override)
+	defer C.free(unsafe.Pointer(cOverride))
+	C.UpdateStatusItem(C.bool(config.MenuBar), C.bool(config.paused), cOverride, &cEntries[0], C.int(len(entries)),
+		&cProfiles[0], C.int(len(dirs)), &cSets[0], C.int(len(sets)), &cMinutes[0], C.int(len(cMinutes)))
+}
+
+//export MenuBarCommand
+func MenuBarCommand(command C.int) {
+	config := *currentConfig.Load()
+	// Commands arrive on the main thread, which has to stay free for the
+	// menu itself.
+	go func() {
+		switch command {
+		case C.MenuBarTogglePause:
+			togglePause(config)
+		case C.MenuBarReloadConfig:
+			reloadConfig(config.path)
+		case C.MenuBarOpenLog:
+			if err := exec.Command("open", config.LogFile).Run(); err != nil {
+				logger.Errorf("Failed to open %s: %v", config.LogFile, err)
+			}
+		case C.MenuBarEndOverride:
+			overrideFromMenu(config, "", 0)
+		case C.MenuBarEditRules:
+			openRulesEditor(config)
+		}
+	}()
+}
+
+//export MenuBarReopen
+func MenuBarReopen(profile C.int) {
+	config := *currentConfig.Load()
+	menuProfiles.mu.Lock()
+	defer menuProfiles.mu.Unlock()
+	if int(profile) >= len(menuProfiles.dirs) {
+		return
+	}
+	dir := menuProfiles.dirs[profile]
+	go func() {
+		links, err := readRecentLinks()
+		if err != nil || len(links) == 0 {
+			logger.Warnf("No recent link to reopen: %v", err)
+			return
+		}
+		reopenLink(config, links[0].URL, dir)
+	}()
+}
+
+//export MenuBarOpenAll
+func MenuBarOpenAll(set C.int) {
+	config := *currentConfig.Load()
+	menuProfiles.mu.Lock()
+	defer menuProfiles.mu.Unlock()
+	name := ""
+	if set >= 0 {
+		if int(set) >= len(menuProfiles.sets) {
+			return
+		}
+		name = menuProfiles.sets[set]
+	}
+	go openSetFromMenu(config, name)
+}
+
+//export MenuBarOverride
+func MenuBarOverride(profile, minutes C.int) {
+	config := *currentConfig.Load()
+	menuProfiles.mu.Lock()
+	defer menuProfiles.mu.Unlock()
+	if int(profile) >= len(menuProfiles.dirs) {
+		return
+	}
+	go overrideFromMenu(config, menuProfiles.dirs[profile], time.Duration(minutes)*time.Minute)
+}
@@ -0,0 +1,28 @@
+#include <stdbool.h>
+
+// Commands chosen from the status item's menu, passed to MenuBarCommand.
+enum {
+  MenuBarTogglePause = 1,
+  MenuBarReloadConfig,
+  MenuBarOpenLog,
+  MenuBarEndOverride,
+  MenuBarEditRules,
+};
+
+extern void MenuBarCommand(int command);
+extern void MenuBarOverride(int profile, int minutes);
+extern void MenuBarReopen(int profile);
+extern void MenuBarOpenAll(int set);
+
+// UpdateStatusItem shows the router's status item in the menu bar, or
+// removes it when visible is false. Its menu lists the n recent routings,
+// newest first, and has the menu bar commands, with pausing checked when
+// paused is true. Reopening the last link offers the m profiles and calls
+// MenuBarReopen with the index of the one chosen, or offers them all and
+// the s profile sets, calling MenuBarOpenAll with -1 for every profile or
+// the index of the set. Overriding the rules
+// offers them for each of the k durations in minutes, and calls
+// MenuBarOverride with the index of the profile and the minutes; override
+// describes the override in effect, or is empty for none.
+void UpdateStatusItem(bool visible, bool paused, const char *override, const char **recent, int n,
+                      const char **profiles, int m, const char **sets, int s, const int *minutes, int k);
@@ -0,0 +1,163 @@
+#import <Cocoa/Cocoa.h>
+#include "menubar.h"
+
+@interface MenuBarController : NSObject
+- (void)command:(id)sender;
+- (void)override:(id)sender;
+- (void)reopen:(id)sender;
+- (void)openAll:(id)sender;
+@end
+
+@implementation MenuBarController
+- (void)command:(id)sender {
+  MenuBarCommand((int)[sender tag]);
+}
+
+// The item's represented object holds the profile's index and the minutes.
+- (void)override:(id)sender {
+  NSArray<NSNumber *> *choice = [sender representedObject];
+  MenuBarOverride([choice[0] intValue], [choice[1] intValue]);
+}
+
+// The item's tag is the profile's index.
+- (void)reopen:(id)sender {
+  MenuBarReopen((int)[sender tag]);
+}
+
+// The item's tag is the set's index, -1 for every profile.
+- (void)openAll:(id)sender {
+  MenuBarOpenAll((int)[sender tag]);
+}
+@end
+
+static NSStatusItem *statusItem;
+static MenuBarController *controller;
+
+static NSMenuItem *commandItem(NSString *title, int command) {
+  NSMenuItem *item = [[[NSMenuItem alloc] initWithTitle:title action:@selector(command:) keyEquivalent:@""] autorelease];
+  item.target = controller;
+  item.tag = command;
+  return item;
+}
+
+static NSString *durationTitle(int minutes) {
+  if (minutes % 60 == 0) {
+    return minutes == 60 ? @"For 1 Hour" : [NSString stringWithFormat:@"For %d Hours", minutes / 60];
+  }
+  return [NSString stringWithFormat:@"For %d Minutes", minutes];
+}
+
+// overrideMenu lists the profiles, each with a submenu of how long to send
+// every link there.
+static NSMenu *overrideMenu(NSArray<NSString *> *profiles, NSArray<NSNumber *> *durations) {
+  NSMenu *menu = [[[NSMenu alloc] init] autorelease];
+  [profiles enumerateObjectsUsingBlock:^(NSString *profile, NSUInteger i, BOOL *stop) {
+    NSMenu *submenu = [[[NSMenu alloc] init] autorelease];
+    for (NSNumber *minutes in durations) {
+      NSMenuItem *item = [submenu addItemWithTitle:durationTitle([minutes intValue]) action:@selector(override:) keyEquivalent:@""];
+      item.target = controller;
+      item.representedObject = @[ @(i), minutes ];
+    }
+    [menu addItemWithTitle:profile action:nil keyEquivalent:@""].submenu = submenu;
+  }];
+  return menu;
+}
+
+// reopenMenu lists the profiles to open the last link again in, then all
+// of them and the profile sets to open it in at once.
+static NSMenu *reopenMenu(NSArray<NSString *> *profiles, NSArray<NSString *> *sets) {
+  NSMenu *menu = [[[NSMenu alloc] init] autorelease];
+  [profiles enumerateObjectsUsingBlock:^(NSString *profile, NSUInteger i, BOOL *stop) {
+    NSMenuItem *item = [menu addItemWithTitle:profile action:@selector(reopen:) keyEquivalent:@""];
+    item.target = controller;
+    item.tag = i;
+  }];
+  [menu addItem:[NSMenuItem separatorItem]];
+  NSMenuItem *all = [menu addItemWithTitle:@"All Profiles" action:@selector(openAll:) keyEquivalent:@""];
+  all.target = controller;
+  all.tag = -1;
+  [sets enumerateObjectsUsingBlock:^(NSString *set, NSUInteger i, BOOL *stop) {
+    NSMenuItem *item = [menu addItemWithTitle:[NSString stringWithFormat:@"All of “%@”", set]
+                                       action:@selector(openAll:)
+                                keyEquivalent:@""];
+    item.target = controller;
+    item.tag = i;
+  }];
+  return menu;
+}
+
+void UpdateStatusItem(bool visible, bool paused, const char *override, const char **recent, int n,
+                      const char **profiles, int m, const char **sets, int s, const int *minutes, int k) {
+  @autoreleasepool {
+    NSMutableArray<NSString *> *titles = [NSMutableArray arrayWithCapacity:n];
+    for (int i = 0; i < n; i++) {
+      [titles addObject:[NSString stringWithUTF8String:recent[i]]];
+    }
+    NSMutableArray<NSString *> *profileNames = [NSMutableArray arrayWithCapacity:m];
+    for (int i = 0; i < m; i++) {
+      [profileNames addObject:[NSString stringWithUTF8String:profiles[i]]];
+    }
+    NSMutableArray<NSString *> *setNames = [NSMutableArray arrayWithCapacity:s];
+    for (int i = 0; i < s; i++) {
+      [setNames addObject:[NSString stringWithUTF8String:sets[i]]];
+    }
+    NSMutableArray<NSNumber *> *durations = [NSMutableArray arrayWithCapacity:k];
+    for (int i = 0; i < k; i++) {
+      [durations addObject:@(minutes[i])];
+    }
+    NSString *overrideTitle = [NSString stringWithUTF8String:override];
+    // The block retains the arrays and strings until it has run.
+    dispatch_async(dispatch_get_main_queue(), ^{
+      if (!visible) {
+        if (statusItem != nil) {
+          [[NSStatusBar systemStatusBar] removeStatusItem:statusItem];
+          [statusItem release];
+          statusItem = nil;
+        }
+        return;
+      }
+      if (controller == nil) {
+        controller = [[MenuBarController alloc] init];
+      }
+      if (statusItem == nil) {
+        statusItem = [[[NSStatusBar systemStatusBar] statusItemWithLength:NSVariableStatusItemLength] retain];
+      }
+      bool overridden = [overrideTitle length] > 0;
+      NSString *symbol = paused ? @"pause.circle" : overridden ? @"arrow.right.circle" : @"arrow.triangle.branch";
+      NSImage *image = [NSImage imageWithSystemSymbolName:symbol accessibilityDescription:@"Chrome Profile Router"];
+      [image setTemplate:YES];
+      statusItem.button.image = image;
+      NSString *status = paused ? @"Routing paused" : overridden ? overrideTitle : @"Routing links";
+      statusItem.button.toolTip = [@"Chrome Profile Router: " stringByAppendingString:status];
+
+      NSMenu *menu = [[[NSMenu alloc] init] autorelease];
+      [menu addItemWithTitle:status action:nil keyEquivalent:@""];
+      [menu addItem:[NSMenuItem separatorItem]];
+      [menu addItemWithTitle:@"Recent Links" action:nil keyEquivalent:@""];
+      if ([titles count] == 0) {
+        [menu addItemWithTitle:@"None yet" action:nil keyEquivalent:@""];
+      }
+      for (NSString *title in titles) {
+        NSMenuItem *item = [menu addItemWithTitle:title action:nil keyEquivalent:@""];
+        item.indentationLevel = 1;
+      }
+      if ([titles count] > 0 && [profileNames count] > 0) {
+        [menu addItemWithTitle:@"Reopen Last Link In" action:nil keyEquivalent:@""].submenu = reopenMenu(profileNames, setNames);
+      }
+      [menu addItem:[NSMenuItem separatorItem]];
+      NSMenuItem *pause = commandItem(@"Pause Routing", MenuBarTogglePause);
+      pause.state = paused ? NSControlStateValueOn : NSControlStateValueOff;
+      [menu addItem:pause];
+      if ([profileNames count] > 0) {
+        [menu addItemWithTitle:@"Send Every Link To" action:nil keyEquivalent:@""].submenu = overrideMenu(profileNames, durations);
+      }
+      if (overridden) {
+        [menu addItem:commandItem(@"End Override", MenuBarEndOverride)];
+      }
+      [menu addItem:commandItem(@"Edit Rules…", MenuBarEditRules)];
+      [menu addItem:commandItem(@"Reload Config", MenuBarReloadConfig)];
+      [menu addItem:commandItem(@"Open Log", MenuBarOpenLog)];
+      statusItem.menu = menu;
+    });
+  }
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/tailscale/hujson"
+	"gopkg.in/yaml.v3"
+)
+
+// currentConfigVersion is the config schema version understood by this build.
+// Bump it together with a new entry in configMigrations whenever a key is
+// renamed or changes meaning. Configs without a version field predate
+// versioning and are treated as version 1.
+const currentConfigVersion = 2
+
+// configMigrations upgrades a config document from the version used as key to
+// the next one.
+var configMigrations = map[int]func(doc map[string]interface{}) error{
+	// Version 1 configs were written with chrome_app_path set to where Chrome
+	// used to be assumed, which now keeps the router from finding Chrome in
+	// ~/Applications or under another name. Leaving it out lets it be found.
+	1: func(doc map[string]interface{}) error {
+		if doc["chrome_app_path"] == defaultChromeAppPath {
+			delete(doc, "chrome_app_path")
+		}
+		return nil
+	},
+}
+
+func configDocVersion(doc map[string]interface{}) (int, error) {
+	v, ok := doc["version"]
+	if !ok {
+		return 1, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("config version must be an integer")
+	}
+	version, err := n.Int64()
+	if err != nil {
+		return 0, fmt.Errorf("config version must be an integer")
+	}
+	return int(version), nil
+}
+
+// migrateConfigDoc upgrades doc to currentConfigVersion in memory and reports
+// whether anything was changed.
+func migrateConfigDoc(doc map[string]interface{}) (bool, error) {
+	version, err := configDocVersion(doc)
+	if err != nil {
+		return false, err
+	}
+	if version > currentConfigVersion {
+		return false, fmt.Errorf("config version %d is newer than the supported version %d, please upgrade chrome-profile-router", version, currentConfigVersion)
+	}
+	if version == currentConfigVersion {
+		return false, nil
+	}
+	for v := version; v < currentConfigVersion; v++ {
+		migrate, ok := configMigrations[v]
+		if !ok {
+			return false, fmt.Errorf("no migration from config version %d", v)
+		}
+		if err := migrate(doc); err != nil {
+			return false, fmt.Errorf("migrate config from version %d: %w", v, err)
+		}
+	}
+	doc["version"] = currentConfigVersion
+	return true, nil
+}
+
+// migrateConfigJSON applies migrateConfigDoc to a JSON config document.
+func migrateConfigJSON(data []byte) ([]byte, error) {
+	doc, err := decodeConfigDoc(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse config JSON: %w", err)
+	}
+	changed, err := migrateConfigDoc(doc)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return data, nil
+	}
+	return json.Marshal(doc)
+}
+
+// upgradeConfigFiles rewrites the config at path and its conf.d fragments in
+// place when migrating them to the current schema version changes them. The
+// original of every rewritten file is kept next to it as
+// <name>.v<version>.bak.
+func upgradeConfigFiles(path string) error {
+	fragments, err := configFragmentPaths(confDirPath(path))
+	if err != nil {
+		return err
+	}
+	for _, file := range append([]string{path}, fragments...) {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			continue
+		}
+		if err := upgradeConfigFile(file); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+	}
+	return nil
+}
+
+// upgradeConfigFile migrates the config file at path. JSON keeps its
+// comments and formatting, since only the migrated keys are patched; YAML
+// and TOML are written out anew, which drops their comments.
+func upgradeConfigFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	// Standardizing JSON rewrites it in place.
+	data, err := configToJSON(path, bytes.Clone(raw))
+	if err != nil {
+		return err
+	}
+	old, err := decodeConfigDoc(data)
+	if err != nil {
+		return fmt.Errorf("parse config JSON: %w", err)
+	}
+	oldVersion, err := configDocVersion(old)
+	if err != nil {
+		return err
+	}
+	doc, _ := decodeConfigDoc(data)
+	changed, err := migrateConfigDoc(doc)
+	if err != nil || !changed {
+		return err
+	}
+	// A file the migrations leave as it is isn't rewritten just to add the
+	// version; it is migrated in memory on every load instead.
+	ops := configDocPatch("", old, doc)
+	if !slices.ContainsFunc(ops, func(op patchOp) bool { return op.Path != "/version" }) {
+		return nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, oldVersion)
+	var out []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".toml":
+		logger.Warnf("Migrating %s rewrites it without its comments, the original is kept in %s", path, backup)
+		out, err = encodeConfigDoc(path, doc)
+	default:
+		out, err = patchConfigJSON(raw, ops)
+	}
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(backup, raw, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("write backup: %w", err)
+	}
+	if err := os.WriteFile(path, out, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("write migrated config: %w", err)
+	}
+	logger.Infof("Migrated %s from config version %d to %d, backup saved to %s", path, oldVersion, currentConfigVersion, backup)
+	return nil
+}
+
+// patchOp is a JSON Patch (RFC 6902) operation.
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// configDocPatch returns the operations turning the config document old
+// into doc at the JSON pointer ptr. It descends into objects and into lists
+// that kept their length, so as little as possible is replaced.
+func configDocPatch(ptr string, old, doc interface{}) []patchOp {
+	if reflect.DeepEqual(old, doc) {
+		return nil
+	}
+	switch o := old.(type) {
+	case map[string]interface{}:
+		if d, ok := doc.(map[string]interface{}); ok {
+			var ops []patchOp
+			for _, k := range slices.Sorted(maps.Keys(o)) {
+				p := ptr + "/" + escapeJSONPointer(k)
+				if v, ok := d[k]; ok {
+					ops = append(ops, configDocPatch(p, o[k], v)...)
+				} else {
+					ops = append(ops, patchOp{Op: "remove", Path: p})
+				}
+			}
+			for _, k := range slices.Sorted(maps.Keys(d)) {
+				if _, ok := o[k]; !ok {
+					value, _ := json.Marshal(d[k])
+					ops = append(ops, patchOp{Op: "add", Path: ptr + "/" + escapeJSONPointer(k), Value: value})
+				}
+			}
+			return ops
+		}
+	case []interface{}:
+		if d, ok := doc.([]interface{}); ok && len(d) == len(o) {
+			var ops []patchOp
+			for i := range o {
+				ops = append(ops, configDocPatch(fmt.Sprintf("%s/%d", ptr, i), o[i], d[i])...)
+			}
+			return ops
+		}
+	}
+	value, _ := json.Marshal(doc)
+	return []patchOp{{Op: "replace", Path: ptr, Value: value}}
+}
+
+func escapeJSONPointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// patchConfigJSON applies ops to the JSON config in raw, keeping its
+// comments and formatting around what they change.
+func patchConfigJSON(raw []byte, ops []patchOp) ([]byte, error) {
+	v, err := hujson.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse config JSON: %w", err)
+	}
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Patch(patch); err != nil {
+		return nil, fmt.Errorf("migrate config: %w", err)
+	}
+	// Added settings go on a line of their own, indented like the one
+	// before them.
+	for _, op := range ops {
+		if op.Op != "add" {
+			continue
+		}
+		obj, ok := v.Find(op.Path[:strings.LastIndexByte(op.Path, '/')]).Value.(*hujson.Object)
+		if !ok || len(obj.Members) < 2 {
+			continue
+		}
+		added, prev := &obj.Members[len(obj.Members)-1], obj.Members[len(obj.Members)-2]
+		if i := bytes.LastIndexByte(prev.Name.BeforeExtra, '\n'); i >= 0 {
+			added.Name.BeforeExtra = bytes.Clone(prev.Name.BeforeExtra[i:])
+		}
+		added.Value.BeforeExtra = hujson.Extra(" ")
+	}
+	return v.Pack(), nil
+}
+
+// encodeConfigDoc serializes doc in the format implied by the file extension.
+func encodeConfigDoc(path string, doc map[string]interface{}) ([]byte, error) {
+	v := normalizeConfigValue(doc)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yaml.Marshal(v)
+	case ".toml":
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
+	}
+}
+
+// normalizeConfigValue converts json.Number values into plain numbers and
+// arrays of objects into []map[string]interface{} so that every encoder
+// renders them naturally.
+func normalizeConfigValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			out[k] = normalizeConfigValue(e)
+		}
+		return out
+	case []interface{}:
+		tables := make([]map[string]interface{}, 0, len(v))
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = normalizeConfigValue(e)
+			if m, ok := out[i].(map[string]interface{}); ok {
+				tables = append(tables, m)
+			}
+		}
+		if len(v) > 0 && len(tables) == len(v) {
+			return tables
+		}
+		return out
+	default:
+		return v
+	}
+}
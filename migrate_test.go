@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestUpgradeConfigFile(t *testing.T) {
+	logger = logrus.New()
+	logger.SetOutput(io.Discard)
+
+	for _, tt := range []struct {
+		name     string
+		file     string
+		config   string
+		want     []string // in the migrated file
+		dropped  []string // not in the migrated file
+		migrated bool
+	}{
+		{
+			name: "JSON keeps its comments",
+			file: "config.json",
+			config: `{
+  // Set up before Chrome moved to ~/Applications.
+  "chrome_app_path": "/Applications/Google Chrome.app",
+  "default_profile_directory": "Default", // the personal profile
+  "rules": [],
+}
+`,
+			want:     []string{"// the personal profile", `"version": 2`, `"default_profile_directory": "Default"`},
+			dropped:  []string{"chrome_app_path"},
+			migrated: true,
+		},
+		{
+			name: "YAML",
+			file: "config.yaml",
+			config: `chrome_app_path: /Applications/Google Chrome.app
+default_profile_directory: Default
+`,
+			want:     []string{"version: 2", "default_profile_directory: Default"},
+			dropped:  []string{"chrome_app_path"},
+			migrated: true,
+		},
+		{
+			name: "a chosen Chrome stays",
+			file: "config.json",
+			config: `{
+  "chrome_app_path": "/Applications/Google Chrome Beta.app"
+}
+`,
+		},
+		{
+			name: "nothing to migrate",
+			file: "config.json",
+			config: `{
+  // No Chrome path.
+  "default_profile_directory": "Default"
+}
+`,
+		},
+	} {
+		path := filepath.Join(t.TempDir(), tt.file)
+		if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := upgradeConfigFile(path); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(data)
+		backup, err := os.ReadFile(path + ".v1.bak")
+		if !tt.migrated {
+			if got != tt.config {
+				t.Errorf("%s: rewritten to\n%s", tt.name, got)
+			}
+			if err == nil {
+				t.Errorf("%s: backup written", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: read backup: %v", tt.name, err)
+		}
+		if string(backup) != tt.config {
+			t.Errorf("%s: backup is\n%s\nwant the original\n%s", tt.name, backup, tt.config)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(got, s) {
+				t.Errorf("%s: migrated file lacks %q:\n%s", tt.name, s, got)
+			}
+		}
+		for _, s := range tt.dropped {
+			if strings.Contains(got, s) {
+				t.Errorf("%s: migrated file still has %q:\n%s", tt.name, s, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework CoreWLAN -framework CoreLocation
+#include <stdlib.h>
+#include "wifi.h"
+*/
+import "C"
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// defaultVPNInterfaces are the interface names VPN clients use on macOS.
+var defaultVPNInterfaces = []string{"utun*", "ipsec*", "ppp*", "tun*", "tap*"}
+
+// VPNCondition requires a VPN connection. Without routes, any matching
+// interface with a routable address counts as connected; with routes, each
+// of them must also go through one of those interfaces.
+type VPNCondition struct {
+	Interfaces []string `json:"interfaces,omitempty"`
+	Routes     []string `json:"routes,omitempty"`
+}
+
+// compile checks the condition and returns a function reporting whether the
+// VPN is connected.
+func (c VPNCondition) compile() (func() bool, error) {
+	patterns := c.Interfaces
+	if len(patterns) == 0 {
+		patterns = defaultVPNInterfaces
+	}
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("vpn interface %q: %w", p, err)
+		}
+	}
+	var routes []netip.Addr
+	for _, r := range c.Routes {
+		addr, err := parseRouteAddr(r)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, addr)
+	}
+	return func() bool {
+		up := vpnInterfaces(patterns)
+		if len(routes) == 0 {
+			return len(up) > 0
+		}
+		for _, addr := range routes {
+			iface, err := routeInterface(addr)
+			if err != nil {
+				if logger != nil {
+					logger.Warnf("Failed to look up route to %s: %v", addr, err)
+				}
+				return false
+			}
+			if !up[iface] {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// parseRouteAddr parses an address or CIDR range; for a range, the route to
+// its first address is checked.
+func parseRouteAddr(s string) (netip.Addr, error) {
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return prefix.Masked().Addr(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("vpn route %q: not an IP address or CIDR range", s)
+	}
+	return addr, nil
+}
+
+// vpnInterfaces returns the names of the interfaces matching patterns that
+// are up and have a routable address. macOS keeps a few utun interfaces
+// with only link-local addresses around for system services, which don't
+// count.
+func vpnInterfaces(patterns []string) map[string]bool {
+	up := map[string]bool{}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return up
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || !matchesAny(patterns, iface.Name) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLinkLocalUnicast() && !ipnet.IP.IsLoopback() {
+				up[iface.Name] = true
+				break
+			}
+		}
+	}
+	return up
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// routeInterface returns the interface traffic to addr leaves through.
+func routeInterface(addr netip.Addr) (string, error) {
+	args := []string{"-n", "get"}
+	if addr.Is6() {
+		args = append(args, "-inet6")
+	}
+	out, err := exec.Command("route", append(args, addr.String())...).Output()
+	if err != nil {
+		return "", fmt.Errorf("route get: %w", err)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "interface:"); ok {
+			return strings.TrimSpace(name), nil
+		}
+	}
+	return "", fmt.Errorf("no route to %s", addr)
+}
+
+// resolveTimeout bounds how long routing waits for the host's addresses.
+const resolveTimeout = 2 * time.Second
+
+// resolveRanges are the CIDR ranges a resolves_to condition accepts.
+type resolveRanges struct {
+	prefixes []netip.Prefix
+	private  bool
+}
+
+// parseResolveRanges parses CIDR ranges or addresses; "private" stands for
+// the private IPv4 ranges and IPv6 unique local addresses.
+func parseResolveRanges(values []string) (resolveRanges, error) {
+	var ranges resolveRanges
+	for _, v := range values {
+		if strings.EqualFold(v, "private") {
+			ranges.private = true
+			continue
+		}
+		p, err := parseCIDR(v)
+		if err != nil {
+			return resolveRanges{}, fmt.Errorf("resolves_to: %w", err)
+		}
+		ranges.prefixes = append(ranges.prefixes, p)
+	}
+	return ranges, nil
+}
+
+func (r resolveRanges) contains(addr netip.Addr) bool {
+	if r.private && addr.IsPrivate() {
+		return true
+	}
+	return slices.ContainsFunc(r.prefixes, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
+
+// hostAddrs returns the addresses the URL's host resolves to, looking them
+// up the first time a rule asks for them while routing req. Hosts that don't
+// resolve, such as internal names while off the VPN, have none.
+func (req *routeRequest) hostAddrs() []netip.Addr {
+	if !req.addrsLoaded {
+		req.addrsLoaded = true
+		if req.host == "" {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", req.host)
+		if err != nil {
+			if logger != nil {
+				logger.Debugf("Failed to resolve %s: %v", req.host, err)
+			}
+			return nil
+		}
+		for _, addr := range addrs {
+			req.addrs = append(req.addrs, addr.Unmap())
+		}
+	}
+	return req.addrs
+}
+
+// currentSSID returns the name of the Wi-Fi network the Mac is connected to,
+// or "" when it isn't on Wi-Fi or macOS withholds the name.
+func currentSSID() string {
+	ssid := C.CurrentSSID()
+	if ssid == nil {
+		return ""
+	}
+	defer C.free(unsafe.Pointer(ssid))
+	return C.GoString(ssid)
+}
+
+// wifiSSID returns the Wi-Fi network the Mac is on, looking it up the first
+// time a rule asks for it while routing req.
+func (req *routeRequest) wifiSSID() string {
+	if req.ssid == nil {
+		ssid := currentSSID()
+		req.ssid = &ssid
+	}
+	return *req.ssid
+}
+
+// requestLocationAccess asks to use Location Services. Since macOS 14 the
+// Wi-Fi network name is only available to apps allowed to.
+func requestLocationAccess() {
+	C.RequestLocationAccess()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// canonicalHost lowercases host and encodes internationalized labels in
+// punycode, the form browsers use, so "bücher.example" and
+// "xn--bcher-kva.example" are the same host.
+func canonicalHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ascii, err := idna.ToASCII(host); err == nil {
+		host = ascii
+	}
+	return host
+}
+
+// normalizeURL spells raw the canonical way: lowercase scheme and host in
+// punycode, no default port, and no "." or ".." path segments. URLs
+// without a host, such as mailto: links, are left alone.
+func normalizeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Opaque != "" {
+		return raw
+	}
+	host := canonicalHost(u.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+	if p := u.EscapedPath(); strings.Contains(p, ".") {
+		// Work on the escaped path, where an encoded slash doesn't
+		// separate segments.
+		p = removeDotSegments(p)
+		if path, err := url.PathUnescape(p); err == nil {
+			u.Path, u.RawPath = path, p
+		}
+	}
+	return u.String()
+}
+
+// removeDotSegments resolves "." and ".." segments as described in RFC 3986
+// section 5.2.4, keeping a trailing slash.
+func removeDotSegments(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		return p
+	}
+	var out []string
+	segments := strings.Split(p[1:], "/")
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		switch seg {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
@@ -0,0 +1,94 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework Cocoa -framework UserNotifications
+#include <stdlib.h>
+#include "notify.h"
+*/
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// notificationsUnavailable makes the reason notifications can't be posted
+// show up in the log once, not for every link.
+var notificationsUnavailable sync.Once
+
+// routingReason returns why a link went where the rule at index rule in
+// config.Rules sent it, -1 for no rule, and whether notify and the rule's
+// own notify ask for a notification about it.
+func (config Config) routingReason(rule int) (string, bool) {
+	if rule < 0 || rule >= len(config.Rules) {
+		return "No rule matched", config.Notify
+	}
+	r := config.Rules[rule]
+	notify := config.Notify
+	if r.Notify != nil {
+		notify = *r.Notify
+	}
+	name := r.Name
+	if name == "" {
+		name = describeRule(r)
+	}
+	return "Rule: " + name, notify
+}
+
+// notifyRouting posts a notification saying urlStr was opened at t and
+// why, with the profile's account picture when it has one. Clicking it
+// offers to open the link again in another profile.
+func notifyRouting(config Config, urlStr string, t launchTarget, why string) {
+	label := targetLabels([]launchTarget{t}, config)[0]
+	if label == "" {
+		label = appName(config.browserAppPath(t.browser))
+	}
+	picture := ""
+	if !t.opensApp() && !t.guest && t.profile != ephemeralProfile {
+		if p, ok := newProfileCache(config).lookup(t); ok {
+			picture = p.Picture
+		}
+	}
+	cPicture := C.CString(picture)
+	defer C.free(unsafe.Pointer(cPicture))
+	cTitle := C.CString("Opened in " + label)
+	defer C.free(unsafe.Pointer(cTitle))
+	cWhy := C.CString(why)
+	defer C.free(unsafe.Pointer(cWhy))
+	cURL := C.CString(urlStr)
+	defer C.free(unsafe.Pointer(cURL))
+	C.PostRoutingNotification(cTitle, cWhy, cURL, cPicture)
+}
+
+// setUpNotifications makes notifications posted by this or an earlier run
+// clickable.
+func setUpNotifications() {
+	C.SetUpNotifications()
+}
+
+// reopenWithPicker shows the profile picker with every profile for urlStr,
+// which was already opened once, and opens it again where the user chooses.
+func reopenWithPicker(config Config, urlStr string) {
+	choice, ok := promptForTarget(urlStr, pickerTargets(nil, config), config, "Cancel")
+	if !ok {
+		return
+	}
+	targetURL := config.urlForProfile(urlStr, choice.profile)
+	logger.Debugf("Reopening: %s  ->  %s\n", targetURL, choice)
+	openURLWithRetries(config, choice, targetURL)
+	recordRouting(config, targetURL, choice)
+}
+
+//export NotificationReopen
+func NotificationReopen(cURL *C.char) {
+	urlStr := C.GoString(cURL)
+	go reopenWithPicker(*currentConfig.Load(), urlStr)
+}
+
+//export NotificationsUnavailable
+func NotificationsUnavailable(cMessage *C.char) {
+	message := C.GoString(cMessage)
+	notificationsUnavailable.Do(func() {
+		logger.Warnf("Can't post notifications: %s", message)
+	})
+}
@@ -0,0 +1,14 @@
+extern void NotificationReopen(char *url);
+extern void NotificationsUnavailable(char *message);
+
+// SetUpNotifications lets the router's notifications be clicked, which
+// calls NotificationReopen with the URL the notification is about. Outside
+// an app bundle there are no notifications, and it does nothing.
+void SetUpNotifications(void);
+
+// PostRoutingNotification tells the user that url was opened, with title
+// saying where and subtitle why, and the image at the path picture unless
+// it is empty, asking for permission the first time.
+// When notifications aren't allowed, NotificationsUnavailable is called
+// with the reason instead.
+void PostRoutingNotification(const char *title, const char *subtitle, const char *url, const char *picture);
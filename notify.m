@@ -0,0 +1,116 @@
+#import <Cocoa/Cocoa.h>
+#import <UserNotifications/UserNotifications.h>
+#include "notify.h"
+
+static NSString *const routingCategory = @"routing";
+static NSString *const reopenAction = @"reopen";
+
+@interface NotificationDelegate : NSObject <UNUserNotificationCenterDelegate>
+@end
+
+@implementation NotificationDelegate
+// Notifications show even though the router counts as the active app
+// while it handles a link.
+- (void)userNotificationCenter:(UNUserNotificationCenter *)center
+       willPresentNotification:(UNNotification *)notification
+         withCompletionHandler:(void (^)(UNNotificationPresentationOptions))completionHandler {
+  completionHandler(UNNotificationPresentationOptionBanner | UNNotificationPresentationOptionList);
+}
+
+- (void)userNotificationCenter:(UNUserNotificationCenter *)center
+    didReceiveNotificationResponse:(UNNotificationResponse *)response
+             withCompletionHandler:(void (^)(void))completionHandler {
+  NSString *action = response.actionIdentifier;
+  NSString *url = response.notification.request.content.userInfo[@"url"];
+  if (url != nil && ([action isEqualToString:reopenAction] || [action isEqualToString:UNNotificationDefaultActionIdentifier])) {
+    NotificationReopen((char *)[url UTF8String]);
+  }
+  completionHandler();
+}
+@end
+
+// notificationCenter returns the user notification center, or nil outside
+// an app bundle, where asking for it throws.
+static UNUserNotificationCenter *notificationCenter(void) {
+  if ([[NSBundle mainBundle] bundleIdentifier] == nil) {
+    return nil;
+  }
+  return [UNUserNotificationCenter currentNotificationCenter];
+}
+
+void SetUpNotifications(void) {
+  dispatch_async(dispatch_get_main_queue(), ^{
+    UNUserNotificationCenter *center = notificationCenter();
+    if (center == nil) {
+      return;
+    }
+    static NotificationDelegate *delegate;
+    if (delegate != nil) {
+      return;
+    }
+    delegate = [[NotificationDelegate alloc] init];
+    center.delegate = delegate;
+    UNNotificationAction *reopen = [UNNotificationAction actionWithIdentifier:reopenAction
+                                                                        title:@"Open in Another Profile…"
+                                                                      options:UNNotificationActionOptionForeground];
+    UNNotificationCategory *category = [UNNotificationCategory categoryWithIdentifier:routingCategory
+                                                                              actions:@[ reopen ]
+                                                                    intentIdentifiers:@[]
+                                                                              options:0];
+    [center setNotificationCategories:[NSSet setWithObject:category]];
+  });
+}
+
+// pictureAttachment returns an attachment showing a copy of the picture at
+// path, since attachments are moved into the notification store, or nil if
+// there is none.
+static UNNotificationAttachment *pictureAttachment(NSString *path) {
+  if ([path length] == 0) {
+    return nil;
+  }
+  NSString *name = [[[NSUUID UUID] UUIDString] stringByAppendingPathExtension:[path pathExtension]];
+  NSURL *copy = [NSURL fileURLWithPath:[NSTemporaryDirectory() stringByAppendingPathComponent:name]];
+  if (![[NSFileManager defaultManager] copyItemAtURL:[NSURL fileURLWithPath:path] toURL:copy error:nil]) {
+    return nil;
+  }
+  return [UNNotificationAttachment attachmentWithIdentifier:@"picture" URL:copy options:nil error:nil];
+}
+
+void PostRoutingNotification(const char *title, const char *subtitle, const char *url, const char *picture) {
+  @autoreleasepool {
+    UNMutableNotificationContent *content = [[[UNMutableNotificationContent alloc] init] autorelease];
+    content.title = [NSString stringWithUTF8String:title];
+    content.subtitle = [NSString stringWithUTF8String:subtitle];
+    content.body = [NSString stringWithUTF8String:url];
+    content.categoryIdentifier = routingCategory;
+    content.userInfo = @{@"url" : [NSString stringWithUTF8String:url]};
+    UNNotificationAttachment *attachment = pictureAttachment([NSString stringWithUTF8String:picture]);
+    if (attachment != nil) {
+      content.attachments = @[ attachment ];
+    }
+    // Each notification replaces the one before, so they don't pile up.
+    UNNotificationRequest *request = [UNNotificationRequest requestWithIdentifier:@"routing" content:content trigger:nil];
+    // The block retains the request until it has run.
+    dispatch_async(dispatch_get_main_queue(), ^{
+      UNUserNotificationCenter *center = notificationCenter();
+      if (center == nil) {
+        NotificationsUnavailable("the router isn't running from its app bundle");
+        return;
+      }
+      [center requestAuthorizationWithOptions:UNAuthorizationOptionAlert
+                            completionHandler:^(BOOL granted, NSError *error) {
+                              if (!granted) {
+                                NotificationsUnavailable(error != nil ? (char *)[[error localizedDescription] UTF8String]
+                                                                      : "they are turned off in System Settings");
+                                return;
+                              }
+                              [center addNotificationRequest:request
+                                       withCompletionHandler:^(NSError *error) {
+                                         if (error != nil) {
+                                           NotificationsUnavailable((char *)[[error localizedDescription] UTF8String]);
+                                         }
+                                       }];
+                            }];
+    });
+  }
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ruleOverlap counts the corpus URLs on which two rules compete.
+type ruleOverlap struct {
+	winner, loser int
+	count         int
+	example       string
+}
+
+// overlapReport summarizes how the rules of cfg treat a corpus of URLs.
+type overlapReport struct {
+	urls      int
+	unmatched int
+	matched   map[int]int // rule index -> URLs it matches
+	won       map[int]int // rule index -> URLs it decides
+	overlaps  []*ruleOverlap
+}
+
+// analyzeOverlaps runs every URL through the rules of cfg and records which
+// rules match it and which of them wins under the configured policy.
+func analyzeOverlaps(cfg Config, urls []string) overlapReport {
+	report := overlapReport{matched: map[int]int{}, won: map[int]int{}}
+	pairs := map[[2]int]*ruleOverlap{}
+	for _, u := range urls {
+		report.urls++
+		req := newRouteRequest(u)
+		cfg.transformURL(req)
+		var matches []int
+		for _, r := range cfg.compiledRules {
+			if _, ok := r.route(req); ok {
+				report.matched[r.index]++
+				// Rules with continue set let evaluation go on, so they
+				// don't compete with the rules after them.
+				if !r.cont {
+					matches = append(matches, r.index)
+				}
+			}
+		}
+		if len(matches) == 0 {
+			report.unmatched++
+			continue
+		}
+
+		winners := matches[:1]
+		switch cfg.MultiMatchPolicy {
+		case MultiMatchPolicyLast:
+			winners = matches[len(matches)-1:]
+		case MultiMatchPolicyAll, MultiMatchPolicyPrompt:
+			winners = matches
+		}
+		for _, w := range winners {
+			report.won[w]++
+		}
+		if len(winners) > 1 {
+			// Every match is used, so there is nothing to win.
+			continue
+		}
+		for _, l := range matches {
+			if l == winners[0] {
+				continue
+			}
+			key := [2]int{winners[0], l}
+			o := pairs[key]
+			if o == nil {
+				o = &ruleOverlap{winner: winners[0], loser: l, example: u}
+				pairs[key] = o
+				report.overlaps = append(report.overlaps, o)
+			}
+			o.count++
+		}
+	}
+	sort.SliceStable(report.overlaps, func(a, b int) bool {
+		return report.overlaps[a].count > report.overlaps[b].count
+	})
+	return report
+}
+
+// readURLCorpus reads one URL per line, skipping blank lines and # comments.
+func readURLCorpus(r io.Reader) ([]string, error) {
+	var urls []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, sc.Err()
+}
+
+// runConfigOverlap reads URLs, one per line, from the file at path, or from
+// standard input for "", and reports the rules competing for them.
+func runConfigOverlap(path, configPath string) int {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	in := io.Reader(os.Stdin)
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open URL list: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	urls, err := readURLCorpus(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read URL list: %v\n", err)
+		return 1
+	}
+
+	report := analyzeOverlaps(cfg, urls)
+	describe := func(i int) string {
+		r := cfg.Rules[i]
+		return fmt.Sprintf("rule %d (%s -> %s)", i, describeRule(r), r.destination())
+	}
+
+	fmt.Printf("%d URLs, %d matched no rule\n", report.urls, report.unmatched)
+	if len(report.overlaps) == 0 {
+		fmt.Println("\nNo rules compete for the same URLs.")
+	} else {
+		fmt.Println("\nCompeting rules:")
+		for _, o := range report.overlaps {
+			same := ""
+			if cfg.Rules[o.winner].destination() == cfg.Rules[o.loser].destination() {
+				same = ", same profile"
+			}
+			fmt.Printf("  %s wins over %s on %d URLs%s\n", describe(o.winner), describe(o.loser), o.count, same)
+			fmt.Printf("    e.g. %s\n", o.example)
+		}
+	}
+
+	fmt.Println("\nRules by URLs matched / decided:")
+	for _, r := range cfg.compiledRules {
+		fmt.Printf("  %5d / %-5d %s\n", report.matched[r.index], report.won[r.index], describe(r.index))
+	}
+	return 0
+}
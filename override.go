@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// routeOverride sends every link to one profile until a time, whatever the
+// rules say.
+type routeOverride struct {
+	ProfileDirectory string    `json:"profile_directory"`
+	Until            time.Time `json:"until"`
+}
+
+// overrideDurations are the lengths of override the menu bar offers.
+var overrideDurations = []time.Duration{15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour}
+
+// overrideStatePath is where the override set from the menu bar or with
+// `chrome-profile-router override` is recorded.
+func overrideStatePath() string {
+	return filepath.Join(defaultStateDir(), "override.json")
+}
+
+// readOverride returns the recorded override, which may have run out.
+func readOverride() (routeOverride, error) {
+	var o routeOverride
+	data, err := os.ReadFile(overrideStatePath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return o, fmt.Errorf("read override: %w", err)
+	}
+	if err := json.Unmarshal(data, &o); err != nil {
+		return o, fmt.Errorf("parse override %s: %w", overrideStatePath(), err)
+	}
+	return o, nil
+}
+
+// setOverride sends every link to the profile in dir for d, or ends the
+// override when dir is "".
+func setOverride(dir string, d time.Duration) error {
+	if dir == "" {
+		if err := os.Remove(overrideStatePath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, _ := json.MarshalIndent(routeOverride{ProfileDirectory: dir, Until: time.Now().Add(d).Truncate(time.Second)}, "", "  ")
+	return writeFileAtomic(overrideStatePath(), append(data, '\n'))
+}
+
+// active reports whether the override is in effect.
+func (o routeOverride) active() bool {
+	return o.ProfileDirectory != "" && time.Now().Before(o.Until)
+}
+
+// overrideTarget returns the target every link opens in while an override
+// is in effect.
+func (config Config) overrideTarget() (launchTarget, bool) {
+	if !config.override.active() {
+		return launchTarget{}, false
+	}
+	return config.profileTarget(config.override.ProfileDirectory), true
+}
+
+// overrideEnd reloads the config when the override runs out, so the menu bar
+// stops showing it.
+var overrideEnd struct {
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+func scheduleOverrideEnd(config Config) {
+	overrideEnd.mu.Lock()
+	defer overrideEnd.mu.Unlock()
+	if overrideEnd.timer != nil {
+		overrideEnd.timer.Stop()
+		overrideEnd.timer = nil
+	}
+	if !config.override.active() {
+		return
+	}
+	overrideEnd.timer = time.AfterFunc(time.Until(config.override.Until), func() {
+		logger.Infof("Override to %q ended", config.override.ProfileDirectory)
+		reloadConfig(config.path)
+	})
+}
+
+// overrideFromMenu starts or ends an override chosen in the menu bar.
+func overrideFromMenu(config Config, dir string, d time.Duration) {
+	if err := setOverride(dir, d); err != nil {
+		logger.Errorf("Failed to save override: %v", err)
+		return
+	}
+	if dir != "" {
+		logger.Infof("Sending every link to %q for %s", dir, d)
+	} else {
+		logger.Info("Override ended")
+	}
+	reloadConfig(config.path)
+}
+
+func runOverride(args []string, clear bool, configPath string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: chrome-profile-router override [<profile> <duration> | --clear]")
+		return 2
+	}
+
+	switch {
+	case clear && len(args) != 0:
+		return usage()
+	case len(args) == 0 && !clear:
+		o, err := readOverride()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if !o.active() {
+			fmt.Println("No override, links follow the rules")
+			return 0
+		}
+		fmt.Printf("Every link opens in %q until %s\n", o.ProfileDirectory, o.Until.Local().Format("15:04"))
+		return 0
+	case clear:
+		if err := setOverride("", 0); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to end override: %v\n", err)
+			return 1
+		}
+	case len(args) == 2:
+		d, err := time.ParseDuration(args[1])
+		if err != nil || d <= 0 {
+			fmt.Fprintf(os.Stderr, "%q is not a positive duration such as \"30m\"\n", args[1])
+			return 2
+		}
+		profiles, _ := readChromeProfiles(defaultChromeUserDataDir())
+		dir := profileDirectoryFor(args[0], profiles)
+		if len(profiles) > 0 && !slices.ContainsFunc(profiles, func(p chromeProfile) bool { return p.Directory == dir }) {
+			fmt.Fprintf(os.Stderr, "no Chrome profile is named %q\n", args[0])
+			return 1
+		}
+		if err := setOverride(dir, d); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to save override: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Every link opens in %q for %s\n", dir, d)
+	default:
+		return usage()
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	notifyRunningInstance(cfg.PidFile)
+	return 0
+}
@@ -0,0 +1,157 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework CFNetwork -framework Foundation
+#include <stdlib.h>
+#include "pac.h"
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+const (
+	pacRefreshInterval = time.Hour
+	pacRetryDelay      = time.Minute
+	pacFetchTimeout    = 5 * time.Second
+)
+
+// PACCondition requires the proxy auto-configuration script at URL to send
+// the URL through a proxy. Without URL, the script set in the network
+// settings is used; with proxies, only those count.
+type PACCondition struct {
+	URL     string   `json:"url,omitempty"`
+	Proxies []string `json:"proxies,omitempty"`
+}
+
+// compile checks the condition and returns a function reporting whether a
+// URL is proxied.
+func (c PACCondition) compile() (func(req *routeRequest) bool, error) {
+	if c.URL != "" {
+		if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "file") {
+			return nil, fmt.Errorf("pac url %q: want an http, https, or file URL", c.URL)
+		}
+	}
+	proxies := lowerAll(c.Proxies)
+	return func(req *routeRequest) bool {
+		if req.url == nil {
+			return false
+		}
+		pacURL := c.URL
+		if pacURL == "" {
+			if pacURL = systemPACURL(); pacURL == "" {
+				return false
+			}
+		}
+		script, err := pacScripts.get(pacURL)
+		if err != nil {
+			if logger != nil {
+				logger.Warnf("Failed to load PAC file %s: %v", pacURL, err)
+			}
+			return false
+		}
+		for _, p := range proxiesForURL(script, req.raw) {
+			if p == "DIRECT" {
+				// Later entries are fallbacks when a proxy is unreachable.
+				return false
+			}
+			_, addr, _ := strings.Cut(p, " ")
+			if len(proxies) == 0 || matchesAny(proxies, strings.ToLower(addr)) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// pacCache holds downloaded PAC files so routing doesn't fetch them for
+// every URL.
+type pacCache struct {
+	mu      sync.Mutex
+	scripts map[string]pacScript
+}
+
+type pacScript struct {
+	source    string
+	err       error
+	fetchedAt time.Time
+}
+
+var pacScripts = &pacCache{scripts: map[string]pacScript{}}
+
+// get returns the PAC file at rawURL, fetching it again once it is older
+// than pacRefreshInterval. A copy that can't be refreshed is kept, since the
+// PAC server may only be reachable on the corporate network.
+func (c *pacCache) get(rawURL string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.scripts[rawURL]
+	age := time.Since(s.fetchedAt)
+	if ok && (age < pacRefreshInterval && s.err == nil || age < pacRetryDelay) {
+		return s.source, s.err
+	}
+	source, err := fetchPAC(rawURL)
+	switch {
+	case err == nil:
+		s = pacScript{source: source}
+	case s.source != "":
+		if logger != nil {
+			logger.Warnf("Failed to refresh PAC file %s, using cached copy: %v", rawURL, err)
+		}
+	default:
+		s.err = err
+	}
+	s.fetchedAt = time.Now()
+	c.scripts[rawURL] = s
+	return s.source, s.err
+}
+
+func fetchPAC(rawURL string) (string, error) {
+	if path, ok := strings.CutPrefix(rawURL, "file://"); ok {
+		data, err := os.ReadFile(path)
+		return string(data), err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pacFetchTimeout)
+	defer cancel()
+	_, body, err := httpGet(ctx, rawURL, nil)
+	return string(body), err
+}
+
+// proxiesForURL evaluates a PAC script for rawURL, returning the proxies to
+// try in order as "TYPE host:port", or "DIRECT".
+func proxiesForURL(script, rawURL string) []string {
+	cScript := C.CString(script)
+	defer C.free(unsafe.Pointer(cScript))
+	cURL := C.CString(rawURL)
+	defer C.free(unsafe.Pointer(cURL))
+	out := C.ProxiesForURL(cScript, cURL)
+	if out == nil {
+		if logger != nil {
+			logger.Warnf("Failed to evaluate PAC file for %s", rawURL)
+		}
+		return nil
+	}
+	defer C.free(unsafe.Pointer(out))
+	if s := C.GoString(out); s != "" {
+		return strings.Split(s, "\n")
+	}
+	return nil
+}
+
+// systemPACURL returns the PAC URL from the network settings, or "".
+func systemPACURL() string {
+	u := C.SystemPACURL()
+	if u == nil {
+		return ""
+	}
+	defer C.free(unsafe.Pointer(u))
+	return C.GoString(u)
+}
@@ -0,0 +1,9 @@
+// ProxiesForURL evaluates the proxy auto-configuration script for url and
+// returns the proxies to use, one "TYPE host:port" per line with "DIRECT"
+// for a direct connection, as a string the caller must free. It returns NULL
+// when the script fails.
+char *ProxiesForURL(const char *script, const char *url);
+
+// SystemPACURL returns the proxy auto-configuration URL set in the network
+// settings, or NULL when none is, as a string the caller must free.
+char *SystemPACURL(void);
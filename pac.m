@@ -0,0 +1,62 @@
+#import <CFNetwork/CFNetwork.h>
+#import <Foundation/Foundation.h>
+#include "pac.h"
+
+static NSString *proxyType(NSString *type) {
+  if ([type isEqualToString:(NSString *)kCFProxyTypeNone]) {
+    return @"DIRECT";
+  }
+  if ([type isEqualToString:(NSString *)kCFProxyTypeSOCKS]) {
+    return @"SOCKS";
+  }
+  if ([type isEqualToString:(NSString *)kCFProxyTypeHTTPS]) {
+    return @"HTTPS";
+  }
+  return @"PROXY";
+}
+
+char *ProxiesForURL(const char *script, const char *url) {
+  @autoreleasepool {
+    NSString *source = [NSString stringWithUTF8String:script];
+    NSURL *target = [NSURL URLWithString:[NSString stringWithUTF8String:url]];
+    if (source == nil || target == nil) {
+      return NULL;
+    }
+    CFErrorRef error = NULL;
+    CFArrayRef proxies = CFNetworkCopyProxiesForAutoConfigurationScript((CFStringRef)source,
+                                                                        (CFURLRef)target, &error);
+    if (proxies == NULL) {
+      if (error != NULL) {
+        CFRelease(error);
+      }
+      return NULL;
+    }
+    NSMutableArray *lines = [NSMutableArray array];
+    for (NSDictionary *proxy in (NSArray *)proxies) {
+      NSString *type = proxyType(proxy[(NSString *)kCFProxyTypeKey]);
+      NSString *host = proxy[(NSString *)kCFProxyHostNameKey];
+      NSNumber *port = proxy[(NSString *)kCFProxyPortNumberKey];
+      if ([type isEqualToString:@"DIRECT"] || host == nil) {
+        [lines addObject:type];
+      } else {
+        [lines addObject:[NSString stringWithFormat:@"%@ %@:%@", type, host, port ?: @0]];
+      }
+    }
+    CFRelease(proxies);
+    return strdup([[lines componentsJoinedByString:@"\n"] UTF8String]);
+  }
+}
+
+char *SystemPACURL(void) {
+  @autoreleasepool {
+    NSDictionary *settings = [(NSDictionary *)CFNetworkCopySystemProxySettings() autorelease];
+    if (![settings[(NSString *)kCFNetworkProxiesProxyAutoConfigEnable] boolValue]) {
+      return NULL;
+    }
+    NSString *url = settings[(NSString *)kCFNetworkProxiesProxyAutoConfigURLString];
+    if (url.length == 0) {
+      return NULL;
+    }
+    return strdup([url UTF8String]);
+  }
+}
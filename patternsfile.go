@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolveConfigRelativePath resolves p against the directory of the config
+// file at configPath. A leading ~/ refers to the home directory.
+func resolveConfigRelativePath(configPath, p string) string {
+	if rest, ok := strings.CutPrefix(p, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(filepath.Dir(configPath), p)
+}
+
+// readPatternsFile reads the list file referenced by a rule's patterns_file.
+func readPatternsFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read patterns file: %w", err)
+	}
+	return parsePatternList(data), nil
+}
+
+// hostsFileNames are names commonly mapped in hosts files that never
+// identify a site.
+var hostsFileNames = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"0.0.0.0":               true,
+}
+
+// parsePatternList returns the entries of a pattern list: one domain,
+// regex, or glob per line. Blank lines and lines starting with # are skipped.
+// Lines in hosts file format ("0.0.0.0 example.com") contribute their host
+// names.
+func parsePatternList(data []byte) []string {
+	var entries []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+			for _, name := range fields[1:] {
+				if strings.HasPrefix(name, "#") {
+					break
+				}
+				if !hostsFileNames[name] && !strings.HasPrefix(name, "ip6-") {
+					entries = append(entries, name)
+				}
+			}
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return entries
+}
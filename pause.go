@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// pauseStatePath is where pausing routing is recorded. While it exists,
+// links skip the rules and go to Chrome without a profile, which opens them
+// in the one last used, and routing stays paused across restarts.
+func pauseStatePath() string {
+	return filepath.Join(defaultStateDir(), "paused")
+}
+
+// routingPaused reports whether routing is paused.
+func routingPaused() bool {
+	_, err := os.Stat(pauseStatePath())
+	return err == nil
+}
+
+// setRoutingPaused pauses or resumes routing. A running router picks the
+// change up when it next reloads its config.
+func setRoutingPaused(paused bool) error {
+	if !paused {
+		if err := os.Remove(pauseStatePath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeFileAtomic(pauseStatePath(), nil)
+}
+
+// togglePause pauses routing when it runs and resumes it when paused, for
+// the menu bar and the pause hot key.
+func togglePause(config Config) {
+	if err := setRoutingPaused(!config.paused); err != nil {
+		logger.Errorf("Failed to pause routing: %v", err)
+		return
+	}
+	if config.paused {
+		logger.Info("Routing resumed")
+	} else {
+		logger.Info("Routing paused")
+	}
+	reloadConfig(config.path)
+}
+
+// runPause pauses or resumes routing from the command line.
+func runPause(args []string, configPath string, paused bool) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: chrome-profile-router pause | resume")
+		return 2
+	}
+	if err := setRoutingPaused(paused); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to save pause: %v\n", err)
+		return 1
+	}
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	notifyRunningInstance(cfg.PidFile)
+	if paused {
+		fmt.Println("Routing paused, links open in Chrome's last used profile")
+	} else {
+		fmt.Println("Routing resumed")
+	}
+	return 0
+}
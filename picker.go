@@ -0,0 +1,51 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework Cocoa
+#include <stdlib.h>
+#include "picker.h"
+*/
+import "C"
+
+import "unsafe"
+
+// pickerItem is one choice in the profile picker.
+type pickerItem struct {
+	label  string
+	detail string // shown below the label, such as the signed-in account
+	image  string // picture or app to show, "" for the label's initial
+	color  int    // color of the initial's circle as 0xRRGGBB, -1 for gray
+}
+
+// pickTarget shows the profile picker for urlStr and waits for the user to
+// choose, returning the index of the chosen item, or -1 when cancelled with
+// Escape or the button titled cancel. Unless remember is "", the picker has
+// a checkbox labeled with it, and pickTarget reports whether it was
+// checked.
+func pickTarget(urlStr string, items []pickerItem, remember, cancel string) (int, bool) {
+	cURL := C.CString(urlStr)
+	defer C.free(unsafe.Pointer(cURL))
+	cCancel := C.CString(cancel)
+	defer C.free(unsafe.Pointer(cCancel))
+	var cRemember *C.char
+	if remember != "" {
+		cRemember = C.CString(remember)
+		defer C.free(unsafe.Pointer(cRemember))
+	}
+	cLabels := make([]*C.char, len(items)+1)
+	cDetails := make([]*C.char, len(items)+1)
+	cImages := make([]*C.char, len(items)+1)
+	cColors := make([]C.long, len(items)+1)
+	for i, item := range items {
+		cLabels[i] = C.CString(item.label)
+		defer C.free(unsafe.Pointer(cLabels[i]))
+		cDetails[i] = C.CString(item.detail)
+		defer C.free(unsafe.Pointer(cDetails[i]))
+		cImages[i] = C.CString(item.image)
+		defer C.free(unsafe.Pointer(cImages[i]))
+		cColors[i] = C.long(item.color)
+	}
+	var remembered C.bool
+	choice := C.PickTarget(cURL, &cLabels[0], &cDetails[0], &cImages[0], &cColors[0], C.int(len(items)), cRemember, cCancel, &remembered)
+	return int(choice), bool(remembered)
+}
@@ -0,0 +1,15 @@
+#include <stdbool.h>
+
+// PickTarget shows a panel asking which of the n labels url should open in,
+// and waits for an answer. Each label has the line in details below it,
+// unless that is empty, and the image at the path in images, the icon of
+// the app for paths ending in .app, or else its initial on a circle of the
+// color in colors, as 0xRRGGBB or -1 for gray. The first label is
+// highlighted, the arrow keys move the highlight, and Return chooses it;
+// the number keys choose the first nine labels directly. Escape presses
+// the button titled cancelLabel. Unless rememberLabel is NULL, a checkbox
+// with that title is shown, and remembered is set to whether it was
+// checked. It returns the chosen index, or -1 when cancelled, and must not
+// be called on the main thread.
+int PickTarget(const char *url, const char **labels, const char **details, const char **images, const long *colors, int n,
+               const char *rememberLabel, const char *cancelLabel, bool *remembered);
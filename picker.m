@@ -0,0 +1,249 @@
+#import <Cocoa/Cocoa.h>
+#include "picker.h"
+
+static const CGFloat avatarSize = 28;
+
+@interface PickerController : NSObject <NSWindowDelegate> {
+ @public
+  NSInteger choice;
+  dispatch_semaphore_t done;
+  NSMutableArray<NSButton *> *buttons;
+  NSInteger selected;
+  NSButton *remember;
+  BOOL remembered;
+}
+- (void)moveSelection:(NSInteger)delta;
+- (BOOL)chooseNumber:(NSInteger)number;
+@end
+
+// PickerPanel moves the highlighted choice, which Return accepts, with the
+// arrow keys, and chooses the first nine by their numbers.
+@interface PickerPanel : NSPanel {
+ @public
+  PickerController *picker;
+}
+@end
+
+@implementation PickerPanel
+- (void)keyDown:(NSEvent *)event {
+  switch ([event keyCode]) {
+  case 125: // down arrow
+    [picker moveSelection:1];
+    break;
+  case 126: // up arrow
+    [picker moveSelection:-1];
+    break;
+  default: {
+    NSString *key = [event charactersIgnoringModifiers];
+    unichar c = [key length] == 1 ? [key characterAtIndex:0] : 0;
+    if (c < '1' || c > '9' || ![picker chooseNumber:c - '0']) {
+      [super keyDown:event];
+    }
+  }
+  }
+}
+@end
+
+@implementation PickerController
+- (void)moveSelection:(NSInteger)delta {
+  NSInteger count = [buttons count];
+  if (count == 0) {
+    return;
+  }
+  [buttons[selected] setKeyEquivalent:@""];
+  selected = (selected + delta + count) % count;
+  [buttons[selected] setKeyEquivalent:@"\r"];
+}
+
+// chooseNumber chooses the button numbered number, counting from 1, and
+// reports whether there is one.
+- (BOOL)chooseNumber:(NSInteger)number {
+  if (number > (NSInteger)[buttons count]) {
+    return NO;
+  }
+  [self choose:buttons[number - 1]];
+  return YES;
+}
+
+- (void)choose:(id)sender {
+  choice = [sender tag];
+  remembered = remember != nil && [remember state] == NSControlStateValueOn;
+  [[sender window] close];
+}
+
+- (void)cancel:(id)sender {
+  [[sender window] close];
+}
+
+- (void)windowWillClose:(NSNotification *)notification {
+  [[notification object] setDelegate:nil];
+  dispatch_semaphore_signal(done);
+}
+
+- (void)dealloc {
+  dispatch_release(done);
+  [buttons release];
+  [super dealloc];
+}
+@end
+
+// avatarImage returns the picture at path clipped to a circle, the app's
+// icon for an app, or the initial of label on a colored circle.
+static NSImage *avatarImage(NSString *path, long color, NSString *label) {
+  NSImage *picture = nil;
+  if ([path hasSuffix:@".app"]) {
+    NSImage *icon = [[NSWorkspace sharedWorkspace] iconForFile:path];
+    [icon setSize:NSMakeSize(avatarSize, avatarSize)];
+    return icon;
+  } else if ([path length] > 0) {
+    picture = [[[NSImage alloc] initWithContentsOfFile:path] autorelease];
+  }
+  NSString *initial = @"?";
+  if ([label length] > 0) {
+    initial = [[label substringWithRange:[label rangeOfComposedCharacterSequenceAtIndex:0]] uppercaseString];
+  }
+  NSColor *fill = [NSColor systemGrayColor];
+  if (color >= 0) {
+    fill = [NSColor colorWithSRGBRed:((color >> 16) & 0xff) / 255.0
+                               green:((color >> 8) & 0xff) / 255.0
+                                blue:(color & 0xff) / 255.0
+                               alpha:1];
+  }
+  return [NSImage imageWithSize:NSMakeSize(avatarSize, avatarSize)
+                        flipped:NO
+                 drawingHandler:^BOOL(NSRect rect) {
+                   NSBezierPath *circle = [NSBezierPath bezierPathWithOvalInRect:rect];
+                   if (picture != nil) {
+                     [circle addClip];
+                     [picture drawInRect:rect];
+                     return YES;
+                   }
+                   [fill setFill];
+                   [circle fill];
+                   NSDictionary *attributes = @{
+                     NSFontAttributeName : [NSFont boldSystemFontOfSize:avatarSize / 2],
+                     NSForegroundColorAttributeName : [NSColor whiteColor],
+                   };
+                   NSSize size = [initial sizeWithAttributes:attributes];
+                   [initial drawAtPoint:NSMakePoint((rect.size.width - size.width) / 2, (rect.size.height - size.height) / 2)
+                         withAttributes:attributes];
+                   return YES;
+                 }];
+}
+
+// addNumberHint shows number at the trailing edge of button, for choosing
+// it with the number key.
+static void addNumberHint(NSButton *button, int number) {
+  NSTextField *hint = [NSTextField labelWithString:[NSString stringWithFormat:@"%d", number]];
+  hint.font = [NSFont monospacedDigitSystemFontOfSize:[NSFont smallSystemFontSize] weight:NSFontWeightRegular];
+  hint.textColor = [NSColor tertiaryLabelColor];
+  hint.translatesAutoresizingMaskIntoConstraints = NO;
+  [button addSubview:hint];
+  [hint.trailingAnchor constraintEqualToAnchor:button.trailingAnchor constant:-10].active = YES;
+  [hint.centerYAnchor constraintEqualToAnchor:button.centerYAnchor].active = YES;
+}
+
+// titleWithDetail returns label with detail on a second line in smaller,
+// secondary text.
+static NSAttributedString *titleWithDetail(NSString *label, NSString *detail) {
+  NSMutableAttributedString *title = [[[NSMutableAttributedString alloc]
+      initWithString:label
+          attributes:@{
+            NSFontAttributeName : [NSFont systemFontOfSize:[NSFont systemFontSize]],
+            NSForegroundColorAttributeName : [NSColor labelColor],
+          }] autorelease];
+  [title appendAttributedString:[[[NSAttributedString alloc]
+                                    initWithString:[@"\n" stringByAppendingString:detail]
+                                        attributes:@{
+                                          NSFontAttributeName : [NSFont systemFontOfSize:[NSFont smallSystemFontSize]],
+                                          NSForegroundColorAttributeName : [NSColor secondaryLabelColor],
+                                        }] autorelease]];
+  return title;
+}
+
+int PickTarget(const char *url, const char **labels, const char **details, const char **images, const long *colors, int n,
+               const char *rememberLabel, const char *cancelLabel, bool *remembered) {
+  PickerController *controller = [[PickerController alloc] init];
+  controller->choice = -1;
+  controller->done = dispatch_semaphore_create(0);
+  controller->buttons = [[NSMutableArray alloc] init];
+  dispatch_semaphore_t done = controller->done;
+  // The arguments stay alive while this waits for the answer.
+  dispatch_async(dispatch_get_main_queue(), ^{
+    @autoreleasepool {
+      PickerPanel *panel = [[PickerPanel alloc] initWithContentRect:NSMakeRect(0, 0, 360, 100)
+                                                  styleMask:NSWindowStyleMaskTitled | NSWindowStyleMaskClosable
+                                                    backing:NSBackingStoreBuffered
+                                                      defer:NO];
+      panel.title = @"Chrome Profile Router";
+      panel.level = NSFloatingWindowLevel;
+      panel.releasedWhenClosed = YES;
+      panel.delegate = controller;
+      panel->picker = controller;
+
+      NSStackView *stack = [[[NSStackView alloc] init] autorelease];
+      stack.orientation = NSUserInterfaceLayoutOrientationVertical;
+      stack.alignment = NSLayoutAttributeLeading;
+      stack.spacing = 6;
+      stack.edgeInsets = NSEdgeInsetsMake(16, 20, 16, 20);
+
+      NSTextField *prompt = [NSTextField wrappingLabelWithString:[NSString stringWithFormat:@"Open %@ in:", [NSString stringWithUTF8String:url]]];
+      prompt.lineBreakMode = NSLineBreakByTruncatingMiddle;
+      prompt.maximumNumberOfLines = 2;
+      [prompt.widthAnchor constraintEqualToConstant:320].active = YES;
+      [stack addArrangedSubview:prompt];
+
+      for (int i = 0; i < n; i++) {
+        NSString *label = [NSString stringWithUTF8String:labels[i]];
+        NSImage *image = avatarImage([NSString stringWithUTF8String:images[i]], colors[i], label);
+        NSButton *button = [NSButton buttonWithTitle:label image:image target:controller action:@selector(choose:)];
+        NSString *detail = [NSString stringWithUTF8String:details[i]];
+        if ([detail length] > 0) {
+          button.attributedTitle = titleWithDetail(label, detail);
+        }
+        button.tag = i;
+        button.bezelStyle = NSBezelStyleRegularSquare;
+        button.imagePosition = NSImageLeft;
+        button.imageHugsTitle = YES;
+        button.alignment = NSTextAlignmentLeft;
+        [button.widthAnchor constraintEqualToConstant:320].active = YES;
+        [button.heightAnchor constraintEqualToConstant:avatarSize + 10].active = YES;
+        if (i == 0) {
+          button.keyEquivalent = @"\r";
+        }
+        if (i < 9) {
+          addNumberHint(button, i + 1);
+        }
+        [stack addArrangedSubview:button];
+        [controller->buttons addObject:button];
+      }
+
+      [stack setCustomSpacing:14 afterView:[stack.arrangedSubviews lastObject]];
+      if (rememberLabel != NULL) {
+        controller->remember = [NSButton checkboxWithTitle:[NSString stringWithUTF8String:rememberLabel] target:nil action:nil];
+        [stack addArrangedSubview:controller->remember];
+        [stack setCustomSpacing:14 afterView:controller->remember];
+      }
+
+      NSButton *cancel = [NSButton buttonWithTitle:[NSString stringWithUTF8String:cancelLabel]
+                                            target:controller
+                                            action:@selector(cancel:)];
+      cancel.keyEquivalent = @"\033";
+      [stack addArrangedSubview:cancel];
+
+      panel.contentView = stack;
+      [panel setContentSize:[stack fittingSize]];
+      [panel center];
+      [NSApp activateIgnoringOtherApps:YES];
+      [panel makeKeyAndOrderFront:nil];
+    }
+  });
+  dispatch_semaphore_wait(done, DISPATCH_TIME_FOREVER);
+  int choice = (int)controller->choice;
+  *remembered = controller->remembered;
+  // Released on the main thread, once windowWillClose: has returned.
+  dispatch_async(dispatch_get_main_queue(), ^{
+    [controller release];
+  });
+  return choice;
+}
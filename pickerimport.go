@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tailscale/hujson"
+)
+
+// Choosy and Browserosaurus don't document their settings formats, so these
+// importers walk the settings document looking for URL → browser mappings by
+// their usual key names instead of relying on an exact schema.
+
+var (
+	mappingPatternKeys  = []string{"pattern", "regex", "regexp", "url", "urlPattern", "host", "hostname", "domain", "match", "value"}
+	mappingBrowserKeys  = []string{"browser", "browserIdentifier", "bundleIdentifier", "bundleId", "bundleID", "application", "app", "browserId", "tileId"}
+	mappingProfileKeys  = []string{"profile", "profileDirectory", "profileName", "profile_directory"}
+	mappingOperatorKeys = []string{"operator", "comparison", "type", "kind", "condition"}
+	mappingChildKeys    = []string{"conditions", "rules", "patterns", "urls", "hosts", "domains"}
+)
+
+// importChoosy imports the rules from Choosy's behaviours/rules property list.
+func importChoosy(path string) (importResult, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return importResult{}, err
+	}
+	data, err := plistToJSON(raw)
+	if err != nil {
+		return importResult{}, err
+	}
+	return importMappings(data)
+}
+
+// importBrowserosaurus imports URL mappings from Browserosaurus' settings
+// file.
+func importBrowserosaurus(path string) (importResult, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return importResult{}, err
+	}
+	data, err := hujson.Standardize(raw)
+	if err != nil {
+		return importResult{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return importMappings(data)
+}
+
+func importMappings(data []byte) (importResult, error) {
+	var res importResult
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return res, fmt.Errorf("parse settings: %w", err)
+	}
+
+	profiles, _ := readChromeProfiles(defaultChromeUserDataDir())
+	found := 0
+	walkMappings(doc, "", func(loc string, patterns []string, browser, profile string) {
+		found++
+		if !isChromeBrowserName(browser) && !strings.Contains(strings.ToLower(browser), "chrome") {
+			res.skip("%s: routes to %q, not Google Chrome", loc, browser)
+			return
+		}
+		if profile == "" {
+			res.skip("%s: %q does not name a Chrome profile", loc, browser)
+			return
+		}
+		dir := profileDirectoryFor(profile, profiles)
+		for _, p := range patterns {
+			res.Rules = append(res.Rules, Rule{Pattern: p, ProfileDirectory: dir})
+		}
+	})
+	if found == 0 {
+		return res, fmt.Errorf("no URL rules found in the settings file")
+	}
+	return res, nil
+}
+
+// walkMappings calls found for every object that maps URL patterns to a
+// browser. Patterns may live on the object itself or on child condition
+// objects that belong to the object's browser.
+func walkMappings(v interface{}, loc string, found func(loc string, patterns []string, browser, profile string)) {
+	switch v := v.(type) {
+	case []interface{}:
+		for i, e := range v {
+			walkMappings(e, fmt.Sprintf("%s[%d]", loc, i), found)
+		}
+	case map[string]interface{}:
+		browser, profile := mappingBrowser(v)
+		if browser != "" {
+			var patterns []string
+			if p := mappingPattern(v); p != "" {
+				patterns = append(patterns, p)
+			}
+			for _, key := range mappingChildKeys {
+				patterns = append(patterns, childPatterns(v[key])...)
+			}
+			if len(patterns) > 0 {
+				if loc == "" {
+					loc = "settings"
+				}
+				found(strings.TrimPrefix(loc, "."), patterns, browser, profile)
+				return
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkMappings(v[k], loc+"."+k, found)
+		}
+	}
+}
+
+func childPatterns(v interface{}) []string {
+	var patterns []string
+	switch v := v.(type) {
+	case string:
+		patterns = append(patterns, mappingValuePattern(v, ""))
+	case []interface{}:
+		for _, e := range v {
+			patterns = append(patterns, childPatterns(e)...)
+		}
+	case map[string]interface{}:
+		if p := mappingPattern(v); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func firstString(m map[string]interface{}, keys []string) (string, string) {
+	for _, k := range keys {
+		if s, ok := m[k].(string); ok && strings.TrimSpace(s) != "" {
+			return k, strings.TrimSpace(s)
+		}
+	}
+	return "", ""
+}
+
+// mappingBrowser returns the browser and, if present, the profile of a
+// mapping object. Browser identifiers like "com.google.Chrome:Profile 1" carry
+// the profile as a suffix.
+func mappingBrowser(m map[string]interface{}) (string, string) {
+	var browser string
+	switch b := m["browser"].(type) {
+	case map[string]interface{}:
+		browser, profile := mappingBrowser(b)
+		if _, p := firstString(m, mappingProfileKeys); p != "" {
+			profile = p
+		}
+		if browser == "" {
+			_, browser = firstString(b, []string{"name", "identifier", "id"})
+		}
+		return browser, profile
+	}
+	_, browser = firstString(m, mappingBrowserKeys)
+	_, profile := firstString(m, mappingProfileKeys)
+	if browser == "" {
+		return "", ""
+	}
+	if profile == "" {
+		if i := strings.IndexAny(browser, ":#"); i > 0 {
+			browser, profile = browser[:i], browser[i+1:]
+		}
+	}
+	return browser, profile
+}
+
+func mappingPattern(m map[string]interface{}) string {
+	key, value := firstString(m, mappingPatternKeys)
+	if value == "" {
+		return ""
+	}
+	_, op := firstString(m, mappingOperatorKeys)
+	return mappingValuePattern(value, strings.ToLower(key+" "+op))
+}
+
+// mappingValuePattern converts a pattern value into a regex, using the key
+// name and comparison operator as hints for how it was meant to match.
+func mappingValuePattern(value, hint string) string {
+	quoted := regexp.QuoteMeta(value)
+	switch {
+	case strings.Contains(hint, "regex"):
+		if _, err := regexp.Compile(value); err == nil {
+			return value
+		}
+		return quoted
+	case strings.Contains(hint, "host") || strings.Contains(hint, "domain"):
+		if strings.Contains(hint, "contain") {
+			return `^[a-z][a-z0-9+.-]*://[^/?#]*` + quoted
+		}
+		return hostPattern(strings.ToLower(value))
+	case strings.Contains(hint, "begin") || strings.Contains(hint, "start") || strings.Contains(hint, "prefix"):
+		return "^" + quoted
+	case strings.Contains(hint, "end") || strings.Contains(hint, "suffix"):
+		return quoted + "$"
+	case strings.Contains(value, "*"):
+		return finickyGlobPattern(value)
+	case !strings.ContainsAny(value, "/:") && strings.Contains(value, "."):
+		// a bare domain
+		return hostPattern(strings.ToLower(value))
+	}
+	return quoted
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+)
+
+// checkProfileSets validates the profile_sets setting, which names lists of
+// profile directories to open links in all at once.
+func checkProfileSets(sets map[string][]string) error {
+	for name, dirs := range sets {
+		if name == "" {
+			return fmt.Errorf("profile_sets: set name is empty")
+		}
+		if len(dirs) == 0 {
+			return fmt.Errorf("profile_sets: set %q has no profiles", name)
+		}
+		if slices.Contains(dirs, "") {
+			return fmt.Errorf("profile_sets: set %q has an empty profile directory", name)
+		}
+	}
+	return nil
+}
+
+// profileSetNames returns the names of the config's profile sets, sorted.
+func (config Config) profileSetNames() []string {
+	names := make([]string, 0, len(config.ProfileSets))
+	for name := range config.ProfileSets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// profileSet returns the profile directories of the set called name, or of
+// every Chrome profile for "".
+func (config Config) profileSet(name string) ([]string, error) {
+	if name != "" {
+		dirs, ok := config.ProfileSets[name]
+		if !ok {
+			return nil, fmt.Errorf("no profile set is named %q", name)
+		}
+		return dirs, nil
+	}
+	profiles, err := readChromeProfiles(defaultChromeUserDataDir())
+	if err != nil {
+		return nil, fmt.Errorf("read Chrome profiles: %w", err)
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("Chrome has no profiles")
+	}
+	dirs := make([]string, len(profiles))
+	for i, p := range profiles {
+		dirs[i] = p.Directory
+	}
+	return dirs, nil
+}
+
+// openInProfiles opens urlStr in each of the profile directories, with the
+// config-wide launch options, so the page can be compared across accounts.
+func openInProfiles(config Config, urlStr string, dirs []string) {
+	for _, dir := range dirs {
+		t := config.profileTarget(dir)
+		targetURL := config.urlForProfile(urlStr, dir)
+		logger.Debugf("Opening in every profile: %s  ->  %s\n", targetURL, t)
+		openURLWithRetries(config, t, targetURL)
+	}
+}
+
+// openSetFromMenu opens the last link in every profile of the set called
+// name, or in every Chrome profile for "".
+func openSetFromMenu(config Config, name string) {
+	links, err := readRecentLinks()
+	if err != nil || len(links) == 0 {
+		logger.Warnf("No recent link to open in every profile: %v", err)
+		return
+	}
+	dirs, err := config.profileSet(name)
+	if err != nil {
+		logger.Errorf("Failed to open %s in every profile: %v", links[0].URL, err)
+		return
+	}
+	openInProfiles(config, links[0].URL, dirs)
+}
+
+// runOpenAll opens a URL in every Chrome profile, or in those of a profile
+// set, from the command line.
+func runOpenAll(args []string, configPath string) int {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, "usage: chrome-profile-router open-all <url> [<profile set>]")
+		return 2
+	}
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	name := ""
+	if len(args) == 2 {
+		name = args[1]
+	}
+	dirs, err := cfg.profileSet(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	req := newRouteRequest(args[0])
+	cfg.transformURL(req)
+	code := 0
+	for _, dir := range dirs {
+		targetURL := cfg.urlForProfile(req.raw, dir)
+		if err := openURL(cfg, cfg.profileTarget(dir), targetURL); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open %s in %q: %v\n", targetURL, dir, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("Opened %s in %q\n", targetURL, dir)
+	}
+	return code
+}
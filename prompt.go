@@ -0,0 +1,191 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Modifier key flags as reported by NSEvent's modifierFlags.
+const (
+	modifierShift   uint = 1 << 17
+	modifierControl uint = 1 << 18
+	modifierOption  uint = 1 << 19
+	modifierCommand uint = 1 << 20
+)
+
+// modifierFlags maps the key names accepted by picker_modifiers to their
+// flags.
+var modifierFlags = map[string]uint{
+	"shift":   modifierShift,
+	"control": modifierControl,
+	"option":  modifierOption,
+	"command": modifierCommand,
+}
+
+var defaultPickerModifiers = []string{"option", "shift"}
+
+// pickerTargets lists the targets offered when a picker modifier key is
+// held: the targets the rules chose, followed by every other Chrome profile.
+// If Chrome's profiles can't be read, the targets used by the config are
+// offered instead.
+func pickerTargets(chosen []launchTarget, config Config) []launchTarget {
+	var targets []launchTarget
+	seen := map[launchTarget]bool{{}: true}
+	add := func(t launchTarget) {
+		if !seen[t] {
+			seen[t] = true
+			targets = append(targets, t)
+		}
+	}
+	for _, t := range chosen {
+		add(t)
+	}
+	if profiles, err := readChromeProfiles(defaultChromeUserDataDir()); err == nil && len(profiles) > 0 {
+		for _, p := range profiles {
+			add(config.profileTarget(p.Directory))
+		}
+		return targets
+	}
+	add(config.profileTarget(config.DefaultProfileDirectory))
+	for _, r := range config.compiledRules {
+		if r.captures != nil {
+			continue
+		}
+		t := launchTarget{browser: r.browser, userDataDir: r.userDataDir, profile: r.profileDirectory, incognito: r.incognito, guest: r.guest, appMode: r.appMode, kiosk: r.kiosk, newWindow: r.newWindow, background: r.background, launchMode: r.launchMode, reuseTab: r.reuseTab, tabGroup: r.tabGroup, windowDisplay: r.windowDisplay, windowBounds: r.windowBounds, container: r.container, space: r.space, appPath: r.appPath, bundleID: r.bundleID}
+		if len(r.askProfiles) == 0 {
+			add(t)
+		}
+		for _, t := range r.askTargets(t) {
+			add(t)
+		}
+	}
+	return targets
+}
+
+// promptForTarget asks which of the targets urlStr should open in, showing
+// each profile with its avatar. It reports false when the user cancels with
+// the button titled cancel. When the user asks to always use the chosen
+// profile for the URL's host, a rule saying so is added to the config.
+func promptForTarget(urlStr string, targets []launchTarget, config Config, cancel string) (launchTarget, bool) {
+	host := config.rememberHost(urlStr)
+	label := ""
+	if host != "" {
+		label = "Always use this profile for " + host
+	}
+	choice, remember := pickTarget(urlStr, pickerItems(targets, config), label, cancel)
+	if choice < 0 {
+		return launchTarget{}, false
+	}
+	if remember {
+		if err := config.rememberChoice(host, targets[choice]); err != nil {
+			logger.Errorf("Failed to remember %s for %s: %v", targets[choice], host, err)
+		} else {
+			logger.Infof("Added a rule sending %s to %s", host, targets[choice])
+		}
+	}
+	return targets[choice], true
+}
+
+// pickerItems describes targets for the picker: labeled as by targetLabels,
+// with the account picture or avatar color of Chrome profiles and their
+// signed-in account below the name, and the icon of apps and other
+// browsers.
+func pickerItems(targets []launchTarget, config Config) []pickerItem {
+	labels := targetLabels(targets, config)
+	profiles := newProfileCache(config)
+	items := make([]pickerItem, len(targets))
+	for i, t := range targets {
+		items[i] = pickerItem{label: labels[i], color: -1}
+		switch {
+		case t.appPath != "":
+			items[i].image = t.appPath
+		case t.bundleID != "":
+			items[i].image = appPathForBundleID(t.bundleID)
+		case t.guest || t.profile == ephemeralProfile:
+		default:
+			if p, ok := profiles.lookup(t); ok {
+				items[i].image, items[i].color = p.Picture, p.Color
+				if p.Email != "" {
+					items[i].label = strings.Replace(items[i].label, p.Label(), p.DisplayName(), 1)
+					items[i].detail = p.Email
+				}
+			} else if t.browser != "" {
+				items[i].image = config.browserAppPath(t.browser)
+			}
+		}
+	}
+	return items
+}
+
+// profileCache reads the profiles of each user data directory once.
+type profileCache struct {
+	config Config
+	known  map[string]map[string]chromeProfile // user data dir -> directory -> profile
+}
+
+func newProfileCache(config Config) *profileCache {
+	return &profileCache{config: config, known: map[string]map[string]chromeProfile{}}
+}
+
+// lookup returns the profile t opens in, if its browser lists it.
+func (c *profileCache) lookup(t launchTarget) (chromeProfile, bool) {
+	dataDir := t.userDataDir
+	if dataDir == "" {
+		dataDir = c.config.browserUserDataDir(t.browser)
+	}
+	if c.known[dataDir] == nil {
+		c.known[dataDir] = map[string]chromeProfile{}
+		if profiles, err := readChromeProfiles(dataDir); err == nil {
+			for _, p := range profiles {
+				c.known[dataDir][p.Directory] = p
+			}
+		}
+	}
+	p, ok := c.known[dataDir][t.profile]
+	return p, ok
+}
+
+// targetLabels describes each target using the browser's profile names where
+// available, falling back to the directory name, and apps by name. Profiles
+// of browsers other than chrome_app_path are labeled with the browser.
+func targetLabels(targets []launchTarget, config Config) []string {
+	profiles := newProfileCache(config)
+	labels := make([]string, len(targets))
+	seen := map[string]bool{}
+	for i, t := range targets {
+		label, detail := t.profile, t.profile
+		if t.opensApp() {
+			label, detail = t.appLabel(), t.appPath+t.bundleID
+		} else if t.container != "" {
+			label, detail = t.container, t.container
+		} else if t.space != "" {
+			label, detail = t.space, t.space
+		} else if t.guest {
+			label = "Guest"
+		} else if t.profile == ephemeralProfile {
+			label = "Ephemeral profile"
+		} else if p, ok := profiles.lookup(t); ok {
+			label = p.Label()
+		}
+		if t.browser != "" && !t.opensApp() {
+			label += " in " + appName(config.browserAppPath(t.browser))
+		}
+		if t.incognito {
+			label += " (Incognito)"
+		}
+		if t.kiosk {
+			label += " (Kiosk)"
+		}
+		if base := filepath.Base(t.userDataDir); t.userDataDir != "" && label == "" {
+			label = base
+		} else if t.userDataDir != "" {
+			label += " in " + base
+		}
+		if seen[label] {
+			label += " (" + detail + ")"
+		}
+		seen[label] = true
+		labels[i] = label
+	}
+	return labels
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRecentLinks is how many routed links are kept without
+// recent_links.
+const defaultRecentLinks = 10
+
+// recentLink is a link the router opened, kept so it can be opened again
+// in another profile when a rule sent it to the wrong one.
+type recentLink struct {
+	URL              string    `json:"url"`
+	ProfileDirectory string    `json:"profile_directory,omitempty"`
+	Label            string    `json:"label"` // where it opened, as the picker names it
+	Time             time.Time `json:"time"`
+}
+
+func (l recentLink) String() string {
+	u := l.URL
+	if len(u) > 60 {
+		u = u[:57] + "..."
+	}
+	return fmt.Sprintf("%s  %s → %s", l.Time.Local().Format("15:04"), u, l.Label)
+}
+
+// recentLinksPath is where the links routed last are kept, newest first.
+func recentLinksPath() string {
+	return filepath.Join(defaultStateDir(), "recent.json")
+}
+
+// recentLinksMu keeps the router's routings from adding to the file at the
+// same time.
+var recentLinksMu sync.Mutex
+
+// readRecentLinks returns the links routed last, newest first.
+func readRecentLinks() ([]recentLink, error) {
+	data, err := os.ReadFile(recentLinksPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var links []recentLink
+	if err := json.Unmarshal(data, &links); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", recentLinksPath(), err)
+	}
+	return links, nil
+}
+
+// saveRecentLink adds the routing of urlStr to t to the recent links,
+// keeping the newest recent_links of them.
+func saveRecentLink(config Config, urlStr string, t launchTarget) error {
+	label := targetLabels([]launchTarget{t}, config)[0]
+	if label == "" {
+		label = appName(config.browserAppPath(t.browser))
+	}
+	recentLinksMu.Lock()
+	defer recentLinksMu.Unlock()
+	// A damaged file is started over.
+	links, _ := readRecentLinks()
+	links = append([]recentLink{{URL: urlStr, ProfileDirectory: t.profile, Label: label, Time: time.Now()}}, links...)
+	links = links[:min(len(links), config.recentLinks)]
+	data, err := json.MarshalIndent(links, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(recentLinksPath(), append(data, '\n'))
+}
+
+// recordRouting adds the routing of urlStr to t to the recent links and
+// the status item's menu.
+func recordRouting(config Config, urlStr string, t launchTarget) {
+	if err := saveRecentLink(config, urlStr, t); err != nil {
+		logger.Warnf("Failed to save recent links: %v", err)
+	}
+	updateMenuBar(config)
+}
+
+// reopenLink opens urlStr again in the Chrome profile dir, with the
+// config-wide launch options.
+func reopenLink(config Config, urlStr, dir string) {
+	t := config.profileTarget(dir)
+	targetURL := config.urlForProfile(urlStr, dir)
+	logger.Debugf("Reopening: %s  ->  %s\n", targetURL, t)
+	openURLWithRetries(config, t, targetURL)
+	recordRouting(config, targetURL, t)
+}
+
+// runReopen lists the recent links, or opens one of them again in another
+// profile, the last one unless a number from the list is given.
+func runReopen(args []string, configPath string) int {
+	if len(args) > 2 {
+		fmt.Fprintln(os.Stderr, "usage: chrome-profile-router reopen [<profile> [<n>]]")
+		return 2
+	}
+	links, err := readRecentLinks()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(args) == 0 {
+		if len(links) == 0 {
+			fmt.Println("No recent links")
+		}
+		for i, l := range links {
+			fmt.Printf("%d) %s\n", i+1, l)
+		}
+		return 0
+	}
+	n := 1
+	if len(args) == 2 {
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+			fmt.Fprintf(os.Stderr, "%q is not a number from the list of recent links\n", args[1])
+			return 2
+		}
+	}
+	if n > len(links) {
+		fmt.Fprintf(os.Stderr, "there are only %d recent links\n", len(links))
+		return 1
+	}
+	profiles, _ := readChromeProfiles(defaultChromeUserDataDir())
+	dir := profileDirectoryFor(args[0], profiles)
+	if len(profiles) > 0 && !slices.ContainsFunc(profiles, func(p chromeProfile) bool { return p.Directory == dir }) {
+		fmt.Fprintf(os.Stderr, "no Chrome profile is named %q\n", args[0])
+		return 1
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	t := cfg.profileTarget(dir)
+	targetURL := cfg.urlForProfile(links[n-1].URL, dir)
+	if err := openURL(cfg, t, targetURL); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open %s: %v\n", targetURL, err)
+		return 1
+	}
+	if err := saveRecentLink(cfg, targetURL, t); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to save recent links: %v\n", err)
+	}
+	// A running router reloads, which brings its menu up to date.
+	notifyRunningInstance(cfg.PidFile)
+	fmt.Printf("Opened %s in %q\n", targetURL, dir)
+	return 0
+}
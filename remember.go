@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/tailscale/hujson"
+	"gopkg.in/yaml.v3"
+)
+
+// rememberHost returns the host "always use this profile" would add a rule
+// for, or "" when the picker can't offer it: for URLs without a host, and
+// when the config doesn't come from a local file it can write to.
+func (config Config) rememberHost(urlStr string) string {
+	if !config.fileEditable() {
+		return ""
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// fileEditable reports whether the config was loaded from a file the
+// router knows how to change, which leaves out plists.
+func (config Config) fileEditable() bool {
+	if config.path == "" || strings.EqualFold(filepath.Ext(config.path), ".plist") {
+		return false
+	}
+	_, err := os.Stat(config.path)
+	return err == nil
+}
+
+// rememberedRule returns the host rule sending host to t, with only the
+// options where t differs from what the config's defaults give its profile.
+func (config Config) rememberedRule(host string, t launchTarget) Rule {
+	def := config.profileTarget(t.profile)
+	r := Rule{
+		MatchType:        MatchTypeHost,
+		Host:             host,
+		Browser:          t.browser,
+		Container:        t.container,
+		Space:            t.space,
+		UserDataDir:      t.userDataDir,
+		Incognito:        t.incognito,
+		Guest:            t.guest,
+		AppMode:          t.appMode,
+		Kiosk:            t.kiosk,
+		WindowDisplay:    t.windowDisplay,
+		WindowBounds:     t.windowBounds,
+		ProfileDirectory: t.profile,
+		AppPath:          t.appPath,
+		BundleID:         t.bundleID,
+	}
+	if t.newWindow != def.newWindow {
+		r.NewWindow = &t.newWindow
+	}
+	if t.background != def.background {
+		r.Background = &t.background
+	}
+	if t.launchMode != def.launchMode {
+		r.LaunchMode = t.launchMode
+		if r.LaunchMode == "" {
+			r.LaunchMode = LaunchModeOpen
+		}
+	}
+	if t.reuseTab != def.reuseTab {
+		r.ReuseTabs = t.reuseTab
+		if r.ReuseTabs == "" {
+			r.ReuseTabs = TabReuseOff
+		}
+	}
+	if t.tabGroup.Title != "" {
+		g := t.tabGroup
+		r.TabGroup = &g
+	}
+	return r
+}
+
+// rememberChoice adds a rule sending host to t at the top of the config
+// file, so it wins over the rules that asked. JSON keeps its comments and
+// formatting; YAML keeps its comments, and TOML is written out anew. A
+// change that leaves the config invalid is undone.
+func (config Config) rememberChoice(host string, t launchTarget) error {
+	path := config.path
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	rule, err := ruleJSON(config.rememberedRule(host, t))
+	if err != nil {
+		return err
+	}
+	var out []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		out, err = prependRuleYAML(raw, rule)
+	case ".toml":
+		out, err = prependRuleDoc(path, raw, rule)
+	default:
+		out, err = prependRuleJSON(raw, rule)
+	}
+	if err != nil {
+		return err
+	}
+	return replaceConfigFile(path, raw, out)
+}
+
+// ruleJSON returns r as JSON on one line, leaving out profile_directory
+// when it is empty.
+func ruleJSON(r Rule) (hujson.Value, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return hujson.Value{}, err
+	}
+	v, err := hujson.Parse(data)
+	if err != nil {
+		return hujson.Value{}, err
+	}
+	obj := v.Value.(*hujson.Object)
+	obj.Members = slices.DeleteFunc(obj.Members, func(m hujson.ObjectMember) bool {
+		return m.Name.Value.(hujson.Literal).String() == "profile_directory" && r.ProfileDirectory == ""
+	})
+	for i := range obj.Members {
+		if i > 0 {
+			obj.Members[i].Name.BeforeExtra = hujson.Extra(" ")
+		}
+		obj.Members[i].Value.BeforeExtra = hujson.Extra(" ")
+	}
+	return v, nil
+}
+
+// hasRules reports whether the config in raw has a list of rules to add
+// to, as opposed to none at all.
+func hasRules(path string, raw []byte) (bool, error) {
+	// Standardizing JSON rewrites it in place.
+	data, err := configToJSON(path, bytes.Clone(raw))
+	if err != nil {
+		return false, err
+	}
+	doc, err := decodeConfigDoc(data)
+	if err != nil {
+		return false, fmt.Errorf("parse config JSON: %w", err)
+	}
+	_, ok := doc["rules"].([]interface{})
+	return ok, nil
+}
+
+func prependRuleJSON(raw []byte, rule hujson.Value) ([]byte, error) {
+	ok, err := hasRules(".json", raw)
+	if err != nil {
+		return nil, err
+	}
+	patch := `[{"op": "add", "path": "/rules/0", "value": ` + string(rule.Pack()) + `}]`
+	if !ok {
+		patch = `[{"op": "add", "path": "/rules", "value": [` + string(rule.Pack()) + `]}]`
+	}
+	v, err := hujson.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse config JSON: %w", err)
+	}
+	if err := v.Patch([]byte(patch)); err != nil {
+		return nil, fmt.Errorf("add rule: %w", err)
+	}
+	// The rule goes on a line of its own, indented like the one after it.
+	// Without other rules to follow, the whole config is formatted.
+	if rules, ok := v.Find("/rules").Value.(*hujson.Array); ok && len(rules.Elements) > 1 {
+		rules.Elements[0].BeforeExtra = rules.Elements[1].BeforeExtra
+	} else {
+		v.Format()
+	}
+	return v.Pack(), nil
+}
+
+func prependRuleYAML(raw []byte, rule hujson.Value) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("parse config YAML: %w", err)
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return prependRuleDoc(".yaml", raw, rule)
+	}
+	// JSON is YAML written in flow style; the keys keep their order.
+	var ruleDoc yaml.Node
+	if err := yaml.Unmarshal(rule.Pack(), &ruleDoc); err != nil {
+		return nil, err
+	}
+	ruleNode := ruleDoc.Content[0]
+	blockStyle(ruleNode)
+	doc := root.Content[0]
+	added := false
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "rules" && doc.Content[i+1].Kind == yaml.SequenceNode {
+			rules := doc.Content[i+1]
+			rules.Content = append([]*yaml.Node{ruleNode}, rules.Content...)
+			added = true
+		}
+	}
+	if !added {
+		doc.Content = append(doc.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: "rules"},
+			&yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{ruleNode}})
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// blockStyle sets n and everything in it to YAML's block style.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// prependRuleDoc adds rule by decoding and encoding the whole config, which
+// loses its comments.
+func prependRuleDoc(path string, raw []byte, rule hujson.Value) ([]byte, error) {
+	data, err := configToJSON(path, raw)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeConfigDoc(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse config JSON: %w", err)
+	}
+	ruleMap, err := decodeConfigDoc(rule.Pack())
+	if err != nil {
+		return nil, err
+	}
+	rules, _ := doc["rules"].([]interface{})
+	doc["rules"] = append([]interface{}{ruleMap}, rules...)
+	return encodeConfigDoc(path, doc)
+}
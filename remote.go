@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	remoteConfigTimeout = 30 * time.Second
+	maxRemoteConfigSize = 4 << 20
+)
+
+var remoteConfigClient = &http.Client{Timeout: remoteConfigTimeout}
+
+// remoteConfigMeta records the validators of the cached copy of a remote
+// config so it can be revalidated with a conditional request.
+type remoteConfigMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+func defaultCacheDir() string {
+	if dir := xdgDir("XDG_CACHE_HOME", ".cache"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), appDirName)
+}
+
+// remoteConfigCachePath returns where the remote config at rawURL is cached.
+// The file keeps the extension of the URL path so the cached copy is decoded
+// in the same format as the original.
+func remoteConfigCachePath(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	ext := ".json"
+	if u, err := url.Parse(rawURL); err == nil && path.Ext(u.Path) != "" {
+		ext = strings.ToLower(path.Ext(u.Path))
+	}
+	return filepath.Join(defaultCacheDir(), "remote-"+hex.EncodeToString(sum[:8])+ext)
+}
+
+func remoteConfigMetaPath(cachePath string) string {
+	return strings.TrimSuffix(cachePath, filepath.Ext(cachePath)) + ".meta.json"
+}
+
+func validateHTTPSURL(key, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", key, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%s must be an https URL", key)
+	}
+	return nil
+}
+
+// remoteConfigSource describes where the remote config comes from and how it
+// is authenticated.
+type remoteConfigSource struct {
+	url          string
+	signatureURL string
+	publicKey    ed25519.PublicKey // nil when the config is not signed
+}
+
+// remoteConfigKeys are settings that only the local config may define, so
+// the remote file can't redirect or unpin itself, write to local files, or
+// pick the programs that are run.
+var remoteConfigKeys = []string{
+	"config_url", "config_signature_url", "config_public_key",
+	"pid_file", "log_file",
+	"chrome_app_path", "browsers", "launch_mode",
+}
+
+// unsignedRuleKeys are rule settings that run local programs, so rules with
+// them are only taken from signed remote configs.
+var unsignedRuleKeys = []string{"command", "app_path", "bundle_id"}
+
+func newRemoteConfigSource(rawURL, signatureURL, publicKey string) (*remoteConfigSource, error) {
+	if err := validateHTTPSURL("config_url", rawURL); err != nil {
+		return nil, err
+	}
+	src := &remoteConfigSource{url: rawURL}
+	if publicKey == "" {
+		return src, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("config_public_key must be a base64 encoded %d byte Ed25519 public key", ed25519.PublicKeySize)
+	}
+	src.publicKey = key
+	src.signatureURL = signatureURL
+	if src.signatureURL == "" {
+		src.signatureURL = rawURL + ".sig"
+	}
+	if err := validateHTTPSURL("config_signature_url", src.signatureURL); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// verify checks the detached signature of data. Signatures may be raw 64 byte
+// files or base64 text.
+func (src *remoteConfigSource) verify(data, sig []byte) error {
+	if src.publicKey == nil {
+		return nil
+	}
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil {
+			return fmt.Errorf("decode signature: %w", err)
+		}
+		sig = decoded
+	}
+	if !ed25519.Verify(src.publicKey, data, sig) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
+
+// applyRemoteConfig merges the cached copy of the remote config named by
+// config_url underneath the local config: local rules are evaluated first and
+// local settings win over remote ones. Nothing is fetched here; a missing
+// cache, or one whose signature doesn't verify, leaves the local config as is,
+// the latter with a warning saying the remote rules were left out.
+func applyRemoteConfig(data []byte) ([]byte, []string, error) {
+	doc, err := decodeConfigDoc(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse config JSON: %w", err)
+	}
+	rawURL, _ := doc["config_url"].(string)
+	if rawURL == "" {
+		return data, nil, nil
+	}
+	signatureURL, _ := doc["config_signature_url"].(string)
+	publicKey, _ := doc["config_public_key"].(string)
+	src, err := newRemoteConfigSource(rawURL, signatureURL, publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cachePath := remoteConfigCachePath(rawURL)
+	raw, err := os.ReadFile(cachePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return data, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("remote config %s: read cache: %w", rawURL, err)
+	}
+	if src.publicKey != nil {
+		sig, err := os.ReadFile(cachePath + ".sig")
+		if err == nil {
+			err = src.verify(raw, sig)
+		}
+		if err != nil {
+			return data, []string{fmt.Sprintf("remote config %s left out, its signature doesn't verify: %v", rawURL, err)}, nil
+		}
+	}
+	remoteData, err := configToJSON(cachePath, raw)
+	if err == nil {
+		remoteData, err = migrateConfigJSON(remoteData)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("remote config %s: %w", rawURL, err)
+	}
+	remote, err := decodeConfigDoc(remoteData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("remote config %s: parse config JSON: %w", rawURL, err)
+	}
+	for _, k := range remoteConfigKeys {
+		delete(remote, k)
+	}
+	var warnings []string
+	if src.publicKey == nil {
+		if n := dropRulesWith(remote, unsignedRuleKeys); n > 0 {
+			warnings = append(warnings, fmt.Sprintf("remote config %s: left out %d rules that run a command or open an app, only signed remote configs may", rawURL, n))
+		}
+	}
+	mergeConfigDoc(remote, doc, true)
+
+	data, err = json.Marshal(remote)
+	return data, warnings, err
+}
+
+// dropRulesWith removes the rules of doc and of its rule sets that set any
+// of keys, since whoever can change an unsigned remote file could otherwise
+// run programs on every Mac using it. It returns how many were removed.
+func dropRulesWith(doc map[string]any, keys []string) int {
+	n := 0
+	drop := func(container map[string]any) {
+		list, _ := container["rules"].([]any)
+		if list == nil {
+			return
+		}
+		kept := list[:0]
+		for _, r := range list {
+			if rule, ok := r.(map[string]any); ok && slices.ContainsFunc(keys, func(k string) bool { return rule[k] != nil }) {
+				n++
+				continue
+			}
+			kept = append(kept, r)
+		}
+		container["rules"] = kept
+	}
+	drop(doc)
+	sets, _ := doc["rule_sets"].(map[string]any)
+	for _, set := range sets {
+		if set, ok := set.(map[string]any); ok {
+			drop(set)
+		}
+	}
+	return n
+}
+
+// fetchRemoteConfig downloads the remote config into the local cache,
+// revalidating the cached copy with ETag/Last-Modified. Signed configs are
+// only cached once their signature verifies. It reports whether the cached
+// copy changed.
+func fetchRemoteConfig(ctx context.Context, src *remoteConfigSource) (bool, error) {
+	rawURL := src.url
+	cachePath := remoteConfigCachePath(rawURL)
+	metaPath := remoteConfigMetaPath(cachePath)
+
+	var meta remoteConfigMeta
+	if data, err := os.ReadFile(metaPath); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+	// Only revalidate a cached copy that is still usable, e.g. not one signed
+	// with a key that has since been rotated.
+	cached, cacheErr := os.ReadFile(cachePath)
+	cachedSig, sigErr := os.ReadFile(cachePath + ".sig")
+	if cacheErr != nil || meta.URL != rawURL || (src.publicKey != nil && (sigErr != nil || src.verify(cached, cachedSig) != nil)) {
+		meta = remoteConfigMeta{}
+	}
+
+	header := http.Header{}
+	if meta.ETag != "" {
+		header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		header.Set("If-Modified-Since", meta.LastModified)
+	}
+	resp, body, err := httpGet(ctx, rawURL, header)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+
+	var sig []byte
+	if src.publicKey != nil {
+		if _, sig, err = httpGet(ctx, src.signatureURL, nil); err != nil {
+			return false, fmt.Errorf("fetch signature: %w", err)
+		}
+		if err := src.verify(body, sig); err != nil {
+			return false, err
+		}
+	}
+	// Never replace a good cached copy with something we can't parse.
+	if data, err := configToJSON(cachePath, body); err != nil {
+		return false, err
+	} else if _, err := migrateConfigJSON(data); err != nil {
+		return false, err
+	}
+
+	if err := writeFileAtomic(cachePath, body); err != nil {
+		return false, fmt.Errorf("write cache: %w", err)
+	}
+	if sig != nil {
+		if err := writeFileAtomic(cachePath+".sig", sig); err != nil {
+			return false, fmt.Errorf("write cache signature: %w", err)
+		}
+	}
+	meta = remoteConfigMeta{
+		URL:          rawURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+	metaData, _ := json.MarshalIndent(meta, "", "  ")
+	if err := writeFileAtomic(metaPath, metaData); err != nil {
+		return false, fmt.Errorf("write cache metadata: %w", err)
+	}
+	return true, nil
+}
+
+// httpGet performs a GET request and returns the response together with its
+// body. Only 200 and 304 responses are considered successful.
+func httpGet(ctx context.Context, rawURL string, header http.Header) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := remoteConfigClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return resp, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unexpected response from %s: %s", rawURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read response: %w", err)
+	}
+	if len(body) > maxRemoteConfigSize {
+		return nil, nil, fmt.Errorf("response from %s exceeds %d bytes", rawURL, maxRemoteConfigSize)
+	}
+	return resp, body, nil
+}
+
+// refreshRemoteConfig fetches the remote config and reloads the config when
+// the cached copy changed. When offline the cached copy keeps being used.
+func refreshRemoteConfig(configPath string, config Config) {
+	src, err := newRemoteConfigSource(config.ConfigURL, config.ConfigSignatureURL, config.ConfigPublicKey)
+	if err != nil {
+		logger.Errorf("Invalid remote config settings: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteConfigTimeout)
+	defer cancel()
+
+	changed, err := fetchRemoteConfig(ctx, src)
+	if err != nil {
+		logger.Warnf("Failed to fetch remote config %s, using cached copy: %v", src.url, err)
+		return
+	}
+	if changed {
+		logger.Infof("Fetched updated remote config from %s", src.url)
+		reloadConfig(configPath)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path so
+// readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplyRemoteConfigLocalOnlyKeys(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	const rawURL = "https://rules.example.com/config.json"
+	remote := `{
+		"config_url": "https://evil.example.com/config.json",
+		"pid_file": "/Users/me/Documents/report.txt",
+		"log_file": "/Users/me/.zshrc",
+		"chrome_app_path": "/tmp/not-chrome.app",
+		"browsers": {"chrome": {"type": "chromium", "app_path": "/tmp/not-chrome.app"}},
+		"launch_mode": "exec",
+		"log_level": "debug",
+		"rules": [
+			{"match_type": "host", "host": "remote.example.com", "profile_directory": "Profile 2"},
+			{"match_type": "host", "host": "a.example.com", "command": ["/bin/sh", "-c", "true"]},
+			{"match_type": "host", "host": "b.example.com", "app_path": "/tmp/evil.app"},
+			{"match_type": "host", "host": "c.example.com", "bundle_id": "com.example.evil"}
+		],
+		"rule_sets": {"work": {"rules": [
+			{"match_type": "host", "host": "d.example.com", "command": ["/bin/true"]}
+		]}}
+	}`
+	cachePath := remoteConfigCachePath(rawURL)
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cachePath, []byte(remote), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	local := `{
+		"config_url": "` + rawURL + `",
+		"pid_file": "/tmp/router.pid",
+		"rules": [{"match_type": "host", "host": "local.example.com", "profile_directory": "Default"}]
+	}`
+	data, warnings, err := applyRemoteConfig([]byte(local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %q, want one about the left out rules", warnings)
+	}
+	var got struct {
+		ConfigURL     string                      `json:"config_url"`
+		PidFile       string                      `json:"pid_file"`
+		LogFile       *string                     `json:"log_file"`
+		ChromeAppPath *string                     `json:"chrome_app_path"`
+		Browsers      map[string]any              `json:"browsers"`
+		LaunchMode    *string                     `json:"launch_mode"`
+		LogLevel      string                      `json:"log_level"`
+		Rules         []map[string]any            `json:"rules"`
+		RuleSets      map[string]map[string][]any `json:"rule_sets"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ConfigURL != rawURL {
+		t.Errorf("config_url = %q, want the local %q", got.ConfigURL, rawURL)
+	}
+	if got.PidFile != "/tmp/router.pid" {
+		t.Errorf("pid_file = %q, want the local /tmp/router.pid", got.PidFile)
+	}
+	if got.LogFile != nil || got.ChromeAppPath != nil || got.Browsers != nil || got.LaunchMode != nil {
+		t.Errorf("local-only settings taken from the remote config: %s", data)
+	}
+	if got.LogLevel != "debug" {
+		t.Errorf("log_level = %q, want the remote debug", got.LogLevel)
+	}
+	var hosts []any
+	for _, r := range got.Rules {
+		hosts = append(hosts, r["host"])
+	}
+	if want := []any{"local.example.com", "remote.example.com"}; !reflect.DeepEqual(hosts, want) {
+		t.Errorf("rule hosts = %v, want %v", hosts, want)
+	}
+	if n := len(got.RuleSets["work"]["rules"]); n != 0 {
+		t.Errorf("rule set kept %d rules with a command", n)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const defaultCommandTimeout = 5 * time.Second
+
+// profileResolver picks the profile for a URL at routing time, returning ""
+// to leave it to later rules.
+type profileResolver interface {
+	profile(req *routeRequest) string
+}
+
+// resolvesProfile reports whether r leaves the profile to a script or
+// command rather than naming it.
+func (r Rule) resolvesProfile() bool {
+	return r.Script != "" || len(r.Command) > 0
+}
+
+// resolverCommand is an external program that reads a URL on stdin and
+// prints the profile directory to open it in.
+type resolverCommand struct {
+	argv    []string
+	timeout time.Duration
+}
+
+// newResolverCommand checks a rule's command and command_timeout. A program
+// given as a path is resolved against the config file's directory; a bare
+// name is looked up in PATH when it runs.
+func newResolverCommand(configPath string, argv []string, timeout string) (*resolverCommand, error) {
+	c := &resolverCommand{argv: append([]string(nil), argv...), timeout: defaultCommandTimeout}
+	if c.argv[0] == "" {
+		return nil, fmt.Errorf("command: program is empty")
+	}
+	if strings.Contains(c.argv[0], "/") {
+		c.argv[0] = resolveConfigRelativePath(configPath, c.argv[0])
+	}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("command_timeout %q is not a positive duration such as \"2s\"", timeout)
+		}
+		c.timeout = d
+	}
+	return c, nil
+}
+
+// profile runs the command for req. The URL is written to its stdin, and the
+// first line of its output is the profile directory; no output leaves the
+// URL to later rules. The context the URL arrived in is passed in
+// environment variables. Failures are logged and treated as no output.
+func (c *resolverCommand) profile(req *routeRequest) string {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.argv[0], c.argv[1:]...)
+	cmd.Stdin = strings.NewReader(req.raw + "\n")
+	cmd.Env = append(os.Environ(),
+		"CHROME_PROFILE_ROUTER_SOURCE_APP="+req.sourceApp,
+		"CHROME_PROFILE_ROUTER_FRONTMOST_APP="+req.frontmostApp,
+	)
+	// Don't wait for children left holding the output open after a kill.
+	cmd.WaitDelay = 100 * time.Millisecond
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		err = fmt.Errorf("timed out after %s", c.timeout)
+	}
+	if err != nil {
+		if logger != nil {
+			logger.Errorf("Command %s failed for %s: %v: %s", c.argv[0], req.raw, err, strings.TrimSpace(stderr.String()))
+		}
+		return ""
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(line)
+}
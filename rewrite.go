@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Rewrite is a regex find/replace applied to URLs before they are routed.
+type Rewrite struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+type compiledRewrite struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+func compileRewrites(rewrites []Rewrite) ([]compiledRewrite, error) {
+	var compiled []compiledRewrite
+	for i, rw := range rewrites {
+		if rw.Pattern == "" {
+			return nil, fmt.Errorf("rewrite %d invalid: pattern is required", i)
+		}
+		re, err := regexp.Compile(rw.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite %d: compile regexp: %w", i, err)
+		}
+		compiled = append(compiled, compiledRewrite{re: re, replace: rw.Replace})
+	}
+	return compiled, nil
+}
+
+// applyRewrites applies rewrites to raw in order, each to the result of the
+// previous one.
+func applyRewrites(raw string, rewrites []compiledRewrite) string {
+	for _, rw := range rewrites {
+		raw = rw.re.ReplaceAllString(raw, rw.replace)
+	}
+	return raw
+}
+
+// transformURL unwraps redirectors around req, expands short links,
+// canonicalizes and normalizes it, and applies the URL rewrites of config,
+// so rules match and Chrome opens the resulting URL.
+func (config Config) transformURL(req *routeRequest) {
+	raw := unwrapURL(req.raw, config.unwrappers)
+	if config.shortLinks != nil {
+		raw = unwrapURL(config.shortLinks.expand(raw), config.unwrappers)
+	}
+	raw = canonicalURL(raw, config.canonicalizers)
+	if config.NormalizeURLs == nil || *config.NormalizeURLs {
+		raw = normalizeURL(raw)
+	}
+	raw = applyRewrites(raw, config.rewrites)
+	if raw != req.raw {
+		if logger != nil {
+			logger.Debugf("Transformed %s to %s", req.raw, raw)
+		}
+		req.setURL(raw)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// runRoute hands URLs to the router app, which opens them as if they were
+// clicked, starting it if it isn't running.
+func runRoute(urls []string, configPath string) int {
+	if _, err := loadConfig(configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	cmd := exec.Command("open", append([]string{"-b", bundleIdentifier}, urls...)...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to hand the URLs to the router: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runTest prints where each URL would open and which rule decides, without
+// opening anything. Conditions on the sending app and modifier keys see
+// none.
+func runTest(urls []string, configPath string) int {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	if cfg.paused {
+		fmt.Println("Routing is paused, links open in Chrome's last used profile")
+	} else if t, ok := cfg.overrideTarget(); ok {
+		fmt.Printf("Override until %s, links open in %s\n", cfg.override.Until.Local().Format("15:04"), targetLabels([]launchTarget{t}, cfg)[0])
+	}
+	for _, raw := range urls {
+		req := newRouteRequest(raw)
+		cfg.transformURL(req)
+		targets, rules, ask := routeTargets(req, cfg)
+		fmt.Println(req.raw)
+		if req.raw != raw {
+			fmt.Printf("  from %s\n", raw)
+		}
+		if ask && len(targets) > 1 {
+			fmt.Println("  asks between:")
+		}
+		labels := targetLabels(targets, cfg)
+		for i := range targets {
+			label := labels[i]
+			if label == "" {
+				label = "Chrome's last used profile"
+			}
+			fmt.Printf("  -> %s (%s)\n", label, ruleReason(cfg, rules[i]))
+		}
+	}
+	return 0
+}
+
+// ruleReason describes the rule at index rule in config.Rules, -1 for none.
+func ruleReason(config Config, rule int) string {
+	if rule < 0 || rule >= len(config.Rules) {
+		return fmt.Sprintf("no rule matched, strategy_for_unknown_urls is %q", config.StrategyForUnknownUrls)
+	}
+	r := config.Rules[rule]
+	if r.Name != "" {
+		return fmt.Sprintf("rule %d, %s", rule, r.Name)
+	}
+	return fmt.Sprintf("rule %d, %s", rule, describeRule(r))
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tailscale/hujson"
+	"gopkg.in/yaml.v3"
+)
+
+// ruleEdit is a rule of the config file the way the rules editor left it.
+// Rules come in their new order; fields the editor didn't change are left
+// as they are in the file.
+type ruleEdit struct {
+	origin  int    // index in the file's rules, -1 for a new host rule
+	match   string // value of the rule's match field
+	profile string // profile_directory, "" to leave it as it is
+	enabled bool
+}
+
+// matchField names the key holding what a rule matches, as shown and edited
+// in the rules editor.
+func (r Rule) matchField() string {
+	switch r.MatchType {
+	case MatchTypeHost, MatchTypeURL:
+		return "host"
+	case MatchTypeSite:
+		return "site"
+	case MatchTypeCIDR:
+		return "cidr"
+	}
+	return "pattern"
+}
+
+// readFileRules returns the rules of the config file itself, without those
+// of its conf.d fragments, rule sets, or remote config.
+func readFileRules(path string, raw []byte) ([]Rule, error) {
+	// Standardizing JSON rewrites it in place.
+	data, err := configToJSON(path, bytes.Clone(raw))
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Rules []Rule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse config JSON: %w", err)
+	}
+	return doc.Rules, nil
+}
+
+// ruleKey is a key of a rule and the value to set it to.
+type ruleKey struct {
+	name  string
+	value interface{}
+}
+
+// ruleChanges returns the keys to set in r for e, and those to remove.
+func ruleChanges(e ruleEdit, r Rule) ([]ruleKey, []string) {
+	var set []ruleKey
+	var remove []string
+	if e.match != r.matchValue() {
+		set = append(set, ruleKey{r.matchField(), e.match})
+	}
+	if e.profile != "" && e.profile != r.ProfileDirectory {
+		set = append(set, ruleKey{"profile_directory", e.profile})
+	}
+	if e.enabled != r.enabled() {
+		if e.enabled {
+			remove = append(remove, "enabled")
+		} else {
+			set = append(set, ruleKey{"enabled", false})
+		}
+	}
+	return set, remove
+}
+
+// matchValue returns the value of the rule's match field.
+func (r Rule) matchValue() string {
+	switch r.matchField() {
+	case "host":
+		return r.Host
+	case "site":
+		return r.Site
+	case "cidr":
+		return r.CIDR
+	}
+	return r.Pattern
+}
+
+// newEditedRule returns the host rule the editor added for e.
+func newEditedRule(e ruleEdit) Rule {
+	r := Rule{MatchType: MatchTypeHost, Host: e.match, ProfileDirectory: e.profile}
+	if !e.enabled {
+		r.Enabled = &e.enabled
+	}
+	return r
+}
+
+// editRules rewrites the rules of the config file at path as edited. JSON
+// keeps its comments and formatting, YAML its comments, and TOML is written
+// out anew. A change that leaves the config invalid is undone.
+func editRules(path string, edits []ruleEdit) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	rules, err := readFileRules(path, raw)
+	if err != nil {
+		return err
+	}
+	for _, e := range edits {
+		if e.origin >= len(rules) {
+			return fmt.Errorf("the config's rules changed while they were being edited")
+		}
+	}
+	var out []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		out, err = editRulesYAML(raw, rules, edits)
+	case ".toml":
+		out, err = editRulesDoc(path, raw, rules, edits)
+	default:
+		out, err = editRulesJSON(raw, rules, edits)
+	}
+	if err != nil {
+		return err
+	}
+	return replaceConfigFile(path, raw, out)
+}
+
+// replaceConfigFile writes out over the config file at path, whose contents
+// were raw, putting raw back if out doesn't load.
+func replaceConfigFile(path string, raw, out []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, out, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	if _, err := loadConfig(path); err != nil {
+		os.WriteFile(path, raw, info.Mode().Perm())
+		return fmt.Errorf("the change would break the config, so it was undone: %w", err)
+	}
+	return nil
+}
+
+func editRulesJSON(raw []byte, rules []Rule, edits []ruleEdit) ([]byte, error) {
+	ok, err := hasRules(".json", raw)
+	if err != nil {
+		return nil, err
+	}
+	v, err := hujson.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse config JSON: %w", err)
+	}
+	if !ok {
+		if err := v.Patch([]byte(`[{"op": "add", "path": "/rules", "value": []}]`)); err != nil {
+			return nil, fmt.Errorf("add rules: %w", err)
+		}
+	}
+	arr := v.Find("/rules").Value.(*hujson.Array)
+	// New rules go on a line of their own, indented like the first rule,
+	// without the comments above it.
+	var sep hujson.Extra
+	if len(arr.Elements) > 0 {
+		sep = arr.Elements[0].BeforeExtra
+		if i := bytes.LastIndexByte(sep, '\n'); i >= 0 {
+			sep = append(hujson.Extra("\n"), sep[i+1:]...)
+		}
+	}
+	// Whether the list ends in a comma stays as it was.
+	var last hujson.Extra
+	if len(arr.Elements) > 0 {
+		last = arr.Elements[len(arr.Elements)-1].AfterExtra
+	}
+	elements := make([]hujson.Value, len(edits))
+	for i, e := range edits {
+		if e.origin < 0 {
+			if elements[i], err = ruleJSON(newEditedRule(e)); err != nil {
+				return nil, err
+			}
+			elements[i].BeforeExtra = sep
+			continue
+		}
+		elements[i] = arr.Elements[e.origin]
+		obj, ok := elements[i].Value.(*hujson.Object)
+		if !ok {
+			return nil, fmt.Errorf("rule %d is not an object", e.origin+1)
+		}
+		set, remove := ruleChanges(e, rules[e.origin])
+		for _, name := range remove {
+			removeJSONMember(obj, name)
+		}
+		for _, k := range set {
+			if err := setJSONMember(obj, k.name, k.value); err != nil {
+				return nil, err
+			}
+		}
+		elements[i].AfterExtra = nil
+	}
+	if len(elements) > 0 {
+		elements[len(elements)-1].AfterExtra = last
+	}
+	arr.Elements = elements
+	if sep == nil {
+		v.Format()
+	}
+	return v.Pack(), nil
+}
+
+// setJSONMember sets the member name of obj to value, keeping the comments
+// and spacing around it, or adds it as the first member.
+func setJSONMember(obj *hujson.Object, name string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	lit, err := hujson.Parse(data)
+	if err != nil {
+		return err
+	}
+	for i, m := range obj.Members {
+		if m.Name.Value.(hujson.Literal).String() == name {
+			obj.Members[i].Value.Value = lit.Value
+			return nil
+		}
+	}
+	m := hujson.ObjectMember{
+		Name:  hujson.Value{Value: hujson.String(name)},
+		Value: hujson.Value{BeforeExtra: hujson.Extra(" "), Value: lit.Value},
+	}
+	if len(obj.Members) > 0 {
+		m.Name.BeforeExtra = obj.Members[0].Name.BeforeExtra
+		if !bytes.Contains(m.Name.BeforeExtra, []byte("\n")) {
+			obj.Members[0].Name.BeforeExtra = hujson.Extra(" ")
+		}
+	}
+	obj.Members = append([]hujson.ObjectMember{m}, obj.Members...)
+	return nil
+}
+
+// removeJSONMember removes the member name from obj, passing the spacing
+// before it on to the next member when it was the first.
+func removeJSONMember(obj *hujson.Object, name string) {
+	for i, m := range obj.Members {
+		if m.Name.Value.(hujson.Literal).String() != name {
+			continue
+		}
+		if i == 0 && len(obj.Members) > 1 {
+			obj.Members[1].Name.BeforeExtra = m.Name.BeforeExtra
+		}
+		obj.Members = append(obj.Members[:i], obj.Members[i+1:]...)
+		return
+	}
+}
+
+func editRulesYAML(raw []byte, rules []Rule, edits []ruleEdit) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("parse config YAML: %w", err)
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return editRulesDoc(".yaml", raw, rules, edits)
+	}
+	doc := root.Content[0]
+	var seq *yaml.Node
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "rules" && doc.Content[i+1].Kind == yaml.SequenceNode {
+			seq = doc.Content[i+1]
+		}
+	}
+	if seq == nil {
+		seq = &yaml.Node{Kind: yaml.SequenceNode}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "rules"}, seq)
+	}
+	nodes := make([]*yaml.Node, len(edits))
+	for i, e := range edits {
+		if e.origin < 0 {
+			rule, err := ruleJSON(newEditedRule(e))
+			if err != nil {
+				return nil, err
+			}
+			var ruleDoc yaml.Node
+			if err := yaml.Unmarshal(rule.Pack(), &ruleDoc); err != nil {
+				return nil, err
+			}
+			nodes[i] = ruleDoc.Content[0]
+			blockStyle(nodes[i])
+			continue
+		}
+		n := seq.Content[e.origin]
+		if n.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("rule %d is not a mapping", e.origin+1)
+		}
+		set, remove := ruleChanges(e, rules[e.origin])
+		for _, key := range remove {
+			for j := 0; j+1 < len(n.Content); j += 2 {
+				if n.Content[j].Value == key {
+					n.Content = append(n.Content[:j], n.Content[j+2:]...)
+					break
+				}
+			}
+		}
+		for _, k := range set {
+			var v yaml.Node
+			if err := v.Encode(k.value); err != nil {
+				return nil, err
+			}
+			found := false
+			for j := 0; j+1 < len(n.Content); j += 2 {
+				if n.Content[j].Value == k.name {
+					v.LineComment = n.Content[j+1].LineComment
+					n.Content[j+1] = &v
+					found = true
+				}
+			}
+			if !found {
+				n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: k.name}, &v)
+			}
+		}
+		nodes[i] = n
+	}
+	seq.Content = nodes
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// editRulesDoc edits the rules by decoding and encoding the whole config,
+// which loses its comments.
+func editRulesDoc(path string, raw []byte, rules []Rule, edits []ruleEdit) ([]byte, error) {
+	data, err := configToJSON(path, raw)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeConfigDoc(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse config JSON: %w", err)
+	}
+	old, _ := doc["rules"].([]interface{})
+	edited := make([]interface{}, len(edits))
+	for i, e := range edits {
+		if e.origin < 0 {
+			rule, err := ruleJSON(newEditedRule(e))
+			if err != nil {
+				return nil, err
+			}
+			if edited[i], err = decodeConfigDoc(rule.Pack()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		m, ok := old[e.origin].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rule %d is not a table", e.origin+1)
+		}
+		set, remove := ruleChanges(e, rules[e.origin])
+		for _, key := range remove {
+			delete(m, key)
+		}
+		for _, k := range set {
+			m[k.name] = k.value
+		}
+		edited[i] = m
+	}
+	doc["rules"] = edited
+	return encodeConfigDoc(path, doc)
+}
@@ -0,0 +1,129 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework Cocoa
+#include <stdlib.h>
+#include "ruleseditor.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"unsafe"
+)
+
+// rulesEditor is what the open rules editor is editing: the config file
+// and the directories of the profiles it offers, in order.
+var rulesEditor struct {
+	mu   sync.Mutex
+	path string
+	dirs []string
+}
+
+// openRulesEditor shows the rules editor for the config's own file. Rules
+// from conf.d, rule sets, and remote config aren't in it.
+func openRulesEditor(config Config) {
+	if !config.fileEditable() {
+		logger.Warnf("Not opening the rules editor: the config isn't a file it can change")
+		return
+	}
+	raw, err := os.ReadFile(config.path)
+	if err != nil {
+		logger.Errorf("Failed to open the rules editor: %v", err)
+		return
+	}
+	rules, err := readFileRules(config.path, raw)
+	if err != nil {
+		logger.Errorf("Failed to open the rules editor: %v", err)
+		return
+	}
+
+	// "" leaves a rule's profile as it is, which for new rules is none.
+	dirs := []string{""}
+	labels := []string{"Not set"}
+	profiles, _ := readChromeProfiles(defaultChromeUserDataDir())
+	for _, p := range profiles {
+		dirs = append(dirs, p.Directory)
+		labels = append(labels, p.Label())
+	}
+	for _, r := range rules {
+		if !slices.Contains(dirs, r.ProfileDirectory) {
+			dirs = append(dirs, r.ProfileDirectory)
+			labels = append(labels, r.ProfileDirectory+" (not found)")
+		}
+	}
+	newProfile := 0
+	if i := slices.Index(dirs, config.DefaultProfileDirectory); i >= 0 {
+		newProfile = i
+	}
+
+	cTypes := make([]*C.char, len(rules)+1)
+	cMatches := make([]*C.char, len(rules)+1)
+	cProfiles := make([]C.int, len(rules)+1)
+	cEnabled := make([]C.bool, len(rules)+1)
+	for i, r := range rules {
+		matchType := string(r.MatchType)
+		if matchType == "" {
+			matchType = string(MatchTypeRegex)
+		}
+		cTypes[i] = C.CString(matchType)
+		defer C.free(unsafe.Pointer(cTypes[i]))
+		cMatches[i] = C.CString(r.matchValue())
+		defer C.free(unsafe.Pointer(cMatches[i]))
+		cProfiles[i] = C.int(slices.Index(dirs, r.ProfileDirectory))
+		cEnabled[i] = C.bool(r.enabled())
+	}
+	cLabels := make([]*C.char, len(labels)+1)
+	for i, l := range labels {
+		cLabels[i] = C.CString(l)
+		defer C.free(unsafe.Pointer(cLabels[i]))
+	}
+	cTitle := C.CString(fmt.Sprintf("Rules in %s, in the order they are tried. Drag a rule to move it; "+
+		"rules from conf.d, rule sets, and remote config aren't shown.", config.path))
+	defer C.free(unsafe.Pointer(cTitle))
+
+	rulesEditor.mu.Lock()
+	rulesEditor.path = config.path
+	rulesEditor.dirs = dirs
+	rulesEditor.mu.Unlock()
+	C.ShowRulesEditor(cTitle, &cTypes[0], &cMatches[0], &cProfiles[0], &cEnabled[0], C.int(len(rules)),
+		&cLabels[0], C.int(len(labels)), C.int(newProfile))
+}
+
+//export SaveRules
+func SaveRules(origins *C.int, matches **C.char, profiles *C.int, enabled *C.bool, n C.int) *C.char {
+	rulesEditor.mu.Lock()
+	defer rulesEditor.mu.Unlock()
+	edits := make([]ruleEdit, n)
+	cOrigins := unsafe.Slice(origins, n)
+	cMatches := unsafe.Slice(matches, n)
+	cProfiles := unsafe.Slice(profiles, n)
+	cEnabled := unsafe.Slice(enabled, n)
+	for i := range edits {
+		edits[i] = ruleEdit{
+			origin:  int(cOrigins[i]),
+			match:   C.GoString(cMatches[i]),
+			enabled: bool(cEnabled[i]),
+		}
+		if p := int(cProfiles[i]); p >= 0 && p < len(rulesEditor.dirs) {
+			edits[i].profile = rulesEditor.dirs[p]
+		}
+	}
+	// The config watcher picks the saved rules up.
+	if err := editRules(rulesEditor.path, edits); err != nil {
+		logger.Errorf("Failed to save the rules: %v", err)
+		return C.CString(err.Error())
+	}
+	logger.Infof("Saved %d rules to %s", len(edits), rulesEditor.path)
+	return nil
+}
+
+//export OpenRulesEditor
+func OpenRulesEditor() {
+	// Reopening the app calls this on the main thread, which the editor
+	// needs free.
+	go openRulesEditor(*currentConfig.Load())
+}
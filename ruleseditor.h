@@ -0,0 +1,16 @@
+#include <stdbool.h>
+
+// SaveRules is called when the rules editor's Save button is pressed, with
+// the n rules in their new order: the index each had, or -1 for new ones,
+// what it matches, its profile as an index into the editor's profiles, and
+// whether it is on. It returns NULL once the rules are saved, or a message
+// saying why they weren't, which the caller frees.
+extern char *SaveRules(int *origins, char **matches, int *profiles, bool *enabled, int n);
+
+// ShowRulesEditor opens a window for editing the n rules of the config file
+// described by title, or brings the open one to the front. Each rule has a
+// match type, what it matches, a profile as an index into the m profile
+// labels, and whether it is on. Rules the editor adds get the profile
+// numbered newProfile.
+void ShowRulesEditor(const char *title, const char **types, const char **matches, const int *profiles,
+                     const bool *enabled, int n, const char **profileLabels, int m, int newProfile);
@@ -0,0 +1,267 @@
+#import <Cocoa/Cocoa.h>
+#include "ruleseditor.h"
+
+static NSPasteboardType const ruleRowType = @"com.github.david-zw-liu.chrome-profile-router.rule";
+
+// RulesEditor keeps the rules being edited as dictionaries with the keys
+// origin, type, match, profile, and enabled, displayed in a table of the
+// same columns.
+@interface RulesEditor : NSObject <NSTableViewDataSource, NSTableViewDelegate, NSWindowDelegate> {
+ @public
+  NSWindow *window;
+  NSTableView *table;
+  NSMutableArray<NSMutableDictionary *> *rows;
+  NSInteger newProfile;
+}
+@end
+
+// editor is the open rules editor, if any.
+static RulesEditor *editor;
+
+@implementation RulesEditor
+- (NSInteger)numberOfRowsInTableView:(NSTableView *)tableView {
+  return [rows count];
+}
+
+- (id)tableView:(NSTableView *)tableView objectValueForTableColumn:(NSTableColumn *)column row:(NSInteger)row {
+  return rows[row][[column identifier]];
+}
+
+- (void)tableView:(NSTableView *)tableView setObjectValue:(id)value forTableColumn:(NSTableColumn *)column row:(NSInteger)row {
+  rows[row][[column identifier]] = value != nil ? value : @"";
+}
+
+- (id<NSPasteboardWriting>)tableView:(NSTableView *)tableView pasteboardWriterForRow:(NSInteger)row {
+  NSPasteboardItem *item = [[[NSPasteboardItem alloc] init] autorelease];
+  [item setString:[NSString stringWithFormat:@"%ld", (long)row] forType:ruleRowType];
+  return item;
+}
+
+- (NSDragOperation)tableView:(NSTableView *)tableView
+                validateDrop:(id<NSDraggingInfo>)info
+                 proposedRow:(NSInteger)row
+       proposedDropOperation:(NSTableViewDropOperation)operation {
+  [tableView setDropRow:row dropOperation:NSTableViewDropAbove];
+  return NSDragOperationMove;
+}
+
+- (BOOL)tableView:(NSTableView *)tableView
+       acceptDrop:(id<NSDraggingInfo>)info
+              row:(NSInteger)row
+    dropOperation:(NSTableViewDropOperation)operation {
+  NSInteger from = [[[info draggingPasteboard] stringForType:ruleRowType] integerValue];
+  if (from < 0 || from >= (NSInteger)[rows count]) {
+    return NO;
+  }
+  NSMutableDictionary *moved = [[rows[from] retain] autorelease];
+  [rows removeObjectAtIndex:from];
+  if (from < row) {
+    row--;
+  }
+  [rows insertObject:moved atIndex:row];
+  [tableView reloadData];
+  [tableView selectRowIndexes:[NSIndexSet indexSetWithIndex:row] byExtendingSelection:NO];
+  return YES;
+}
+
+- (void)addRule:(id)sender {
+  [rows addObject:[NSMutableDictionary dictionaryWithDictionary:@{
+          @"origin" : @(-1),
+          @"type" : @"host",
+          @"match" : @"",
+          @"profile" : @(newProfile),
+          @"enabled" : @YES,
+        }]];
+  [table reloadData];
+  NSInteger row = [rows count] - 1;
+  [table selectRowIndexes:[NSIndexSet indexSetWithIndex:row] byExtendingSelection:NO];
+  [table editColumn:[table columnWithIdentifier:@"match"] row:row withEvent:nil select:YES];
+}
+
+- (void)removeRule:(id)sender {
+  NSInteger row = [table selectedRow];
+  if (row < 0) {
+    return;
+  }
+  [window makeFirstResponder:nil];
+  [rows removeObjectAtIndex:row];
+  [table reloadData];
+}
+
+- (void)save:(id)sender {
+  // Ending editing keeps what is being typed.
+  [window makeFirstResponder:nil];
+  int n = (int)[rows count];
+  int *origins = calloc(n + 1, sizeof(int));
+  char **matches = calloc(n + 1, sizeof(char *));
+  int *profiles = calloc(n + 1, sizeof(int));
+  bool *enabled = calloc(n + 1, sizeof(bool));
+  for (int i = 0; i < n; i++) {
+    origins[i] = [rows[i][@"origin"] intValue];
+    matches[i] = (char *)[rows[i][@"match"] UTF8String];
+    profiles[i] = [rows[i][@"profile"] intValue];
+    enabled[i] = [rows[i][@"enabled"] boolValue];
+  }
+  char *failure = SaveRules(origins, matches, profiles, enabled, n);
+  free(origins);
+  free(matches);
+  free(profiles);
+  free(enabled);
+  if (failure == NULL) {
+    [window close];
+    return;
+  }
+  NSAlert *alert = [[[NSAlert alloc] init] autorelease];
+  alert.alertStyle = NSAlertStyleWarning;
+  alert.messageText = @"Couldn't save the rules";
+  alert.informativeText = [NSString stringWithUTF8String:failure];
+  free(failure);
+  [alert beginSheetModalForWindow:window completionHandler:nil];
+}
+
+- (void)cancel:(id)sender {
+  [window close];
+}
+
+- (void)windowWillClose:(NSNotification *)notification {
+  [window setDelegate:nil];
+  editor = nil;
+  [self autorelease];
+}
+
+- (void)dealloc {
+  [table setDataSource:nil];
+  [window release];
+  [rows release];
+  [super dealloc];
+}
+@end
+
+static NSTableColumn *column(NSString *identifier, NSString *title, CGFloat width, NSCell *cell) {
+  NSTableColumn *column = [[[NSTableColumn alloc] initWithIdentifier:identifier] autorelease];
+  column.title = title;
+  column.width = width;
+  column.dataCell = cell;
+  return column;
+}
+
+// installEditMenu gives the app an Edit menu, without which the keys for
+// cutting, copying, and pasting do nothing in the editor's text fields.
+static void installEditMenu(void) {
+  if ([NSApp mainMenu] != nil) {
+    return;
+  }
+  NSMenu *edit = [[[NSMenu alloc] initWithTitle:@"Edit"] autorelease];
+  [edit addItemWithTitle:@"Undo" action:@selector(undo:) keyEquivalent:@"z"];
+  [edit addItemWithTitle:@"Redo" action:@selector(redo:) keyEquivalent:@"Z"];
+  [edit addItem:[NSMenuItem separatorItem]];
+  [edit addItemWithTitle:@"Cut" action:@selector(cut:) keyEquivalent:@"x"];
+  [edit addItemWithTitle:@"Copy" action:@selector(copy:) keyEquivalent:@"c"];
+  [edit addItemWithTitle:@"Paste" action:@selector(paste:) keyEquivalent:@"v"];
+  [edit addItemWithTitle:@"Select All" action:@selector(selectAll:) keyEquivalent:@"a"];
+  NSMenu *main = [[[NSMenu alloc] init] autorelease];
+  [main addItemWithTitle:@"" action:nil keyEquivalent:@""];
+  [main addItemWithTitle:@"Edit" action:nil keyEquivalent:@""].submenu = edit;
+  [NSApp setMainMenu:main];
+}
+
+void ShowRulesEditor(const char *title, const char **types, const char **matches, const int *profiles,
+                     const bool *enabled, int n, const char **profileLabels, int m, int newProfile) {
+  @autoreleasepool {
+    NSString *heading = [NSString stringWithUTF8String:title];
+    NSMutableArray<NSMutableDictionary *> *rows = [NSMutableArray arrayWithCapacity:n];
+    for (int i = 0; i < n; i++) {
+      [rows addObject:[NSMutableDictionary dictionaryWithDictionary:@{
+              @"origin" : @(i),
+              @"type" : [NSString stringWithUTF8String:types[i]],
+              @"match" : [NSString stringWithUTF8String:matches[i]],
+              @"profile" : @(profiles[i]),
+              @"enabled" : @(enabled[i]),
+            }]];
+    }
+    NSMutableArray<NSString *> *labels = [NSMutableArray arrayWithCapacity:m];
+    for (int i = 0; i < m; i++) {
+      [labels addObject:[NSString stringWithUTF8String:profileLabels[i]]];
+    }
+    // The block retains the rows and labels until it has run.
+    dispatch_async(dispatch_get_main_queue(), ^{
+      if (editor != nil) {
+        [NSApp activateIgnoringOtherApps:YES];
+        [editor->window makeKeyAndOrderFront:nil];
+        return;
+      }
+      installEditMenu();
+      editor = [[RulesEditor alloc] init];
+      editor->rows = [rows retain];
+      editor->newProfile = newProfile;
+
+      NSWindow *window = [[NSWindow alloc] initWithContentRect:NSMakeRect(0, 0, 680, 420)
+                                                     styleMask:NSWindowStyleMaskTitled | NSWindowStyleMaskClosable |
+                                                               NSWindowStyleMaskResizable
+                                                       backing:NSBackingStoreBuffered
+                                                         defer:NO];
+      window.title = @"Chrome Profile Router Rules";
+      window.releasedWhenClosed = NO;
+      window.delegate = editor;
+      window.minSize = NSMakeSize(480, 260);
+      editor->window = window;
+
+      NSButtonCell *check = [[[NSButtonCell alloc] init] autorelease];
+      [check setButtonType:NSButtonTypeSwitch];
+      check.title = @"";
+      NSTextFieldCell *type = [[[NSTextFieldCell alloc] init] autorelease];
+      type.editable = NO;
+      type.textColor = [NSColor secondaryLabelColor];
+      NSTextFieldCell *match = [[[NSTextFieldCell alloc] init] autorelease];
+      match.editable = YES;
+      match.lineBreakMode = NSLineBreakByTruncatingTail;
+      NSPopUpButtonCell *profile = [[[NSPopUpButtonCell alloc] initTextCell:@"" pullsDown:NO] autorelease];
+      profile.bordered = NO;
+      [profile addItemsWithTitles:labels];
+
+      NSTableView *table = [[[NSTableView alloc] init] autorelease];
+      [table addTableColumn:column(@"enabled", @"On", 30, check)];
+      [table addTableColumn:column(@"type", @"Type", 60, type)];
+      [table addTableColumn:column(@"match", @"Match", 330, match)];
+      [table addTableColumn:column(@"profile", @"Profile", 220, profile)];
+      [[table tableColumnWithIdentifier:@"type"] setEditable:NO];
+      table.dataSource = editor;
+      table.delegate = editor;
+      table.usesAlternatingRowBackgroundColors = YES;
+      table.columnAutoresizingStyle = NSTableViewLastColumnOnlyAutoresizingStyle;
+      [table registerForDraggedTypes:@[ ruleRowType ]];
+      table.draggingDestinationFeedbackStyle = NSTableViewDraggingDestinationFeedbackStyleGap;
+      editor->table = table;
+
+      NSScrollView *scroll = [[[NSScrollView alloc] init] autorelease];
+      scroll.documentView = table;
+      scroll.hasVerticalScroller = YES;
+      scroll.borderType = NSBezelBorder;
+
+      NSTextField *note = [NSTextField wrappingLabelWithString:heading];
+      NSButton *add = [NSButton buttonWithTitle:@"+" target:editor action:@selector(addRule:)];
+      NSButton *remove = [NSButton buttonWithTitle:@"−" target:editor action:@selector(removeRule:)];
+      NSButton *cancel = [NSButton buttonWithTitle:@"Cancel" target:editor action:@selector(cancel:)];
+      cancel.keyEquivalent = @"\033";
+      NSButton *save = [NSButton buttonWithTitle:@"Save" target:editor action:@selector(save:)];
+      save.keyEquivalent = @"\r";
+
+      NSStackView *buttons = [NSStackView stackViewWithViews:@[ add, remove ]];
+      [buttons addView:cancel inGravity:NSStackViewGravityTrailing];
+      [buttons addView:save inGravity:NSStackViewGravityTrailing];
+      NSStackView *stack = [NSStackView stackViewWithViews:@[ note, scroll, buttons ]];
+      stack.orientation = NSUserInterfaceLayoutOrientationVertical;
+      stack.alignment = NSLayoutAttributeLeading;
+      stack.edgeInsets = NSEdgeInsetsMake(16, 20, 16, 20);
+      [scroll.widthAnchor constraintEqualToAnchor:buttons.widthAnchor].active = YES;
+      [buttons.leadingAnchor constraintEqualToAnchor:stack.leadingAnchor constant:20].active = YES;
+      [buttons.trailingAnchor constraintEqualToAnchor:stack.trailingAnchor constant:-20].active = YES;
+      [scroll setContentHuggingPriority:NSLayoutPriorityDefaultLow forOrientation:NSLayoutConstraintOrientationVertical];
+
+      window.contentView = stack;
+      [window center];
+      [NSApp activateIgnoringOtherApps:YES];
+      [window makeKeyAndOrderFront:nil];
+    });
+  }
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RuleSet is a named set of rules and settings that can be switched at once.
+type RuleSet struct {
+	ChromeAppPath           string                 `json:"chrome_app_path"`
+	DefaultProfileDirectory string                 `json:"default_profile_directory"`
+	StrategyForUnknownUrls  StrategyForUnknownUrls `json:"strategy_for_unknown_urls"`
+	Rules                   []Rule                 `json:"rules"`
+}
+
+// activeRuleSetPath is where `chrome-profile-router use` records the selected
+// rule set. It takes precedence over active_rule_set in the config.
+func activeRuleSetPath() string {
+	return filepath.Join(defaultStateDir(), "active-rule-set")
+}
+
+func readActiveRuleSet() string {
+	data, err := os.ReadFile(activeRuleSetPath())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// applyRuleSet merges the active named rule set over the config. Rules of the
+// set are evaluated before the top-level rules and any other setting in the
+// set overrides the top-level value.
+func applyRuleSet(data []byte) ([]byte, error) {
+	doc, err := decodeConfigDoc(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse config JSON: %w", err)
+	}
+	name := readActiveRuleSet()
+	if name == "" {
+		name, _ = doc["active_rule_set"].(string)
+	}
+	if name == "" {
+		return data, nil
+	}
+
+	sets, _ := doc["rule_sets"].(map[string]interface{})
+	set, ok := sets[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unknown rule set %q", name)
+	}
+	mergeConfigDoc(doc, set, true)
+	doc["active_rule_set"] = name
+
+	return json.Marshal(doc)
+}
+
+func runUse(args []string, clear bool, configPath string) int {
+	if len(args) > 1 || (clear && len(args) != 0) {
+		fmt.Fprintln(os.Stderr, "usage: chrome-profile-router use [<rule set> | --clear]")
+		return 2
+	}
+
+	if len(args) == 0 && !clear {
+		cfg, err := loadConfig(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			return 1
+		}
+		var names []string
+		for name := range cfg.RuleSets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			marker := " "
+			if name == cfg.ActiveRuleSet {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, name)
+		}
+		return 0
+	}
+
+	statePath := activeRuleSetPath()
+	previous, prevErr := os.ReadFile(statePath)
+	if clear {
+		if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "failed to clear rule set: %v\n", err)
+			return 1
+		}
+	} else if err := writeFileAtomic(statePath, []byte(args[0]+"\n")); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to save rule set: %v\n", err)
+		return 1
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		// Don't leave the router pointing at a rule set that doesn't load.
+		if prevErr == nil {
+			writeFileAtomic(statePath, previous)
+		} else {
+			os.Remove(statePath)
+		}
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+
+	notifyRunningInstance(cfg.PidFile)
+	if cfg.ActiveRuleSet == "" {
+		fmt.Println("Using the top-level rules only")
+	} else {
+		fmt.Printf("Using rule set %q\n", cfg.ActiveRuleSet)
+	}
+	return 0
+}
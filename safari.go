@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// openInSafariProfileScript opens a URL in a new window of a Safari profile.
+// Safari has no command-line or scripting interface for profiles, so it
+// picks File > New Window > New <profile> Window through System Events,
+// which needs the Accessibility permission.
+const openInSafariProfileScript = `
+on run argv
+	set appName to item 1 of argv
+	set profileName to item 2 of argv
+	set theURL to item 3 of argv
+	tell application appName to activate
+	tell application "System Events" to tell process appName
+		click menu item ("New " & profileName & " Window") of menu 1 of menu item "New Window" of menu "File" of menu bar 1
+	end tell
+	delay 0.3
+	tell application appName to set URL of front document to theURL
+end run
+`
+
+// Hands a URL to Safari, in a new window of the named profile if one is
+// given. Profiles are opened through Safari's menus, so Safari comes to the
+// front for them even with background.
+// Uses: NSWorkspace like open [-g] -a "Safari" "URL", or osascript for a
+// profile
+func openInSafari(ctx context.Context, safariAppPath, profile, urlStr string, background bool) error {
+	if profile == "" {
+		_, err := openURLInApp(ctx, safariAppPath, "", urlStr, !background)
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "osascript", "-e", openInSafariProfileScript, appName(safariAppPath), profile, urlStr)
+	if err := runLauncher(ctx, cmd); err != nil {
+		return fmt.Errorf("open in Safari profile %q: %w", profile, err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// scriptTimeout bounds how long a routing script may run for one URL.
+const scriptTimeout = time.Second
+
+// routeScript is a Starlark file defining route(url, ctx), which returns the
+// profile directory for the URL, or None to leave it to later rules.
+type routeScript struct {
+	path  string
+	route starlark.Callable
+}
+
+// loadRouteScript runs the Starlark file at path and looks up its route
+// function.
+func loadRouteScript(path string) (*routeScript, error) {
+	thread := &starlark.Thread{Name: path, Print: scriptPrint}
+	globals, err := starlark.ExecFile(thread, path, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("load script: %w", err)
+	}
+	globals.Freeze()
+	route, ok := globals["route"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("load script %s: no route(url, ctx) function", path)
+	}
+	return &routeScript{path: path, route: route}, nil
+}
+
+// profile calls the script's route function for req. Errors are logged and
+// treated as the script not choosing a profile.
+func (s *routeScript) profile(req *routeRequest) string {
+	if req.url == nil {
+		return ""
+	}
+	thread := &starlark.Thread{Name: s.path, Print: scriptPrint}
+	timer := time.AfterFunc(scriptTimeout, func() { thread.Cancel("timed out") })
+	defer timer.Stop()
+	v, err := starlark.Call(thread, s.route, starlark.Tuple{scriptURL(req), scriptContext{req}}, nil)
+	if err != nil {
+		if logger != nil {
+			logger.Errorf("Script %s failed for %s: %v", s.path, req.raw, err)
+		}
+		return ""
+	}
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return ""
+	case starlark.String:
+		return string(v)
+	}
+	if logger != nil {
+		logger.Errorf("Script %s returned %s for %s, want a profile directory or None", s.path, v.Type(), req.raw)
+	}
+	return ""
+}
+
+func scriptPrint(thread *starlark.Thread, msg string) {
+	if logger != nil {
+		logger.Infof("%s: %s", thread.Name, msg)
+	}
+}
+
+// scriptURL exposes the parsed URL of req to scripts.
+func scriptURL(req *routeRequest) *starlarkstruct.Struct {
+	u := req.url
+	return starlarkstruct.FromStringDict(starlark.String("url"), starlark.StringDict{
+		"raw":      starlark.String(req.raw),
+		"scheme":   starlark.String(u.Scheme),
+		"host":     starlark.String(req.host),
+		"port":     starlark.String(u.Port()),
+		"path":     starlark.String(u.Path),
+		"query":    starlark.String(u.RawQuery),
+		"fragment": starlark.String(u.Fragment),
+	})
+}
+
+// scriptContext exposes the context a URL arrived in to scripts. Attributes
+// that need a lookup, such as the Wi-Fi network, are only looked up when the
+// script reads them.
+type scriptContext struct {
+	req *routeRequest
+}
+
+var scriptContextAttrs = []string{"source_app", "frontmost_app", "time", "weekday", "wifi_ssid", "focus_mode", "calendars"}
+
+func (c scriptContext) String() string        { return "ctx" }
+func (c scriptContext) Type() string          { return "ctx" }
+func (c scriptContext) Freeze()               {}
+func (c scriptContext) Truth() starlark.Bool  { return true }
+func (c scriptContext) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable: ctx") }
+func (c scriptContext) AttrNames() []string   { return scriptContextAttrs }
+
+func (c scriptContext) Attr(name string) (starlark.Value, error) {
+	req := c.req
+	switch name {
+	case "source_app":
+		return starlark.String(req.sourceApp), nil
+	case "frontmost_app":
+		return starlark.String(req.frontmostApp), nil
+	case "time":
+		return starlark.String(req.time.Format("15:04")), nil
+	case "weekday":
+		return starlark.String(strings.ToLower(req.time.Weekday().String()[:3])), nil
+	case "wifi_ssid":
+		return optionalString(req.wifiSSID()), nil
+	case "focus_mode":
+		if mode := req.focusMode(); mode != nil {
+			return starlark.String(mode.Name), nil
+		}
+		return starlark.None, nil
+	case "calendars":
+		var calendars []starlark.Value
+		for _, c := range req.eventCalendars() {
+			calendars = append(calendars, starlark.String(c))
+		}
+		return starlark.NewList(calendars), nil
+	}
+	return nil, nil
+}
+
+func optionalString(s string) starlark.Value {
+	if s == "" {
+		return starlark.None
+	}
+	return starlark.String(s)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultShortLinkTimeout = 3 * time.Second
+	maxShortLinkHops        = 5
+)
+
+// defaultShortLinkHosts are the link shorteners expanded by
+// expand_short_links.
+var defaultShortLinkHosts = []string{
+	"t.co", "bit.ly", "lnkd.in", "goo.gl", "tinyurl.com", "ow.ly", "buff.ly",
+	"dlvr.it", "ift.tt", "trib.al", "is.gd", "rebrand.ly", "t.ly", "cutt.ly",
+	"shorturl.at", "spoti.fi", "amzn.to", "youtu.be", "fb.me", "aka.ms",
+}
+
+// ShortLinkSettings turns on expanding links from URL shorteners by
+// following their redirects.
+type ShortLinkSettings struct {
+	Hosts   []string `json:"hosts,omitempty"`
+	Timeout string   `json:"timeout,omitempty"`
+}
+
+type shortLinkExpander struct {
+	hosts   []string
+	timeout time.Duration
+	client  *http.Client
+}
+
+func compileShortLinks(s *ShortLinkSettings) (*shortLinkExpander, error) {
+	if s == nil {
+		return nil, nil
+	}
+	e := &shortLinkExpander{
+		hosts:   append(slices.Clone(defaultShortLinkHosts), lowerAll(s.Hosts)...),
+		timeout: defaultShortLinkTimeout,
+		client: &http.Client{
+			// Redirects are followed one at a time, to stop at the first
+			// host that isn't a shortener.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+	if s.Timeout != "" {
+		d, err := time.ParseDuration(s.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("expand_short_links timeout %q is not a positive duration such as \"2s\"", s.Timeout)
+		}
+		e.timeout = d
+	}
+	return e, nil
+}
+
+func (e *shortLinkExpander) isShortLink(u *url.URL) bool {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	return slices.Contains(e.hosts, strings.TrimPrefix(host, "www."))
+}
+
+// expand follows the redirects of shortened links until they lead off the
+// shorteners, returning where they end up. Only shorteners are contacted, so
+// the destination never sees the request. When a shortener can't be
+// reached, as when offline, the URL as expanded so far is returned.
+func (e *shortLinkExpander) expand(raw string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	for range maxShortLinkHops {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !e.isShortLink(u) {
+			return raw
+		}
+		next, err := e.redirect(ctx, u)
+		if err != nil {
+			if logger != nil {
+				logger.Warnf("Failed to expand short link %s: %v", raw, err)
+			}
+			return raw
+		}
+		if next == "" {
+			return raw
+		}
+		raw = next
+	}
+	return raw
+}
+
+// redirect returns where u redirects to, or "" if it doesn't. Some
+// shorteners refuse HEAD requests, so those are retried with GET.
+func (e *shortLinkExpander) redirect(ctx context.Context, u *url.URL) (string, error) {
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := e.client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		if loc, err := resp.Location(); err == nil {
+			return loc.String(), nil
+		}
+		if resp.StatusCode < 400 {
+			return "", nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// runStatus prints whether the router is running and what currently
+// decides where links open.
+func runStatus(configPath string) int {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	if pid, ok := runningPid(cfg.PidFile); ok {
+		fmt.Printf("Running:   yes, pid %d\n", pid)
+	} else {
+		fmt.Println("Running:   no")
+	}
+	fmt.Printf("Config:    %s\n", cfg.path)
+	fmt.Printf("Log:       %s\n", cfg.LogFile)
+	switch {
+	case cfg.paused:
+		fmt.Println("Routing:   paused, links open in Chrome's last used profile")
+	case cfg.override.active():
+		fmt.Printf("Routing:   every link opens in %q until %s\n", cfg.override.ProfileDirectory, cfg.override.Until.Local().Format("15:04"))
+	default:
+		fmt.Printf("Routing:   by %d rules\n", len(cfg.compiledRules))
+	}
+	if cfg.ActiveRuleSet != "" {
+		fmt.Printf("Rule set:  %s\n", cfg.ActiveRuleSet)
+	}
+	var disabled []string
+	for tag, off := range cfg.disabledTags {
+		if off {
+			disabled = append(disabled, tag)
+		}
+	}
+	if len(disabled) > 0 {
+		slices.Sort(disabled)
+		fmt.Printf("Tags off:  %s\n", strings.Join(disabled, ", "))
+	}
+	return 0
+}
+
+// runLogs prints the last lines of the log file, and with follow keeps
+// printing lines as they are added until interrupted.
+func runLogs(lines int, follow bool, configPath string) int {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	args := []string{"-n", strconv.Itoa(lines)}
+	if follow {
+		args = append(args, "-F")
+	}
+	cmd := exec.Command("tail", append(args, cfg.LogFile)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultPatternsRefreshInterval = 24 * time.Hour
+	patternListCheckInterval       = time.Minute
+	patternListRetryDelay          = 15 * time.Minute
+)
+
+// patternListCachePath returns where the pattern list at rawURL is cached.
+func patternListCachePath(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(defaultCacheDir(), "list-"+hex.EncodeToString(sum[:8])+".txt")
+}
+
+// readCachedPatternList returns the entries of the cached copy of the list at
+// rawURL, or nothing if it hasn't been downloaded yet.
+func readCachedPatternList(rawURL string) []string {
+	data, err := os.ReadFile(patternListCachePath(rawURL))
+	if err != nil {
+		return nil
+	}
+	return parsePatternList(data)
+}
+
+// patternListDue reports whether the list at rawURL hasn't been fetched
+// within interval.
+func patternListDue(rawURL string, interval time.Duration) bool {
+	var meta remoteConfigMeta
+	data, err := os.ReadFile(remoteConfigMetaPath(patternListCachePath(rawURL)))
+	if err != nil || json.Unmarshal(data, &meta) != nil || meta.URL != rawURL {
+		return true
+	}
+	return time.Since(meta.FetchedAt) >= interval
+}
+
+// fetchPatternList downloads the list at rawURL into the cache, revalidating
+// the cached copy with ETag/Last-Modified. It reports whether the cached copy
+// changed.
+func fetchPatternList(ctx context.Context, rawURL string) (bool, error) {
+	cachePath := patternListCachePath(rawURL)
+	metaPath := remoteConfigMetaPath(cachePath)
+
+	var meta remoteConfigMeta
+	if data, err := os.ReadFile(metaPath); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+	if _, err := os.Stat(cachePath); err != nil || meta.URL != rawURL {
+		meta = remoteConfigMeta{}
+	}
+
+	header := http.Header{}
+	if meta.ETag != "" {
+		header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		header.Set("If-Modified-Since", meta.LastModified)
+	}
+	resp, body, err := httpGet(ctx, rawURL, header)
+	if err != nil {
+		return false, err
+	}
+	changed := resp.StatusCode != http.StatusNotModified
+	if changed {
+		if err := writeFileAtomic(cachePath, body); err != nil {
+			return false, fmt.Errorf("write cache: %w", err)
+		}
+		meta = remoteConfigMeta{
+			URL:          rawURL,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		}
+	}
+	meta.FetchedAt = time.Now()
+	metaData, _ := json.MarshalIndent(meta, "", "  ")
+	if err := writeFileAtomic(metaPath, metaData); err != nil {
+		return false, fmt.Errorf("write cache metadata: %w", err)
+	}
+	return changed, nil
+}
+
+// refreshPatternLists keeps the lists subscribed to by patterns_url rules up
+// to date, reloading the config whenever one of them changes. Lists are
+// looked up in the current config on every check, so subscriptions added by
+// a reload are picked up without a restart.
+func refreshPatternLists(configPath string) {
+	failedAt := map[string]time.Time{}
+	for {
+		cfg := currentConfig.Load()
+		changed := false
+		for _, rawURL := range cfg.patternURLs {
+			if !patternListDue(rawURL, cfg.patternsRefreshInterval) || time.Since(failedAt[rawURL]) < patternListRetryDelay {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), remoteConfigTimeout)
+			updated, err := fetchPatternList(ctx, rawURL)
+			cancel()
+			if err != nil {
+				logger.Warnf("Failed to fetch pattern list %s, using cached copy: %v", rawURL, err)
+				failedAt[rawURL] = time.Now()
+				continue
+			}
+			delete(failedAt, rawURL)
+			if updated {
+				logger.Infof("Fetched updated pattern list from %s", rawURL)
+				changed = true
+			}
+		}
+		if changed {
+			reloadConfig(configPath)
+		}
+		time.Sleep(patternListCheckInterval)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// TabGroup is the Chrome tab group a rule's tabs join, found by title in
+// the tab's window and created there when it doesn't exist yet.
+type TabGroup struct {
+	Title string `json:"title"`
+	Color string `json:"color,omitempty"`
+}
+
+// tabGroupColors are the colors Chrome's tab groups come in.
+var tabGroupColors = []string{"grey", "blue", "red", "yellow", "green", "pink", "purple", "cyan", "orange"}
+
+// tabGroup returns the rule's tab group, with no title for none.
+func (r Rule) tabGroup() TabGroup {
+	if r.TabGroup == nil {
+		return TabGroup{}
+	}
+	return *r.TabGroup
+}
+
+func (g TabGroup) validate() error {
+	if g.Title == "" {
+		return fmt.Errorf("tab_group needs a title")
+	}
+	if g.Color != "" && !slices.Contains(tabGroupColors, g.Color) {
+		return fmt.Errorf("tab_group color %q is not one of %v", g.Color, tabGroupColors)
+	}
+	return nil
+}
+
+// The DevTools protocol can't put tabs in groups, so a small extension the
+// router loads into Chrome does it: opening its group page with a URL,
+// title, and color groups the newest tab showing the URL and closes the
+// page. The key in its manifest fixes its ID.
+const (
+	tabGroupExtensionID = "efdokghmmbodphodhigoekjcakcmhdeg"
+
+	// tabGroupTimeout bounds how long the group page gets to close itself
+	// before it is taken to mean the extension isn't loaded.
+	tabGroupTimeout = 2 * time.Second
+)
+
+var tabGroupExtension = map[string]string{
+	"manifest.json": `{
+  "manifest_version": 3,
+  "name": "Chrome Profile Router Tab Groups",
+  "description": "Puts the tabs Chrome Profile Router opens into tab groups.",
+  "version": "1.0",
+  "key": "MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAnZDxWEsGzddGUqm789Ok60X4p312JANTYikrSOea7uwV0SfQvXbaeTTwFn7za0nX3gks1mI10eS+O2Wm4ok7ayx7r/RZW/q2XtBxjdQ4t5ENnDtu0fwA2zZuaEsQtrPhPEZJRTo0aPk2DXUTnYyierDa1x44EQmc180KrUcJ/gycVa1CphK3n5dsltEdXTY9auxV5LveVJUamsRE234JfcgvtKBiIltKi1uAuTCc9NltCYY1FFhePZT5fOkivudjauVX1EM+Xmexo9cN8Bcy1DWFq6Ym7IutNuhSk5fultG2xudIm2XLH5904ORBTh92Dxyk6ZTQCw/N6MnnrolhxQIDAQAB",
+  "permissions": ["tabs", "tabGroups"]
+}
+`,
+	"group.html": `<!doctype html>
+<script src="group.js"></script>
+`,
+	"group.js": `const params = new URLSearchParams(location.search);
+const trim = (u) => (u || "").replace(/\/$/, "");
+
+async function group() {
+  const url = trim(params.get("url"));
+  const title = params.get("title");
+  const color = params.get("color");
+  const tabs = (await chrome.tabs.query({})).filter((t) => trim(t.url) === url || trim(t.pendingUrl) === url);
+  if (tabs.length === 0) {
+    return;
+  }
+  const tab = tabs.reduce((a, b) => (b.id > a.id ? b : a));
+  const [existing] = await chrome.tabGroups.query({ title, windowId: tab.windowId });
+  if (existing) {
+    await chrome.tabs.group({ groupId: existing.id, tabIds: [tab.id] });
+    if (color && existing.color !== color) {
+      await chrome.tabGroups.update(existing.id, { color });
+    }
+    return;
+  }
+  const groupId = await chrome.tabs.group({ tabIds: [tab.id], createProperties: { windowId: tab.windowId } });
+  await chrome.tabGroups.update(groupId, color ? { title, color } : { title });
+}
+
+group().finally(async () => {
+  const self = await chrome.tabs.getCurrent();
+  chrome.tabs.remove(self.id);
+});
+`,
+}
+
+func tabGroupExtensionDir() string {
+	return filepath.Join(defaultStateDir(), "tab-groups-extension")
+}
+
+// tabGroupFlags writes the tab group extension out and returns the flags
+// that load it into Chrome. Branded Chrome ignores --load-extension from
+// version 137 unless the feature turning it off is disabled.
+func tabGroupFlags() []string {
+	dir := tabGroupExtensionDir()
+	if err := writeTabGroupExtension(dir); err != nil {
+		if logger != nil {
+			logger.Warnf("Failed to write tab group extension to %s: %v", dir, err)
+		}
+		return nil
+	}
+	return []string{"--load-extension=" + dir, "--disable-features=DisableLoadExtensionCommandLineSwitch"}
+}
+
+func writeTabGroupExtension(dir string) error {
+	for name, content := range tabGroupExtension {
+		path := filepath.Join(dir, name)
+		if data, err := os.ReadFile(path); err == nil && bytes.Equal(data, []byte(content)) {
+			continue
+		}
+		if err := writeFileAtomic(path, []byte(content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// joinTabGroup puts the tab showing urlStr in g, logging failures since
+// the URL is open either way.
+func (c *cdpConn) joinTabGroup(contextID, urlStr string, g TabGroup) {
+	if err := c.groupTab(contextID, urlStr, g); err != nil {
+		if logger != nil {
+			logger.Warnf("Failed to put %s in tab group %q: %v", urlStr, g.Title, err)
+		}
+	}
+}
+
+// groupTab puts the tab showing urlStr in the browser context into g by
+// opening the extension's group page next to it.
+func (c *cdpConn) groupTab(contextID, urlStr string, g TabGroup) error {
+	q := url.Values{"url": {urlStr}, "title": {g.Title}}
+	if g.Color != "" {
+		q.Set("color", g.Color)
+	}
+	var result struct {
+		TargetID string `json:"targetId"`
+	}
+	params := map[string]any{
+		"url":              "chrome-extension://" + tabGroupExtensionID + "/group.html?" + q.Encode(),
+		"browserContextId": contextID,
+		"background":       true,
+	}
+	if err := c.call("Target.createTarget", params, &result); err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(tabGroupTimeout); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		targets, err := c.targets()
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(targets, func(t cdpTarget) bool { return t.TargetID == result.TargetID }) {
+			return nil
+		}
+	}
+	c.call("Target.closeTarget", map[string]any{"targetId": result.TargetID}, nil)
+	return fmt.Errorf("the tab group extension isn't loaded in Chrome")
+}
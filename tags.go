@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// tagStatePath is where `chrome-profile-router tags` records tags switched on
+// or off from the command line. Its entries take precedence over
+// disabled_tags in the config.
+func tagStatePath() string {
+	return filepath.Join(defaultStateDir(), "tags.json")
+}
+
+// readTagState returns the tag overrides made with the tags command, mapping
+// each tag to whether it is enabled.
+func readTagState() (map[string]bool, error) {
+	state := map[string]bool{}
+	data, err := os.ReadFile(tagStatePath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read tag state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parse tag state %s: %w", tagStatePath(), err)
+	}
+	return state, nil
+}
+
+// disabledTagSet combines disabled_tags from the config with the overrides
+// made with the tags command.
+func disabledTagSet(configured []string) (map[string]bool, error) {
+	disabled := map[string]bool{}
+	for _, tag := range configured {
+		disabled[tag] = true
+	}
+	state, err := readTagState()
+	if err != nil {
+		return nil, err
+	}
+	for tag, enabled := range state {
+		disabled[tag] = !enabled
+	}
+	return disabled, nil
+}
+
+// ruleEnabled reports whether r takes part in routing: it must not be
+// disabled itself and none of its tags may be disabled.
+func (cfg Config) ruleEnabled(r Rule) bool {
+	if !r.enabled() {
+		return false
+	}
+	for _, tag := range r.Tags {
+		if cfg.disabledTags[tag] {
+			return false
+		}
+	}
+	return true
+}
+
+func runTags(args []string, configPath string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: chrome-profile-router tags [enable <tag>... | disable <tag>... | reset]")
+		return 2
+	}
+
+	if len(args) == 0 {
+		cfg, err := loadConfig(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			return 1
+		}
+		counts := map[string]int{}
+		for _, r := range cfg.Rules {
+			for _, tag := range r.Tags {
+				counts[tag]++
+			}
+		}
+		var tags []string
+		for tag := range counts {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			state := "enabled"
+			if cfg.disabledTags[tag] {
+				state = "disabled"
+			}
+			fmt.Printf("%-8s %s (%d rules)\n", state, tag, counts[tag])
+		}
+		return 0
+	}
+
+	state, err := readTagState()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	switch args[0] {
+	case "enable", "disable":
+		if len(args) < 2 {
+			return usage()
+		}
+		for _, tag := range args[1:] {
+			state[tag] = args[0] == "enable"
+		}
+	case "reset":
+		if len(args) != 1 {
+			return usage()
+		}
+		state = map[string]bool{}
+	default:
+		return usage()
+	}
+
+	if len(state) == 0 {
+		if err := os.Remove(tagStatePath()); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "failed to reset tags: %v\n", err)
+			return 1
+		}
+	} else {
+		data, _ := json.MarshalIndent(state, "", "  ")
+		if err := writeFileAtomic(tagStatePath(), append(data, '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to save tags: %v\n", err)
+			return 1
+		}
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	notifyRunningInstance(cfg.PidFile)
+	return 0
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// maxUnwraps bounds how many wrappers are peeled off one URL, since
+// redirectors sometimes wrap each other.
+const maxUnwraps = 5
+
+// unwrapper recognizes a redirector that hides the real destination of a
+// link, returning that destination or "" for other URLs.
+type unwrapper struct {
+	name   string
+	unwrap func(u *url.URL, host string) string
+}
+
+// unwrappers are the redirectors understood by the unwrap setting, all of
+// which are on unless switched off.
+var unwrappers = []unwrapper{
+	{"safelinks", unwrapSafeLinks},
+	{"proofpoint", unwrapProofpoint},
+	{"google", unwrapGoogle},
+	{"facebook", unwrapFacebook},
+	{"slack", unwrapSlack},
+	{"youtube", unwrapYouTube},
+}
+
+// unwrapSafeLinks decodes Microsoft Defender Safe Links, which Outlook wraps
+// around every link in corporate mail.
+func unwrapSafeLinks(u *url.URL, host string) string {
+	if !strings.HasSuffix(host, ".safelinks.protection.outlook.com") && !strings.HasSuffix(host, ".safelinks.protection.office365.us") {
+		return ""
+	}
+	return u.Query().Get("url")
+}
+
+// unwrapProofpoint decodes Proofpoint URL Defense links in all three of its
+// formats.
+func unwrapProofpoint(u *url.URL, host string) string {
+	if host != "urldefense.proofpoint.com" && host != "urldefense.com" {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(u.Path, "/v1/"):
+		return u.Query().Get("u")
+	case strings.HasPrefix(u.Path, "/v2/"):
+		// Percent signs are sent as "-" and slashes as "_".
+		inner, err := url.QueryUnescape(strings.NewReplacer("-", "%", "_", "/").Replace(u.Query().Get("u")))
+		if err != nil {
+			return ""
+		}
+		return inner
+	case strings.HasPrefix(u.EscapedPath(), "/v3/__"):
+		return decodeProofpointV3(u.String())
+	}
+	return ""
+}
+
+var proofpointV3Re = regexp.MustCompile(`/v3/__(.+?)__;([^!]*)!`)
+
+// proofpointRunLengths maps the character after "**" in a v3 URL to how
+// many replacement characters it stands for.
+var proofpointRunLengths = func() map[byte]int {
+	m := map[byte]int{}
+	for i, c := range []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_") {
+		m[c] = i + 2
+	}
+	return m
+}()
+
+// decodeProofpointV3 decodes a v3 link, which keeps the URL mostly as is but
+// replaces some characters with "*", storing them base64-encoded after the
+// URL. "**" followed by a length character stands for a run of them.
+func decodeProofpointV3(raw string) string {
+	m := proofpointV3Re.FindStringSubmatch(raw)
+	if m == nil {
+		return ""
+	}
+	embedded := m[1]
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(m[2], "="))
+	if err != nil {
+		return ""
+	}
+	replacements := []rune(string(data))
+	var b strings.Builder
+	next := 0
+	for i := 0; i < len(embedded); i++ {
+		if embedded[i] != '*' {
+			b.WriteByte(embedded[i])
+			continue
+		}
+		n := 1
+		if i+2 < len(embedded) && embedded[i+1] == '*' {
+			if n = proofpointRunLengths[embedded[i+2]]; n == 0 {
+				return ""
+			}
+			i += 2
+		}
+		if next+n > len(replacements) {
+			return ""
+		}
+		b.WriteString(string(replacements[next : next+n]))
+		next += n
+	}
+	return b.String()
+}
+
+// unwrapGoogle decodes the redirects Google search results and Gmail send
+// clicks through, such as https://www.google.com/url?q=...
+func unwrapGoogle(u *url.URL, host string) string {
+	site, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil || !strings.HasPrefix(site, "google.") || u.Path != "/url" {
+		return ""
+	}
+	if q := u.Query().Get("q"); q != "" {
+		return q
+	}
+	return u.Query().Get("url")
+}
+
+// unwrapFacebook decodes Facebook's and Messenger's link shims.
+func unwrapFacebook(u *url.URL, host string) string {
+	if (host == "l.facebook.com" || host == "lm.facebook.com" || host == "l.messenger.com") && u.Path == "/l.php" {
+		return u.Query().Get("u")
+	}
+	return ""
+}
+
+// unwrapSlack decodes Slack's redirector for links in messages.
+func unwrapSlack(u *url.URL, host string) string {
+	if host == "slack-redir.net" && u.Path == "/link" {
+		return u.Query().Get("url")
+	}
+	return ""
+}
+
+// unwrapYouTube decodes links in video descriptions.
+func unwrapYouTube(u *url.URL, host string) string {
+	if (host == "www.youtube.com" || host == "youtube.com" || host == "m.youtube.com") && u.Path == "/redirect" {
+		return u.Query().Get("q")
+	}
+	return ""
+}
+
+// compileUnwrappers returns the unwrappers not switched off in settings.
+func compileUnwrappers(settings map[string]bool) ([]unwrapper, error) {
+	known := map[string]bool{}
+	for _, uw := range unwrappers {
+		known[uw.name] = true
+	}
+	for name := range settings {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown unwrap key %q", name)
+		}
+	}
+	var enabled []unwrapper
+	for _, uw := range unwrappers {
+		if on, ok := settings[uw.name]; !ok || on {
+			enabled = append(enabled, uw)
+		}
+	}
+	return enabled, nil
+}
+
+// unwrapURL returns the destination hidden behind redirector wrappers
+// around raw, or raw itself when it isn't wrapped.
+func unwrapURL(raw string, enabled []unwrapper) string {
+	for range maxUnwraps {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return raw
+		}
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+		inner := ""
+		for _, uw := range enabled {
+			if inner = uw.unwrap(u, host); inner != "" {
+				break
+			}
+		}
+		if inner == "" || !isWebURL(inner) {
+			return raw
+		}
+		raw = inner
+	}
+	return raw
+}
+
+func isWebURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestUnwrapURL(t *testing.T) {
+	all, err := compileUnwrappers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noGoogle, err := compileUnwrappers(map[string]bool{"google": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name    string
+		raw     string
+		enabled []unwrapper
+		want    string
+	}{
+		{"safelinks", "https://eur01.safelinks.protection.outlook.com/?url=https%3A%2F%2Fexample.com%2Fa%3Fb%3D1&data=x", all, "https://example.com/a?b=1"},
+		{"proofpoint v2", "https://urldefense.proofpoint.com/v2/url?u=https-3A__example.com_a&d=x", all, "https://example.com/a"},
+		{"proofpoint v3", "https://urldefense.com/v3/__https://example.com/a*b__;Kw!!x$", all, "https://example.com/a+b"},
+		{"google", "https://www.google.co.uk/url?q=https://example.com/&sa=D", all, "https://example.com/"},
+		{"google switched off", "https://www.google.com/url?q=https://example.com/", noGoogle, "https://www.google.com/url?q=https://example.com/"},
+		{"slack", "https://slack-redir.net/link?url=https%3A%2F%2Fexample.com", all, "https://example.com"},
+		{"nested", "https://slack-redir.net/link?url=" + "https%3A%2F%2Fwww.google.com%2Furl%3Fq%3Dhttps%253A%252F%252Fexample.com%252F", all, "https://example.com/"},
+		{"not a web URL", "https://www.google.com/url?q=javascript:alert(1)", all, "https://www.google.com/url?q=javascript:alert(1)"},
+		{"not wrapped", "https://example.com/url?q=https://other.example.com/", all, "https://example.com/url?q=https://other.example.com/"},
+	} {
+		if got := unwrapURL(tt.raw, tt.enabled); got != tt.want {
+			t.Errorf("%s: unwrapURL(%q) = %q, want %q", tt.name, tt.raw, got, tt.want)
+		}
+	}
+
+	if _, err := compileUnwrappers(map[string]bool{"bing": true}); err == nil {
+		t.Error("unknown unwrap key accepted")
+	}
+}
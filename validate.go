@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+//go:embed config.schema.json
+var configSchemaJSON []byte
+
+var ruleLocationRe = regexp.MustCompile(`^/rules/(\d+)(.*)$`)
+
+func compileConfigSchema() (*jsonschema.Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(configSchemaJSON))
+	if err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource("config.schema.json", doc); err != nil {
+		return nil, fmt.Errorf("add schema: %w", err)
+	}
+	return c.Compile("config.schema.json")
+}
+
+// validateConfig checks the config at path, its conf.d fragments, and any
+// managed preferences against the JSON Schema and compiles every rule
+// pattern. It returns one message per problem found, each prefixed with the
+// file name.
+func validateConfig(path string) []string {
+	schema, err := compileConfigSchema()
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	managed := managedConfigPaths()
+	var files []string
+	if _, err := os.Stat(path); err == nil || len(managed) == 0 {
+		files = append(files, path)
+	}
+	fragments, err := configFragmentPaths(confDirPath(path))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	files = append(files, fragments...)
+	files = append(files, managed...)
+
+	var problems []string
+	for _, file := range files {
+		name := filepath.Base(file)
+		if strings.HasPrefix(file, managedPreferenceDir) {
+			name = file
+		}
+		data, err := readConfigFile(file)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		for _, p := range validateConfigDoc(schema, data) {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, p))
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	// Catch anything that only shows up once the files are merged.
+	if _, err := loadConfig(path); err != nil {
+		problems = append(problems, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+	}
+	return problems
+}
+
+func validateConfigDoc(schema *jsonschema.Schema, data []byte) []string {
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return []string{fmt.Sprintf("parse config JSON: %v", err)}
+	}
+
+	var problems []string
+	if err := schema.Validate(inst); err != nil {
+		var verr *jsonschema.ValidationError
+		if !errors.As(err, &verr) {
+			return []string{err.Error()}
+		}
+		// Report the leaves only; the errors above them just say that a
+		// $ref or group of keywords failed.
+		printer := message.NewPrinter(language.English)
+		var walk func(e *jsonschema.ValidationError)
+		walk = func(e *jsonschema.ValidationError) {
+			loc := ""
+			if len(e.InstanceLocation) > 0 {
+				loc = "/" + strings.Join(e.InstanceLocation, "/")
+			}
+			if len(e.Causes) == 0 {
+				problems = append(problems, fmt.Sprintf("%s: %s", describeLocation(loc), e.ErrorKind.LocalizedString(printer)))
+				return
+			}
+			if missing := missingAlternatives(e); missing != nil {
+				problems = append(problems, fmt.Sprintf("%s: missing one of %s", describeLocation(loc), strings.Join(missing, ", ")))
+				return
+			}
+			for _, c := range e.Causes {
+				walk(c)
+			}
+		}
+		walk(verr)
+	}
+
+	doc, _ := inst.(map[string]interface{})
+	problems = append(problems, validateRulePatterns("", doc["rules"])...)
+	sets, _ := doc["rule_sets"].(map[string]interface{})
+	for name, set := range sets {
+		setDoc, _ := set.(map[string]interface{})
+		problems = append(problems, validateRulePatterns(fmt.Sprintf("rule set %q ", name), setDoc["rules"])...)
+	}
+	return problems
+}
+
+func validateRulePatterns(prefix string, v interface{}) []string {
+	var problems []string
+	rules, _ := v.([]interface{})
+	for i, r := range rules {
+		rule, _ := r.(map[string]interface{})
+		excludes, _ := rule["exclude_patterns"].([]interface{})
+		for j, e := range excludes {
+			expr, _ := e.(string)
+			if _, err := regexp.Compile(expandEnv(expr)); err != nil {
+				problems = append(problems, fmt.Sprintf("%srule %d exclude pattern %d: compile regexp: %v", prefix, i, j, err))
+			}
+		}
+		fields := []string{"pattern"}
+		switch mt, _ := rule["match_type"].(string); MatchType(mt) {
+		case "", MatchTypeRegex:
+		case MatchTypeURL:
+			fields = []string{"scheme", "host", "port", "path", "query"}
+		default:
+			continue
+		}
+		for _, field := range fields {
+			expr, ok := rule[field].(string)
+			if !ok || expr == "" {
+				continue
+			}
+			if _, err := regexp.Compile(expandEnv(expr)); err != nil {
+				loc := ""
+				if field != "pattern" {
+					loc = " " + field
+				}
+				problems = append(problems, fmt.Sprintf("%srule %d%s: compile regexp: %v", prefix, i, loc, err))
+			}
+		}
+	}
+	return problems
+}
+
+// missingAlternatives returns the properties of an anyOf that failed only
+// because none of the properties it offers were given, e.g. a rule without
+// pattern, patterns_file, or patterns_url.
+func missingAlternatives(e *jsonschema.ValidationError) []string {
+	if _, ok := e.ErrorKind.(*kind.AnyOf); !ok {
+		return nil
+	}
+	var missing []string
+	for _, c := range e.Causes {
+		req, ok := c.ErrorKind.(*kind.Required)
+		if !ok || len(c.Causes) > 0 {
+			return nil
+		}
+		for _, m := range req.Missing {
+			missing = append(missing, "'"+m+"'")
+		}
+	}
+	return missing
+}
+
+// describeLocation turns a JSON pointer such as /rules/3/profile_dir into a
+// human friendly location.
+func describeLocation(ptr string) string {
+	if ptr == "" {
+		return "config"
+	}
+	if m := ruleLocationRe.FindStringSubmatch(ptr); m != nil {
+		i, _ := strconv.Atoi(m[1])
+		if m[2] == "" {
+			return fmt.Sprintf("rule %d", i)
+		}
+		return fmt.Sprintf("rule %d %s", i, strings.TrimPrefix(m[2], "/"))
+	}
+	return strings.TrimPrefix(ptr, "/")
+}
+
+func runConfigValidate(configPath string) int {
+	problems := validateConfig(configPath)
+	if len(problems) == 0 {
+		if cfg, err := loadConfig(configPath); err == nil {
+			for _, s := range staleRules(cfg) {
+				fmt.Fprintf(os.Stderr, "warning: %s\n", s)
+			}
+			for _, w := range cfg.warnings {
+				fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+			}
+		}
+		fmt.Printf("%s: OK\n", configPath)
+		return 0
+	}
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+	return 1
+}
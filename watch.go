@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// currentConfig holds the active configuration. It is swapped atomically
+// whenever the config file changes on disk.
+var currentConfig atomic.Pointer[Config]
+
+const configReloadDelay = 200 * time.Millisecond
+
+// configWatch is the watcher of watchConfig and the files outside the
+// config's directories it reloads for, which reloads add to.
+var configWatch struct {
+	mu      sync.Mutex
+	watcher *fsnotify.Watcher
+	files   map[string]bool
+}
+
+// watchConfig reloads the config whenever the file at path, one of its
+// conf.d fragments, the managed preferences, or a rule's patterns_file or
+// script change. Directories are watched rather than the files themselves
+// because most editors save by writing a temporary file and renaming it
+// over the original.
+func watchConfig(path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("watch config directory: %w", err)
+	}
+	confDir := confDirPath(path)
+	if err := watcher.Add(confDir); err != nil && !os.IsNotExist(err) {
+		logger.Errorf("Failed to watch %s: %v", confDir, err)
+	}
+	configWatch.mu.Lock()
+	configWatch.watcher = watcher
+	configWatch.files = map[string]bool{}
+	configWatch.mu.Unlock()
+	watchConfigFiles(managedConfigCandidates())
+	if cfg := currentConfig.Load(); cfg != nil {
+		watchConfigFiles(cfg.patternFiles)
+		watchConfigFiles(cfg.scriptFiles)
+	}
+
+	go func() {
+		defer watcher.Close()
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				name := filepath.Clean(event.Name)
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				if name == confDir && event.Has(fsnotify.Create) {
+					if err := watcher.Add(confDir); err != nil {
+						logger.Errorf("Failed to watch %s: %v", confDir, err)
+					}
+				} else if name != filepath.Clean(path) && filepath.Dir(name) != confDir && !watchingConfigFile(name) {
+					continue
+				}
+				// Editors often emit several events per save; wait for them to settle.
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(configReloadDelay, func() { reloadConfig(path) })
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Errorf("Config watcher error: %v", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// watchConfigFiles makes the config watcher reload for changes to files,
+// such as the pattern files and scripts of a config that was just loaded.
+func watchConfigFiles(files []string) {
+	configWatch.mu.Lock()
+	defer configWatch.mu.Unlock()
+	if configWatch.watcher == nil {
+		return
+	}
+	for _, p := range files {
+		p = filepath.Clean(p)
+		if configWatch.files[p] {
+			continue
+		}
+		configWatch.files[p] = true
+		if err := configWatch.watcher.Add(filepath.Dir(p)); err != nil && !os.IsNotExist(err) {
+			logger.Errorf("Failed to watch %s: %v", filepath.Dir(p), err)
+		}
+	}
+}
+
+// watchingConfigFile reports whether changes to the file at name reload the
+// config.
+func watchingConfigFile(name string) bool {
+	configWatch.mu.Lock()
+	defer configWatch.mu.Unlock()
+	return configWatch.files[name]
+}
+
+// reloadOnSignal reloads the config whenever the process receives SIGHUP,
+// which is how CLI commands notify a running instance.
+func reloadOnSignal(path string) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			reloadConfig(path)
+		}
+	}()
+}
+
+// reloadConfig loads the config at path and makes it the active one. On
+// failure the previous config is kept so a half-written file can't break
+// routing.
+func reloadConfig(path string) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		logger.Errorf("Failed to reload config, keeping the previous one: %v", err)
+		return
+	}
+	currentConfig.Store(&cfg)
+	watchConfigFiles(cfg.patternFiles)
+	watchConfigFiles(cfg.scriptFiles)
+	requestConditionAccess(cfg)
+	updateMenuBar(cfg)
+	registerHotKeys(cfg)
+	scheduleOverrideEnd(cfg)
+	logger.SetLevel(cfg.parsedLogLevel)
+	logger.Infof("Reloaded config from %s", path)
+	for _, s := range staleRules(cfg) {
+		logger.Warnf("Stale rule, consider removing it: %s", s)
+	}
+	for _, w := range cfg.warnings {
+		logger.Warn(w)
+	}
+}
@@ -0,0 +1,7 @@
+// CurrentSSID returns the name of the Wi-Fi network the Mac is connected to
+// as a string the caller must free, or NULL if it isn't known.
+char *CurrentSSID(void);
+
+// RequestLocationAccess asks for the Location Services access macOS requires
+// before it reveals the name of the Wi-Fi network.
+void RequestLocationAccess(void);
@@ -0,0 +1,26 @@
+#import <CoreLocation/CoreLocation.h>
+#import <CoreWLAN/CoreWLAN.h>
+#include "wifi.h"
+
+char *CurrentSSID(void) {
+  @autoreleasepool {
+    NSString *ssid = [[[CWWiFiClient sharedWiFiClient] interface] ssid];
+    if (ssid == nil) {
+      return NULL;
+    }
+    return strdup([ssid UTF8String]);
+  }
+}
+
+static CLLocationManager *locationManager;
+
+void RequestLocationAccess(void) {
+  dispatch_async(dispatch_get_main_queue(), ^{
+    if (locationManager == nil) {
+      locationManager = [[CLLocationManager alloc] init];
+    }
+    if ([locationManager authorizationStatus] == kCLAuthorizationStatusNotDetermined) {
+      [locationManager requestWhenInUseAuthorization];
+    }
+  });
+}
@@ -0,0 +1,126 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework Cocoa
+#include <stdlib.h>
+#include "windows.h"
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// windowPlacementTimeout bounds how long to wait for the browser's window
+// to show up and be moved.
+const windowPlacementTimeout = 5 * time.Second
+
+// placeWindowScript moves the front window of the process named by its
+// first argument into the area given by the next four, in points from the
+// top left of the main display. With "center" as the last argument, the
+// window keeps its size, shrunk to fit, and is centered in the area;
+// otherwise it fills it. Moving other apps' windows takes the Accessibility
+// permission.
+const placeWindowScript = `
+on run argv
+	set {procName, areaX, areaY, areaW, areaH, mode} to argv
+	set {areaX, areaY, areaW, areaH} to {areaX as integer, areaY as integer, areaW as integer, areaH as integer}
+	delay 0.3
+	tell application "System Events"
+		tell process procName
+			repeat 40 times
+				if (count of windows) > 0 then exit repeat
+				delay 0.1
+			end repeat
+			set win to front window
+			if mode is "center" then
+				set {winW, winH} to size of win
+				if winW > areaW then set winW to areaW
+				if winH > areaH then set winH to areaH
+				set position of win to {areaX + (areaW - winW) div 2, areaY + (areaH - winH) div 2}
+				set size of win to {winW, winH}
+			else
+				set position of win to {areaX, areaY}
+				set size of win to {areaW, areaH}
+			end if
+		end tell
+	end tell
+end run
+`
+
+// parseWindowBounds parses a rule's window_bounds, "x,y,w,h" in points.
+func parseWindowBounds(s string) ([4]int, error) {
+	var b [4]int
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return b, fmt.Errorf("window_bounds %q is not \"x,y,w,h\"", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return b, fmt.Errorf("window_bounds %q is not \"x,y,w,h\"", s)
+		}
+		b[i] = n
+	}
+	if b[2] <= 0 || b[3] <= 0 {
+		return b, fmt.Errorf("window_bounds %q needs a positive width and height", s)
+	}
+	return b, nil
+}
+
+// placesWindow reports whether t's window is moved once it has opened.
+func (t launchTarget) placesWindow() bool {
+	return t.windowDisplay != "" || t.windowBounds != ""
+}
+
+// placeWindow moves the window t's URL opened in. With window_bounds it is
+// given those bounds, measured from the top left of the display; with only
+// window_display it is centered on the display. Failures are logged, since
+// the URL is open either way.
+func placeWindow(config Config, t launchTarget) {
+	x, y, w, h, ok := displayFrame(t.windowDisplay)
+	if !ok {
+		if logger != nil {
+			logger.Warnf("Not placing the window for %s: no display %q", t, t.windowDisplay)
+		}
+		return
+	}
+	mode := "center"
+	if t.windowBounds != "" {
+		b, err := parseWindowBounds(t.windowBounds)
+		if err != nil {
+			return
+		}
+		x, y, w, h = x+b[0], y+b[1], b[2], b[3]
+		mode = "fill"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), windowPlacementTimeout)
+	defer cancel()
+	args := []string{"-e", placeWindowScript, appName(config.browserAppPath(t.browser))}
+	for _, n := range []int{x, y, w, h} {
+		args = append(args, strconv.Itoa(n))
+	}
+	if err := runLauncher(ctx, exec.CommandContext(ctx, "osascript", append(args, mode)...)); err != nil {
+		if logger != nil {
+			logger.Warnf("Failed to place the window for %s: %v", t, err)
+		}
+	}
+}
+
+// displayFrame returns the usable area of the display named name, or of the
+// main display for "".
+func displayFrame(name string) (x, y, w, h int, ok bool) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	var cx, cy, cw, ch C.double
+	if !C.DisplayFrame(cName, &cx, &cy, &cw, &ch) {
+		return 0, 0, 0, 0, false
+	}
+	return int(cx), int(cy), int(cw), int(ch), true
+}
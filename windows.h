@@ -0,0 +1,7 @@
+#include <stdbool.h>
+
+// DisplayFrame finds the display named name, or numbered name from 1 in the
+// order macOS lists them, or the main display when name is empty, and sets
+// the area of it not taken by the menu bar and Dock, in points from the top
+// left of the main display. It returns false when there is no such display.
+bool DisplayFrame(const char *name, double *x, double *y, double *w, double *h);
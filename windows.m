@@ -0,0 +1,40 @@
+#import <AppKit/AppKit.h>
+#include "windows.h"
+
+bool DisplayFrame(const char *name, double *x, double *y, double *w, double *h) {
+  @autoreleasepool {
+    NSArray<NSScreen *> *screens = [NSScreen screens];
+    if ([screens count] == 0) {
+      return false;
+    }
+    NSString *wanted = [NSString stringWithUTF8String:name];
+    NSScreen *screen = nil;
+    if ([wanted length] == 0) {
+      screen = screens[0];
+    } else if ([wanted integerValue] > 0 && [[NSString stringWithFormat:@"%ld", (long)[wanted integerValue]] isEqualToString:wanted]) {
+      NSInteger index = [wanted integerValue] - 1;
+      if (index < (NSInteger)[screens count]) {
+        screen = screens[index];
+      }
+    } else {
+      for (NSScreen *s in screens) {
+        if ([[s localizedName] caseInsensitiveCompare:wanted] == NSOrderedSame) {
+          screen = s;
+          break;
+        }
+      }
+    }
+    if (screen == nil) {
+      return false;
+    }
+    // AppKit measures up from the bottom of the main display, window
+    // positions down from its top.
+    NSRect frame = [screen visibleFrame];
+    CGFloat mainHeight = [screens[0] frame].size.height;
+    *x = frame.origin.x;
+    *y = mainHeight - frame.origin.y - frame.size.height;
+    *w = frame.size.width;
+    *h = frame.size.height;
+    return true;
+  }
+}